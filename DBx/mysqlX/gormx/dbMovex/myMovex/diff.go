@@ -0,0 +1,134 @@
+package myMovex
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// FieldDiff 不一致数据的字段级差异
+//   - 值序列化为稳定的字符串，经过 JSON 后不丢精度【int64 不会变成 float64】，NULL 为 nil
+//   - 整数、浮点数、布尔为 strconv 格式，time.Time 为 UTC 的 RFC3339Nano，[]byte 为 base64，其余类型为 JSON
+type FieldDiff struct {
+	Field string  `json:"field"`          // 列名
+	Type  string  `json:"type,omitempty"` // 值的 Go 类型，如 int64、time.Time、[]uint8
+	Src   *string `json:"src"`            // 校验基准表中的值
+	Dst   *string `json:"dst"`            // 被校验表中的值
+}
+
+// NewFieldDiff 按 FieldDiff 的格式序列化两边的值，自定义 Differ 时使用
+func NewFieldDiff(field string, src, dst any) FieldDiff {
+	res := FieldDiff{Field: field}
+	var srcType, dstType string
+	res.Src, srcType = formatValue(src)
+	res.Dst, dstType = formatValue(dst)
+	res.Type = srcType
+	if res.Type == "" {
+		res.Type = dstType
+	}
+	return res
+}
+
+// formatValue 值的稳定字符串形式和类型，nil、nil 指针、driver.Valuer 返回 nil 时为 NULL
+func formatValue(v any) (*string, string) {
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, rv.Type().Elem().String()
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil, ""
+	}
+	typ := rv.Type().String()
+	var s string
+	switch x := rv.Interface().(type) {
+	case time.Time:
+		s = x.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		s = base64.StdEncoding.EncodeToString(x)
+	case driver.Valuer:
+		val, err := x.Value()
+		if err != nil {
+			s = fmt.Sprintf("%v", x)
+			break
+		}
+		res, _ := formatValue(val)
+		return res, typ
+	default:
+		switch rv.Kind() {
+		case reflect.String:
+			s = rv.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s = strconv.FormatInt(rv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s = strconv.FormatUint(rv.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			s = strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits())
+		case reflect.Bool:
+			s = strconv.FormatBool(rv.Bool())
+		default:
+			b, err := json.Marshal(x)
+			if err != nil {
+				s = fmt.Sprintf("%v", x)
+			} else {
+				s = string(b)
+			}
+		}
+	}
+	return &s, typ
+}
+
+// Differ Entity 可选实现，自定义字段级差异的比较方式
+//   - 未实现时 Diff 按 gorm 解析出的列逐个反射比较
+type Differ interface {
+	// Diff 返回与 dst 不一致的字段，一致时返回空，FieldDiff 用 NewFieldDiff 构造
+	Diff(dst Entity) []FieldDiff
+}
+
+// schemaCache gorm schema 解析缓存
+var schemaCache = &sync.Map{}
+
+// Diff 计算 src 与 dst 的字段级差异
+//   - src 实现了 Differ 时使用其自定义比较
+//   - 否则按 gorm schema 的列反射比较，namer 为 nil 时使用 gorm 默认命名策略
+func Diff(src, dst Entity, namer schema.Namer) []FieldDiff {
+	if d, ok := src.(Differ); ok {
+		return d.Diff(dst)
+	}
+	if namer == nil {
+		namer = schema.NamingStrategy{}
+	}
+	sch, err := schema.Parse(src, schemaCache, namer)
+	if err != nil {
+		return nil
+	}
+	srcVal := reflect.Indirect(reflect.ValueOf(src))
+	dstVal := reflect.Indirect(reflect.ValueOf(dst))
+	if srcVal.Type() != dstVal.Type() {
+		return nil
+	}
+
+	ctx := context.Background()
+	var res []FieldDiff
+	for _, field := range sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		s, _ := field.ValueOf(ctx, srcVal)
+		d, _ := field.ValueOf(ctx, dstVal)
+		if !reflect.DeepEqual(s, d) {
+			res = append(res, NewFieldDiff(field.DBName, s, d))
+		}
+	}
+	return res
+}
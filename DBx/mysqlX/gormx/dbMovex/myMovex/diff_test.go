@@ -0,0 +1,73 @@
+package myMovex
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type diffUser struct {
+	Id    int64  `gorm:"primaryKey"`
+	Name  string `gorm:"column:nick_name"`
+	Email string
+	Utime int64
+}
+
+func (u diffUser) ID() int64 { return u.Id }
+
+func (u diffUser) CompareTo(dst Entity) bool { return u == dst }
+
+func (u diffUser) Types() string { return "diff_user" }
+
+type customDiffUser struct {
+	diffUser
+}
+
+func (u customDiffUser) Diff(dst Entity) []FieldDiff {
+	return []FieldDiff{NewFieldDiff("custom", u.Id, dst.ID())}
+}
+
+func TestDiff(t *testing.T) {
+	src := diffUser{Id: 1, Name: "a", Email: "a@x.com", Utime: 1}
+	dst := diffUser{Id: 1, Name: "b", Email: "a@x.com", Utime: 2}
+
+	assert.Equal(t, []FieldDiff{
+		{Field: "nick_name", Type: "string", Src: new("a"), Dst: new("b")},
+		{Field: "utime", Type: "int64", Src: new("1"), Dst: new("2")},
+	}, Diff(src, dst, nil))
+	assert.Empty(t, Diff(src, src, nil))
+
+	// 实现了 Differ 时使用自定义比较
+	assert.Equal(t, []FieldDiff{{Field: "custom", Type: "int64", Src: new("1"), Dst: new("1")}},
+		Diff(customDiffUser{src}, customDiffUser{dst}, nil))
+}
+
+// TestFieldDiffJSON 测试经过 JSON 后值不丢精度、不丢类型
+func TestFieldDiffJSON(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("CST", 8*3600))
+	var nilName *string
+	diffs := []FieldDiff{
+		NewFieldDiff("id", int64(1<<53+1), int64(1<<62)),
+		NewFieldDiff("ctime", ts, ts.Add(time.Nanosecond)),
+		NewFieldDiff("avatar", []byte{0xff, 0x00}, []byte("a")),
+		NewFieldDiff("name", nilName, new("b")),
+		NewFieldDiff("score", sql.NullFloat64{Float64: 0.1, Valid: true}, sql.NullFloat64{}),
+		NewFieldDiff("tags", map[string]int{"a": 1}, nil),
+	}
+	b, err := json.Marshal(diffs)
+	assert.NoError(t, err)
+	var got []FieldDiff
+	assert.NoError(t, json.Unmarshal(b, &got))
+
+	assert.Equal(t, []FieldDiff{
+		{Field: "id", Type: "int64", Src: new("9007199254740993"), Dst: new("4611686018427387904")},
+		{Field: "ctime", Type: "time.Time", Src: new("2026-01-01T19:04:05.000000006Z"), Dst: new("2026-01-01T19:04:05.000000007Z")},
+		{Field: "avatar", Type: "[]uint8", Src: new("/wA="), Dst: new("YQ==")},
+		{Field: "name", Type: "string", Src: nil, Dst: new("b")},
+		{Field: "score", Type: "sql.NullFloat64", Src: new("0.1"), Dst: nil},
+		{Field: "tags", Type: "map[string]int", Src: new(`{"a":1}`), Dst: nil},
+	}, got)
+}
@@ -0,0 +1,445 @@
+package doubleWritePoolx
+
+/*
+	=================================
+	此文件主要用来处理双写的补偿写
+	SrcFirst/DstFirst 阶段第二个库写失败时，把语句和参数持久化到补偿队列，
+	后台按顺序带退避重放，避免数据悄悄漂移
+	=================================
+*/
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"gorm.io/gorm"
+)
+
+var errCompensateBacklog = errors.New("补偿队列仍有积压，禁止推进双写模式")
+
+// 补偿写的目标库
+const (
+	CompensateTargetSrc = "src"
+	CompensateTargetDst = "dst"
+)
+
+// CompensateConfig 补偿写配置
+type CompensateConfig struct {
+	// Queue 补偿队列，为 nil 时不补偿，第二个库写失败直接返回 error
+	//   - 事务中第二个库写失败或提交失败时，第一个库提交后把事务内的全部写语句按顺序入队
+	//   - 实现了 ReplayQueue【如 WalQueue】时双写池在后台自动重放
+	//   - 只实现 CompensateQueue【如 ProducerQueue】时需自行消费重放，见 ProducerQueue.Handler
+	//   - UpdatePattern 按 Backlog 拦截推进，只有 WalQueue 的积压数是准确的；ProducerQueue 的积压数只在本进程内计数，
+	//     其他实例、重启后都为 0，推进前需自行确认补偿 topic 上消费者组的 lag 为 0
+	Queue CompensateQueue
+	// Interval 队列为空时的轮询间隔，默认 1s
+	Interval time.Duration
+	// MaxBackoff 重放失败时的最大退避时间，默认 1min，退避从 Interval 开始翻倍
+	MaxBackoff time.Duration
+}
+
+// CompensateQueue 补偿队列
+type CompensateQueue interface {
+	// Push 持久化一条补偿记录，返回 nil 后记录不能丢失
+	Push(ctx context.Context, entry CompensateEntry) error
+	// Backlog 未重放的记录数，UpdatePattern 据此拦截推进双写模式
+	Backlog() int64
+}
+
+// ReplayQueue 可由双写池自行重放的补偿队列，按 Push 的顺序逐条重放
+type ReplayQueue interface {
+	CompensateQueue
+	// Peek 返回最早一条未重放的记录，队列为空时 ok 为 false
+	Peek(ctx context.Context) (entry CompensateEntry, ok bool, err error)
+	// Ack 确认最早一条记录已重放
+	Ack(ctx context.Context) error
+}
+
+// CompensateEntry 一条补偿记录
+//   - 重放是至少一次：重放成功但确认失败时，同一进程内按 ID 跳过已重放的记录；
+//     重放成功后、确认前进程退出的，重启后会再重放一次，非幂等的语句【如 SET n = n + 1】会重复生效
+type CompensateEntry struct {
+	ID     string          `json:"id,omitempty"` // 记录唯一 id，重放成功但确认失败时据此跳过
+	Target string          `json:"target"`       // 需要补写的库 src/dst
+	Query  string          `json:"query"`
+	Args   []CompensateArg `json:"args"`
+	Ctime  int64           `json:"ctime"`
+}
+
+// CompensateArg 带类型的语句参数，保证 json 往返后类型不变
+type CompensateArg struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// 参数类型，取值为 driver.Value 允许的类型
+const (
+	argNil    = "nil"
+	argInt    = "int"
+	argFloat  = "float"
+	argBool   = "bool"
+	argBytes  = "bytes"
+	argString = "string"
+	argTime   = "time"
+)
+
+// NewCompensateEntry 把语句参数转换成 driver.Value 后编码
+func NewCompensateEntry(target, query string, args ...any) (CompensateEntry, error) {
+	entry := CompensateEntry{ID: uuid.NewString(), Target: target, Query: query, Args: make([]CompensateArg, 0, len(args)), Ctime: time.Now().UnixMilli()}
+	for i, arg := range args {
+		val, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return CompensateEntry{}, fmt.Errorf("补偿记录第 %d 个参数无法转换: %w", i, err)
+		}
+		var typ string
+		switch val.(type) {
+		case nil:
+			entry.Args = append(entry.Args, CompensateArg{Type: argNil})
+			continue
+		case int64:
+			typ = argInt
+		case float64:
+			typ = argFloat
+		case bool:
+			typ = argBool
+		case []byte:
+			typ = argBytes
+		case string:
+			typ = argString
+		case time.Time:
+			typ = argTime
+		default:
+			return CompensateEntry{}, fmt.Errorf("补偿记录第 %d 个参数类型不支持: %T", i, val)
+		}
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return CompensateEntry{}, err
+		}
+		entry.Args = append(entry.Args, CompensateArg{Type: typ, Value: raw})
+	}
+	return entry, nil
+}
+
+// Values 解码出语句参数
+func (e CompensateEntry) Values() ([]any, error) {
+	res := make([]any, 0, len(e.Args))
+	for i, arg := range e.Args {
+		var (
+			val any
+			err error
+		)
+		switch arg.Type {
+		case argNil:
+		case argInt:
+			val, err = decodeArg[int64](arg.Value)
+		case argFloat:
+			val, err = decodeArg[float64](arg.Value)
+		case argBool:
+			val, err = decodeArg[bool](arg.Value)
+		case argBytes:
+			val, err = decodeArg[[]byte](arg.Value)
+		case argString:
+			val, err = decodeArg[string](arg.Value)
+		case argTime:
+			val, err = decodeArg[time.Time](arg.Value)
+		default:
+			return nil, fmt.Errorf("补偿记录第 %d 个参数类型未知: %s", i, arg.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("补偿记录第 %d 个参数解码失败: %w", i, err)
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+func decodeArg[T any](raw json.RawMessage) (T, error) {
+	var v T
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// compensateBacklog 补偿队列积压数，未配置补偿时为 0
+func (d *DoubleWritePool) compensateBacklog() int64 {
+	if d.Config.Compensate.Queue == nil {
+		return 0
+	}
+	return d.Config.Compensate.Queue.Backlog()
+}
+
+// secondaryExec 写第二个库
+//   - 补偿队列有积压时直接入队，保证同一库上的语句按顺序生效
+//   - 写失败时入队，入队成功视为写成功，由后台重放
+func (d *DoubleWritePool) secondaryExec(ctx context.Context, target string, pool gorm.ConnPool, query string, args ...any) error {
+	if d.compensateBacklog() == 0 {
+		_, err := d.execWithRetry(ctx, pool, query, args...)
+		if o := d.getObserver(); err != nil && o != nil {
+			o.ObserveSecondaryFailure(d.Pattern.Load(), target)
+		}
+		if err == nil || d.Config.Compensate.Queue == nil {
+			return err
+		}
+		d.L.Warn("双写第二个库写入失败，写入补偿队列", logx.Error(err), logx.String("target", target), logx.String("sql", query))
+	}
+	return d.pushCompensate(ctx, target, query, args...)
+}
+
+// pushCompensate 编码并写入补偿队列
+func (d *DoubleWritePool) pushCompensate(ctx context.Context, target string, query string, args ...any) error {
+	entry, err := NewCompensateEntry(target, query, args...)
+	if err == nil {
+		// 与请求的 ctx 解耦，请求被取消时也要尽量持久化
+		pushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+		err = d.Config.Compensate.Queue.Push(pushCtx, entry)
+		cancel()
+	}
+	if err != nil {
+		return fmt.Errorf("写入补偿队列失败: %w", err)
+	}
+	d.mu.Lock()
+	d.Metrics.CompensatePushed++
+	d.mu.Unlock()
+	return nil
+}
+
+// txStmt 事务内执行过的一条写语句
+type txStmt struct {
+	query string
+	args  []any
+}
+
+// secondaryExec 事务内写第二个库
+//   - 未配置补偿队列时与第一个库一样直接执行，失败返回 error
+//   - 配置了补偿队列时记录语句；第二个库写失败、事务未开启或补偿队列有积压时回滚第二个库的事务，
+//     第一个库提交后把事务内的全部语句按顺序写入补偿队列，事务内已写过第二个库的语句也随回滚一起补偿
+func (d *DoubleWriteTx) secondaryExec(ctx context.Context, target string, tx *sql.Tx, query string, args ...any) error {
+	if d.pool == nil || d.config.Compensate.Queue == nil {
+		if tx == nil {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	}
+	if tx == nil && !d.compensate {
+		// 未配置第二个库
+		return nil
+	}
+	d.stmts = append(d.stmts, txStmt{query: query, args: args})
+	if d.compensate {
+		return nil
+	}
+	if d.pool.compensateBacklog() > 0 {
+		d.abandonSecondary(target)
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		if o := d.pool.getObserver(); o != nil {
+			o.ObserveSecondaryFailure(d.pattern, target)
+		}
+		d.l.Warn("事务中双写第二个库写入失败，提交后写入补偿队列", logx.Error(err), logx.String("target", target), logx.String("sql", query))
+		d.abandonSecondary(target)
+	}
+	return nil
+}
+
+// abandonSecondary 回滚并放弃第二个库的事务，改为提交后补偿
+func (d *DoubleWriteTx) abandonSecondary(target string) {
+	d.compensate = true
+	tx := &d.dst
+	if target == CompensateTargetSrc {
+		tx = &d.src
+	}
+	if *tx != nil {
+		_ = (*tx).Rollback()
+		*tx = nil
+	}
+}
+
+// pushCompensate 第一个库提交后，把事务内的写语句按顺序写入补偿队列
+func (d *DoubleWriteTx) pushCompensate(target string) error {
+	for _, stmt := range d.stmts {
+		if err := d.pool.pushCompensate(context.Background(), target, stmt.query, stmt.args...); err != nil {
+			d.l.Error("事务补偿记录写入失败，存在双写不一致风险", logx.Error(err), logx.String("target", target), logx.String("sql", stmt.query))
+			return fmt.Errorf("%s compensate after commit failed (inconsistency risk): %w", target, err)
+		}
+	}
+	return nil
+}
+
+// Replay 重放一条补偿记录
+func (d *DoubleWritePool) Replay(ctx context.Context, entry CompensateEntry) error {
+	args, err := entry.Values()
+	if err != nil {
+		return err
+	}
+	var pool gorm.ConnPool
+	switch entry.Target {
+	case CompensateTargetSrc:
+		pool = d.Src
+	case CompensateTargetDst:
+		pool = d.Dst
+	default:
+		return fmt.Errorf("补偿记录目标库未知: %s", entry.Target)
+	}
+	if pool == nil {
+		return fmt.Errorf("补偿记录目标库连接池为nil: %s", entry.Target)
+	}
+	_, err = pool.ExecContext(ctx, entry.Query, args...)
+	d.mu.Lock()
+	if err != nil {
+		d.Metrics.CompensateFailures++
+	} else {
+		d.Metrics.CompensateReplayed++
+	}
+	d.mu.Unlock()
+	return err
+}
+
+// startReplayer 启动后台重放
+func (d *DoubleWritePool) startReplayer(q ReplayQueue) {
+	d.replayWg.Add(1)
+	go func() {
+		defer d.replayWg.Done()
+		d.replay(q)
+	}()
+}
+
+// replay 按顺序逐条重放，失败时退避重试同一条，保证顺序
+func (d *DoubleWritePool) replay(q ReplayQueue) {
+	cfg := d.Config.Compensate
+	backoff := cfg.Interval
+	for {
+		empty, err := d.replayOnce(q)
+		wait := cfg.Interval
+		switch {
+		case err != nil:
+			d.L.Error("补偿重放失败，退避后重试", logx.Error(err), logx.Any("backoff", backoff))
+			wait = backoff
+			backoff = min(backoff*2, cfg.MaxBackoff)
+		case !empty:
+			// 还有积压，立即重放下一条
+			backoff = cfg.Interval
+			if d.ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// replayOnce 重放最早一条记录，返回队列是否为空
+//   - 重放成功但 Ack 失败时记录仍在队首，下次只重试 Ack，不再重放
+func (d *DoubleWritePool) replayOnce(q ReplayQueue) (empty bool, err error) {
+	ctx, cancel := context.WithTimeout(d.ctx, 10*time.Second)
+	defer cancel()
+	entry, ok, err := q.Peek(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return true, nil
+	}
+	if entry.ID == "" || entry.ID != d.replayedID {
+		if err = d.Replay(ctx, entry); err != nil {
+			return false, err
+		}
+		d.replayedID = entry.ID
+	}
+	return false, q.Ack(ctx)
+}
+
+// ProducerQueue 基于消息队列的补偿队列，补偿记录发到 topic，由 Handler 消费重放
+//   - Backlog 为本进程发出但本进程 Handler 尚未重放的记录数，不是 topic 上真实的积压：
+//     其他实例发出的记录、重启前发出未重放的记录都不计入，UpdatePattern 的积压拦截对它不可靠，
+//     推进双写模式前需自行确认补偿 topic 上消费者组的 lag 为 0
+type ProducerQueue struct {
+	producer mqX.Producer
+	topic    string
+	backlog  atomic.Int64
+}
+
+func NewProducerQueue(producer mqX.Producer, topic string) *ProducerQueue {
+	return &ProducerQueue{producer: producer, topic: topic}
+}
+
+func (q *ProducerQueue) Push(ctx context.Context, entry CompensateEntry) error {
+	val, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// 同一目标库的记录用同一个 key，落在同一分区保证顺序
+	err = q.producer.Send(ctx, &mqX.Message{Topic: q.topic, Key: []byte(entry.Target), Value: val})
+	if err != nil {
+		return err
+	}
+	q.backlog.Add(1)
+	return nil
+}
+
+func (q *ProducerQueue) Backlog() int64 {
+	return max(q.backlog.Load(), 0)
+}
+
+// Handler 消费补偿记录并在 pool 上重放，重放失败返回 error 让上游重试
+func (q *ProducerQueue) Handler(pool *DoubleWritePool) mqX.ConsumerHandlerType {
+	return &compensateHandler{q: q, pool: pool, replayed: make(map[string]string)}
+}
+
+type compensateHandler struct {
+	q    *ProducerQueue
+	pool *DoubleWritePool
+
+	mu       sync.Mutex
+	replayed map[string]string // 各目标库最近一条重放成功的记录 id，提交 offset 失败重新投递时跳过
+}
+
+func (h *compensateHandler) IsBatch() bool {
+	return false
+}
+
+func (h *compensateHandler) Handle(ctx context.Context, msg *mqX.Message) error {
+	var entry CompensateEntry
+	if err := json.Unmarshal(msg.Value, &entry); err != nil {
+		// 无法解析的记录重试也没用，记录后跳过
+		h.pool.L.Error("补偿记录解析失败", logx.Error(err), logx.String("topic", msg.Topic))
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if entry.ID != "" && h.replayed[entry.Target] == entry.ID {
+		// 同一目标库的记录在同一分区内按顺序投递，与上一条相同说明是重新投递
+		return nil
+	}
+	if err := h.pool.Replay(ctx, entry); err != nil {
+		return err
+	}
+	h.replayed[entry.Target] = entry.ID
+	h.q.backlog.Add(-1)
+	return nil
+}
+
+func (h *compensateHandler) HandleBatch(ctx context.Context, msgs []*mqX.Message) (success bool, err error) {
+	for _, msg := range msgs {
+		if err = h.Handle(ctx, msg); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,253 @@
+package doubleWritePoolx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/hgg-6/pkgTool/v2/syncX/atomicx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCompensateEntryValues 测试参数编码往返后类型不变
+func TestCompensateEntryValues(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	entry, err := NewCompensateEntry(CompensateTargetDst, "UPDATE t SET a=?,b=?,c=?,d=?,e=?,f=? WHERE id=?",
+		int(1), 1.5, true, []byte("x"), "s", now, nil)
+	require.NoError(t, err)
+	vals, err := entry.Values()
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(1), 1.5, true, []byte("x"), "s", now, nil}, vals)
+
+	_, err = NewCompensateEntry(CompensateTargetDst, "q", struct{}{})
+	assert.Error(t, err)
+}
+
+// TestWalQueue 测试 wal 补偿队列的顺序、确认和重启恢复
+func TestWalQueue(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewWalQueue(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, ok, err := q.Peek(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	for _, query := range []string{"q1", "q2", "q3"} {
+		require.NoError(t, q.Push(ctx, CompensateEntry{Target: CompensateTargetDst, Query: query}))
+	}
+	assert.Equal(t, int64(3), q.Backlog())
+
+	entry, ok, err := q.Peek(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "q1", entry.Query)
+	require.NoError(t, q.Ack(ctx))
+	require.NoError(t, q.Close())
+
+	// 模拟写入过程中宕机留下的半行
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"target":"dst","qu`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = NewWalQueue(dir)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, int64(2), q.Backlog())
+	for _, want := range []string{"q2", "q3"} {
+		entry, ok, err = q.Peek(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, want, entry.Query)
+		require.NoError(t, q.Ack(ctx))
+	}
+	assert.Equal(t, int64(0), q.Backlog())
+	stat, err := os.Stat(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stat.Size())
+
+	// 超长记录拒绝写入，不影响后面的记录
+	err = q.Push(ctx, CompensateEntry{Target: CompensateTargetDst, Query: strings.Repeat("x", walMaxLineSize)})
+	assert.ErrorIs(t, err, errWalEntryTooLarge)
+	assert.Equal(t, int64(0), q.Backlog())
+	require.NoError(t, q.Push(ctx, CompensateEntry{Target: CompensateTargetDst, Query: "q4"}))
+	entry, ok, err = q.Peek(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "q4", entry.Query)
+}
+
+// fakeQueue 仅测试用的补偿队列
+type fakeQueue struct {
+	backlog int64
+	entries []CompensateEntry
+}
+
+func (f *fakeQueue) Push(ctx context.Context, entry CompensateEntry) error {
+	f.backlog++
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeQueue) Backlog() int64 { return f.backlog }
+
+// ackFailQueue 只有一条记录，前 fails 次 Ack 失败
+type ackFailQueue struct {
+	fakeQueue
+	fails int
+}
+
+func (f *ackFailQueue) Peek(ctx context.Context) (CompensateEntry, bool, error) {
+	if len(f.entries) == 0 {
+		return CompensateEntry{}, false, nil
+	}
+	return f.entries[0], true, nil
+}
+
+func (f *ackFailQueue) Ack(ctx context.Context) error {
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("ack failed")
+	}
+	f.entries = f.entries[1:]
+	f.backlog--
+	return nil
+}
+
+// TestReplayAckFailed 测试重放成功但确认失败时不重复重放
+func TestReplayAckFailed(t *testing.T) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	src, _ := newMockGorm(t)
+	dst, dstMock := newMockGorm(t)
+	d := NewDoubleWritePool(src, dst, l, DoubleWriteConfig{RetryAttempts: 1})
+	entry, err := NewCompensateEntry(CompensateTargetDst, "UPDATE users SET n = n + 1 WHERE id = ?", 1)
+	require.NoError(t, err)
+	require.NotEmpty(t, entry.ID)
+
+	// 只允许执行一次
+	dstMock.ExpectExec("UPDATE users").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	q := &ackFailQueue{fails: 1}
+	require.NoError(t, q.Push(context.Background(), entry))
+	_, err = d.replayOnce(q)
+	assert.Error(t, err)
+	empty, err := d.replayOnce(q)
+	require.NoError(t, err)
+	assert.False(t, empty)
+	empty, err = d.replayOnce(q)
+	require.NoError(t, err)
+	assert.True(t, empty)
+	require.NoError(t, dstMock.ExpectationsWereMet())
+
+	// 消息队列重新投递同一条记录时也跳过
+	dstMock.ExpectExec("UPDATE users").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	pq := NewProducerQueue(nil, "compensate")
+	pq.backlog.Store(1)
+	h := pq.Handler(d)
+	val, err := json.Marshal(entry)
+	require.NoError(t, err)
+	msg := &mqX.Message{Topic: "compensate", Value: val}
+	require.NoError(t, h.Handle(context.Background(), msg))
+	require.NoError(t, h.Handle(context.Background(), msg))
+	require.NoError(t, dstMock.ExpectationsWereMet())
+	assert.Equal(t, int64(0), pq.Backlog())
+}
+
+// TestUpdatePatternWithBacklog 测试补偿队列有积压时禁止推进、允许回退
+func TestUpdatePatternWithBacklog(t *testing.T) {
+	q := &fakeQueue{backlog: 1}
+	d := &DoubleWritePool{
+		L:       zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled))),
+		Pattern: atomicx.NewValueOf(PatternSrcFirst),
+		Config:  DoubleWriteConfig{Compensate: CompensateConfig{Queue: q}},
+		Metrics: &Metrics{},
+	}
+	err := d.UpdatePattern(PatternDstFirst)
+	assert.True(t, errors.Is(err, errCompensateBacklog))
+	assert.Equal(t, int64(1), d.GetMetrics().CompensateBacklog)
+	assert.NoError(t, d.UpdatePattern(PatternSrcOnly))
+
+	q.backlog = 0
+	assert.NoError(t, d.UpdatePattern(PatternSrcFirst))
+}
+
+// TestTxCompensate 测试事务中第二个库写失败、提交失败时，第一个库提交后整个事务的语句写入补偿队列
+func TestTxCompensate(t *testing.T) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+
+	t.Run("exec failed", func(t *testing.T) {
+		src, srcMock := newMockGorm(t)
+		dst, dstMock := newMockGorm(t)
+		q := &fakeQueue{}
+		d := NewDoubleWritePool(src, dst, l, DoubleWriteConfig{RetryAttempts: 1, Compensate: CompensateConfig{Queue: q}})
+		d.Pattern.Store(PatternSrcFirst)
+
+		srcMock.ExpectBegin()
+		dstMock.ExpectBegin()
+		srcMock.ExpectExec("INSERT INTO users").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+		dstMock.ExpectExec("INSERT INTO users").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+		srcMock.ExpectExec("INSERT INTO users").WithArgs(2).WillReturnResult(sqlmock.NewResult(2, 1))
+		dstMock.ExpectExec("INSERT INTO users").WithArgs(2).WillReturnError(errors.New("dst down"))
+		dstMock.ExpectRollback()
+		srcMock.ExpectExec("UPDATE users").WithArgs("a", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		srcMock.ExpectCommit()
+
+		tx, err := d.BeginTx(context.Background(), nil)
+		require.NoError(t, err)
+		_, err = tx.ExecContext(context.Background(), "INSERT INTO users(id) VALUES (?)", 1)
+		require.NoError(t, err)
+		_, err = tx.ExecContext(context.Background(), "INSERT INTO users(id) VALUES (?)", 2)
+		require.NoError(t, err)
+		_, err = tx.ExecContext(context.Background(), "UPDATE users SET name = ? WHERE id = ?", "a", 1)
+		require.NoError(t, err)
+		require.NoError(t, tx.(Tx).Commit())
+
+		require.NoError(t, srcMock.ExpectationsWereMet())
+		require.NoError(t, dstMock.ExpectationsWereMet())
+		// 目标库的事务已回滚，第 1 条也要补偿
+		require.Len(t, q.entries, 3)
+		for _, entry := range q.entries {
+			assert.Equal(t, CompensateTargetDst, entry.Target)
+		}
+		assert.Equal(t, "UPDATE users SET name = ? WHERE id = ?", q.entries[2].Query)
+		assert.Equal(t, int64(3), d.GetMetrics().CompensatePushed)
+	})
+
+	t.Run("commit failed", func(t *testing.T) {
+		src, srcMock := newMockGorm(t)
+		dst, dstMock := newMockGorm(t)
+		q := &fakeQueue{}
+		d := NewDoubleWritePool(src, dst, l, DoubleWriteConfig{RetryAttempts: 1, Compensate: CompensateConfig{Queue: q}})
+		d.Pattern.Store(PatternDstFirst)
+
+		dstMock.ExpectBegin()
+		srcMock.ExpectBegin()
+		dstMock.ExpectExec("DELETE FROM users").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		srcMock.ExpectExec("DELETE FROM users").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		dstMock.ExpectCommit()
+		srcMock.ExpectCommit().WillReturnError(errors.New("src down"))
+
+		tx, err := d.BeginTx(context.Background(), nil)
+		require.NoError(t, err)
+		_, err = tx.ExecContext(context.Background(), "DELETE FROM users WHERE id = ?", 1)
+		require.NoError(t, err)
+		require.NoError(t, tx.(Tx).Commit())
+
+		require.NoError(t, srcMock.ExpectationsWereMet())
+		require.NoError(t, dstMock.ExpectationsWereMet())
+		require.Len(t, q.entries, 1)
+		assert.Equal(t, CompensateTargetSrc, q.entries[0].Target)
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/stateStorex"
 	"github.com/hgg-6/pkgTool/v2/logx"
 	"github.com/hgg-6/pkgTool/v2/syncX/atomicx"
 
@@ -32,6 +33,18 @@ type DoubleWriteConfig struct {
 	StrictMode    bool // true严格模式：任一失败就返回错误，默认false
 	RetryAttempts int  // 重试次数
 	EnableMetrics bool // 是否启用指标收集
+
+	// StateStore 双写模式持久化存储，为 nil 时双写模式只保存在内存中
+	//   - 创建双写池时会从中恢复上次的双写模式，UpdatePattern 时先持久化再切换
+	StateStore stateStorex.StateStore
+	StateName  string // 迁移任务名，同一迁移任务的多个 pod 需一致
+
+	// ShadowRead 影子读比对，SrcFirst/DstFirst 阶段按采样率在后台对另一个库执行同样的查询并比对
+	ShadowRead ShadowReadConfig
+
+	// Compensate 补偿写，SrcFirst/DstFirst 阶段第二个库写失败时写入补偿队列并在后台重放
+	//   - 补偿队列有积压时禁止推进双写模式，回退不受限制
+	Compensate CompensateConfig
 }
 
 // DoubleWritePool 双写连接池
@@ -50,6 +63,14 @@ type DoubleWritePool struct {
 	metricsWg      sync.WaitGroup
 	metricsStarted bool       // 标记指标收集是否已启动
 	metricsStartMu sync.Mutex // 保护metricsStarted字段
+
+	shadowSem chan struct{} // 限制同时进行的影子读
+	shadowWg  sync.WaitGroup
+
+	replayWg   sync.WaitGroup
+	replayedID string // 最近一条重放成功的补偿记录 id，只由重放 goroutine 读写
+
+	observer *atomicx.Value[observerHolder] // 执行观测，见 SetObserver
 }
 
 // Metrics 监控指标
@@ -57,6 +78,16 @@ type Metrics struct {
 	DoubleWriteSuccess int64
 	DoubleWriteFailure int64
 	QueryDuration      []time.Duration
+
+	ShadowReads      int64 // 影子读次数
+	ShadowMismatches int64 // 影子读发现不一致的次数
+	ShadowFailures   int64 // 影子读查询失败次数
+	ShadowOversize   int64 // 主库结果集超过 MaxRows/MaxBytes 放弃比对的次数
+
+	CompensateBacklog  int64 // 补偿队列积压数，GetMetrics 时刷新
+	CompensatePushed   int64 // 写入补偿队列的次数
+	CompensateReplayed int64 // 补偿重放成功次数
+	CompensateFailures int64 // 补偿重放失败次数
 }
 
 // NewDoubleWritePool 创建双写连接池
@@ -70,6 +101,25 @@ func NewDoubleWritePool(src *gorm.DB, dst *gorm.DB, l logx.Loggerx, config ...Do
 		cfg = config[0]
 	}
 
+	if cfg.ShadowRead.Timeout <= 0 {
+		cfg.ShadowRead.Timeout = 3 * time.Second
+	}
+	if cfg.ShadowRead.Concurrency <= 0 {
+		cfg.ShadowRead.Concurrency = 16
+	}
+	if cfg.ShadowRead.MaxRows <= 0 {
+		cfg.ShadowRead.MaxRows = 1000
+	}
+	if cfg.ShadowRead.MaxBytes <= 0 {
+		cfg.ShadowRead.MaxBytes = 1 << 20
+	}
+	if cfg.Compensate.Interval <= 0 {
+		cfg.Compensate.Interval = time.Second
+	}
+	if cfg.Compensate.MaxBackoff <= 0 {
+		cfg.Compensate.MaxBackoff = time.Minute
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	pool := &DoubleWritePool{
@@ -81,21 +131,52 @@ func NewDoubleWritePool(src *gorm.DB, dst *gorm.DB, l logx.Loggerx, config ...Do
 		Metrics: &Metrics{},
 		ctx:     ctx,
 		cancel:  cancel,
+
+		shadowSem: make(chan struct{}, cfg.ShadowRead.Concurrency),
+		observer:  atomicx.NewValue[observerHolder](),
 	}
 
 	if cfg.EnableMetrics {
 		pool.startMetricsCollection()
 	}
+	if cfg.StateStore != nil {
+		pool.restorePattern()
+	}
+	if q, ok := cfg.Compensate.Queue.(ReplayQueue); ok {
+		pool.startReplayer(q)
+	}
 
 	return pool
 }
 
+// restorePattern 从进度存储中恢复双写模式
+func (d *DoubleWritePool) restorePattern() {
+	ctx, cancel := context.WithTimeout(d.ctx, 3*time.Second)
+	defer cancel()
+	snap, err := stateStorex.LoadSnapshot(ctx, d.Config.StateStore, d.Config.StateName)
+	if err != nil {
+		d.L.Error("恢复双写模式失败，使用默认模式", logx.Error(err), logx.String("name", d.Config.StateName))
+		return
+	}
+	switch snap.Pattern {
+	case PatternSrcOnly, PatternSrcFirst, PatternDstOnly, PatternDstFirst:
+		d.Pattern.Store(snap.Pattern)
+		d.L.Info("已恢复双写模式", logx.String("pattern", snap.Pattern), logx.String("name", d.Config.StateName))
+	case "":
+		// 未保存过双写模式，使用默认模式
+	default:
+		d.L.Warn("持久化的双写模式未知，使用默认模式", logx.String("pattern", snap.Pattern))
+	}
+}
+
 // Close 关闭双写池，释放资源
 func (d *DoubleWritePool) Close() error {
 	d.cancel()
 	if d.Config.EnableMetrics {
 		d.metricsWg.Wait()
 	}
+	d.shadowWg.Wait()
+	d.replayWg.Wait()
 	d.L.Info("双写池已关闭")
 	return nil
 }
@@ -119,9 +200,22 @@ func (d *DoubleWritePool) startMetricsCollection() {
 }
 
 // UpdatePattern 更新双写模式
+//   - 补偿队列有积压时拒绝推进，回退不受限；积压数取自 CompensateQueue.Backlog，只有 WalQueue 是准确的，
+//     使用 ProducerQueue 时需自行确认补偿 topic 已消费完
 func (d *DoubleWritePool) UpdatePattern(pattern string) error {
 	switch pattern {
 	case PatternSrcOnly, PatternSrcFirst, PatternDstOnly, PatternDstFirst:
+		if backlog := d.compensateBacklog(); backlog > 0 && PatternIndex(pattern) > PatternIndex(d.Pattern.Load()) {
+			return fmt.Errorf("%w: 积压 %d 条", errCompensateBacklog, backlog)
+		}
+		if d.Config.StateStore != nil {
+			// 先持久化再切换，避免重启后回退到旧模式
+			ctx, cancel := context.WithTimeout(d.ctx, 3*time.Second)
+			defer cancel()
+			if err := d.Config.StateStore.Save(ctx, d.Config.StateName, stateStorex.FieldPattern, []byte(pattern)); err != nil {
+				return fmt.Errorf("持久化双写模式失败: %w", err)
+			}
+		}
 		d.Pattern.Store(pattern)
 		d.L.Info("双写模式已更新", logx.String("pattern", pattern))
 		return nil
@@ -159,8 +253,10 @@ func (d *DoubleWritePool) HealthCheck() map[string]error {
 
 // GetMetrics 获取监控指标
 func (d *DoubleWritePool) GetMetrics() *Metrics {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+	backlog := d.compensateBacklog()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Metrics.CompensateBacklog = backlog
 	return d.Metrics
 }
 
@@ -193,7 +289,10 @@ func (d *DoubleWritePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gor
 			return nil, err
 		}
 
-		var dst *sql.Tx
+		var (
+			dst        *sql.Tx
+			compensate bool
+		)
 		if d.Dst != nil {
 			dst, err = d.Dst.(gorm.TxBeginner).BeginTx(ctx, opts)
 			if err != nil {
@@ -202,14 +301,18 @@ func (d *DoubleWritePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gor
 					_ = src.Rollback()
 					return nil, fmt.Errorf("strict mode: dst begin tx failed: %w", err)
 				}
+				// 配置了补偿队列时，源库提交后把事务内的语句写入补偿队列
+				compensate = d.Config.Compensate.Queue != nil
 			}
 		}
 		return &DoubleWriteTx{
-			src:     src,
-			dst:     dst,
-			pattern: pattern,
-			l:       d.L,
-			config:  &d.Config,
+			src:        src,
+			dst:        dst,
+			pattern:    pattern,
+			l:          d.L,
+			config:     &d.Config,
+			pool:       d,
+			compensate: compensate,
 		}, nil
 
 	case PatternDstFirst:
@@ -221,7 +324,10 @@ func (d *DoubleWritePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gor
 			return nil, err
 		}
 
-		var src *sql.Tx
+		var (
+			src        *sql.Tx
+			compensate bool
+		)
 		if d.Src != nil {
 			src, err = d.Src.(gorm.TxBeginner).BeginTx(ctx, opts)
 			if err != nil {
@@ -230,14 +336,17 @@ func (d *DoubleWritePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gor
 					_ = dst.Rollback()
 					return nil, fmt.Errorf("strict mode: src begin tx failed: %w", err)
 				}
+				compensate = d.Config.Compensate.Queue != nil
 			}
 		}
 		return &DoubleWriteTx{
-			src:     src,
-			dst:     dst,
-			pattern: pattern,
-			l:       d.L,
-			config:  &d.Config,
+			src:        src,
+			dst:        dst,
+			pattern:    pattern,
+			l:          d.L,
+			config:     &d.Config,
+			pool:       d,
+			compensate: compensate,
 		}, nil
 
 	case PatternDstOnly:
@@ -268,13 +377,13 @@ func (d *DoubleWritePool) PrepareContext(ctx context.Context, query string) (*sq
 // ExecContext 执行写操作
 func (d *DoubleWritePool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	start := time.Now()
+	pattern := d.Pattern.Load()
 	var execErr error
 	defer func() {
 		duration := time.Since(start)
-		d.recordMetrics(duration, execErr)
+		d.recordMetrics(OpExec, pattern, duration, execErr)
 	}()
 
-	pattern := d.Pattern.Load()
 	switch pattern {
 	case PatternSrcOnly:
 		if d.Src == nil {
@@ -303,7 +412,7 @@ func (d *DoubleWritePool) ExecContext(ctx context.Context, query string, args ..
 
 		// 源库执行成功，尝试写目标库
 		if d.Dst != nil {
-			_, err1 := d.execWithRetry(ctx, d.Dst, query, args...)
+			err1 := d.secondaryExec(ctx, CompensateTargetDst, d.Dst, query, args...)
 			if err1 != nil {
 				// src 已写、dst 写失败，返回 error 让调用方能感知双写不一致并补偿。
 				d.L.Error("双写写入目标库失败，存在双写不一致风险",
@@ -340,7 +449,7 @@ func (d *DoubleWritePool) ExecContext(ctx context.Context, query string, args ..
 		}
 
 		if d.Src != nil {
-			_, err1 := d.execWithRetry(ctx, d.Src, query, args...)
+			err1 := d.secondaryExec(ctx, CompensateTargetSrc, d.Src, query, args...)
 			if err1 != nil {
 				d.L.Error("双写写入源库失败，存在双写不一致风险",
 					logx.Error(err1),
@@ -361,25 +470,31 @@ func (d *DoubleWritePool) ExecContext(ctx context.Context, query string, args ..
 // QueryContext 执行查询操作
 func (d *DoubleWritePool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	start := time.Now()
+	pattern := d.Pattern.Load()
 	var queryErr error
 	defer func() {
 		duration := time.Since(start)
-		d.recordMetrics(duration, queryErr)
+		d.recordMetrics(OpQuery, pattern, duration, queryErr)
 	}()
 
-	pattern := d.Pattern.Load()
 	switch pattern {
 	case PatternSrcOnly, PatternSrcFirst:
 		if d.Src == nil {
 			queryErr = errNilSourcePool
 			return nil, queryErr
 		}
+		if d.shadowAcquire(pattern) {
+			return d.shadowQuery(ctx, pattern, d.Src, query, args...).sqlRows(ctx)
+		}
 		return d.Src.QueryContext(ctx, query, args...)
 	case PatternDstOnly, PatternDstFirst:
 		if d.Dst == nil {
 			queryErr = errNilTargetPool
 			return nil, queryErr
 		}
+		if d.shadowAcquire(pattern) {
+			return d.shadowQuery(ctx, pattern, d.Dst, query, args...).sqlRows(ctx)
+		}
 		return d.Dst.QueryContext(ctx, query, args...)
 	default:
 		queryErr = errUnknownPattern
@@ -390,24 +505,30 @@ func (d *DoubleWritePool) QueryContext(ctx context.Context, query string, args .
 // QueryRowContext 执行查询单行操作
 func (d *DoubleWritePool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
 	start := time.Now()
+	pattern := d.Pattern.Load()
 	defer func() {
 		duration := time.Since(start)
-		d.recordMetrics(duration, nil)
+		d.recordMetrics(OpQuery, pattern, duration, nil)
 	}()
 
-	pattern := d.Pattern.Load()
 	switch pattern {
 	case PatternSrcOnly, PatternSrcFirst:
 		if d.Src == nil {
 			// 返回一个包含错误的 Row
 			return &sql.Row{}
 		}
+		if d.shadowAcquire(pattern) {
+			return d.shadowQuery(ctx, pattern, d.Src, query, args...).sqlRow(ctx)
+		}
 		return d.Src.QueryRowContext(ctx, query, args...)
 	case PatternDstOnly, PatternDstFirst:
 		if d.Dst == nil {
 			// 返回一个包含错误的 Row
 			return &sql.Row{}
 		}
+		if d.shadowAcquire(pattern) {
+			return d.shadowQuery(ctx, pattern, d.Dst, query, args...).sqlRow(ctx)
+		}
 		return d.Dst.QueryRowContext(ctx, query, args...)
 	default:
 		// 返回一个包含错误的 Row
@@ -419,6 +540,9 @@ func (d *DoubleWritePool) QueryRowContext(ctx context.Context, query string, arg
 func (d *DoubleWritePool) execWithRetry(ctx context.Context, pool gorm.ConnPool, query string, args ...interface{}) (sql.Result, error) {
 	var lastErr error
 	for i := 0; i < d.Config.RetryAttempts; i++ {
+		if o := d.getObserver(); i > 0 && o != nil {
+			o.ObserveRetry(d.Pattern.Load())
+		}
 		result, err := pool.ExecContext(ctx, query, args...)
 		if err == nil {
 			return result, nil
@@ -438,7 +562,10 @@ func (d *DoubleWritePool) execWithRetry(ctx context.Context, pool gorm.ConnPool,
 }
 
 // recordMetrics 记录指标
-func (d *DoubleWritePool) recordMetrics(duration time.Duration, err error) {
+func (d *DoubleWritePool) recordMetrics(op, pattern string, duration time.Duration, err error) {
+	if o := d.getObserver(); o != nil {
+		o.ObserveOp(op, pattern, duration, err)
+	}
 	if !d.Config.EnableMetrics {
 		return
 	}
@@ -490,6 +617,12 @@ type DoubleWriteTx struct {
 	pattern string
 	l       logx.Loggerx
 	config  *DoubleWriteConfig
+	pool    *DoubleWritePool
+
+	// compensate 第二个库的事务已放弃，第一个库提交后把 stmts 写入补偿队列
+	compensate bool
+	// stmts 配置了补偿队列时记录事务内的写语句
+	stmts []txStmt
 }
 
 // Commit 提交事务
@@ -514,8 +647,15 @@ func (d *DoubleWriteTx) Commit() error {
 			return fmt.Errorf("src commit failed: %w", err)
 		}
 
+		if d.compensate {
+			return d.pushCompensate(CompensateTargetDst)
+		}
 		if d.dst != nil {
 			if err := d.dst.Commit(); err != nil {
+				if d.config.Compensate.Queue != nil {
+					d.l.Warn("目标库提交事务失败，写入补偿队列", logx.Error(err))
+					return d.pushCompensate(CompensateTargetDst)
+				}
 				// src 已提交、dst 提交失败，返回 error 让调用方感知双写不一致。
 				d.l.Error("目标库提交事务失败，存在双写不一致风险", logx.Error(err))
 				return fmt.Errorf("dst commit failed (src already committed, inconsistency risk): %w", err)
@@ -536,8 +676,15 @@ func (d *DoubleWriteTx) Commit() error {
 			return fmt.Errorf("dst commit failed: %w", err)
 		}
 
+		if d.compensate {
+			return d.pushCompensate(CompensateTargetSrc)
+		}
 		if d.src != nil {
 			if err := d.src.Commit(); err != nil {
+				if d.config.Compensate.Queue != nil {
+					d.l.Warn("源库提交事务失败，写入补偿队列", logx.Error(err))
+					return d.pushCompensate(CompensateTargetSrc)
+				}
 				d.l.Error("源库提交事务失败，存在双写不一致风险", logx.Error(err))
 				return fmt.Errorf("src commit failed (dst already committed, inconsistency risk): %w", err)
 			}
@@ -630,14 +777,11 @@ func (d *DoubleWriteTx) ExecContext(ctx context.Context, query string, args ...i
 			return res, err
 		}
 
-		if d.dst != nil {
-			_, err1 := d.dst.ExecContext(ctx, query, args...)
-			if err1 != nil {
-				d.l.Error("事务中双写写入目标库失败，存在双写不一致风险",
-					logx.Error(err1),
-					logx.String("sql", query))
-				return res, fmt.Errorf("dst exec in tx failed (src already written, inconsistency risk): %w", err1)
-			}
+		if err1 := d.secondaryExec(ctx, CompensateTargetDst, d.dst, query, args...); err1 != nil {
+			d.l.Error("事务中双写写入目标库失败，存在双写不一致风险",
+				logx.Error(err1),
+				logx.String("sql", query))
+			return res, fmt.Errorf("dst exec in tx failed (src already written, inconsistency risk): %w", err1)
 		}
 		return res, err
 
@@ -657,14 +801,11 @@ func (d *DoubleWriteTx) ExecContext(ctx context.Context, query string, args ...i
 			return res, err
 		}
 
-		if d.src != nil {
-			_, err1 := d.src.ExecContext(ctx, query, args...)
-			if err1 != nil {
-				d.l.Error("事务中双写写入源库失败，存在双写不一致风险",
-					logx.Error(err1),
-					logx.String("sql", query))
-				return res, fmt.Errorf("src exec in tx failed (dst already written, inconsistency risk): %w", err1)
-			}
+		if err1 := d.secondaryExec(ctx, CompensateTargetSrc, d.src, query, args...); err1 != nil {
+			d.l.Error("事务中双写写入源库失败，存在双写不一致风险",
+				logx.Error(err1),
+				logx.String("sql", query))
+			return res, fmt.Errorf("src exec in tx failed (dst already written, inconsistency risk): %w", err1)
 		}
 		return res, err
 
@@ -709,6 +850,22 @@ func (d *DoubleWriteTx) QueryRowContext(ctx context.Context, query string, args
 	}
 }
 
+// PatternIndex 双写模式在迁移流程中的顺序，越大越靠后，未知模式返回 -1【排在 SrcOnly 之前】
+func PatternIndex(pattern string) int {
+	switch pattern {
+	case PatternSrcOnly:
+		return 0
+	case PatternSrcFirst:
+		return 1
+	case PatternDstFirst:
+		return 2
+	case PatternDstOnly:
+		return 3
+	default:
+		return -1
+	}
+}
+
 // 双写模式常量
 const (
 	PatternSrcOnly  = "src_only"  // 只写源库
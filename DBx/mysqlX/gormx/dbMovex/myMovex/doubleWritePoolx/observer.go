@@ -0,0 +1,50 @@
+package doubleWritePoolx
+
+import (
+	"time"
+)
+
+// 观测的操作类型
+const (
+	OpExec  = "exec"
+	OpQuery = "query"
+)
+
+// Observer 双写池执行观测，用于导出监控指标，实现需并发安全且不能阻塞
+type Observer interface {
+	// ObserveOp 一次读写操作，op 为 OpExec/OpQuery，err 为主库的结果
+	ObserveOp(op, pattern string, duration time.Duration, err error)
+	// ObserveSecondaryFailure 第二个库写失败，target 为 src/dst
+	ObserveSecondaryFailure(pattern, target string)
+	// ObserveRetry 写操作重试一次
+	ObserveRetry(pattern string)
+}
+
+// observerHolder 包一层，atomicx.Value 不能存 nil 接口
+type observerHolder struct {
+	o Observer
+}
+
+// SetObserver 设置执行观测，传 nil 取消
+func (d *DoubleWritePool) SetObserver(o Observer) {
+	d.observer.Store(observerHolder{o: o})
+}
+
+// getObserver 当前的执行观测，未设置时为 nil
+func (d *DoubleWritePool) getObserver() Observer {
+	if d.observer == nil {
+		return nil
+	}
+	return d.observer.Load().o
+}
+
+// Snapshot 返回当前指标的拷贝，不含 QueryDuration，可并发读取
+func (d *DoubleWritePool) Snapshot() Metrics {
+	backlog := d.compensateBacklog()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	res := *d.Metrics
+	res.QueryDuration = nil
+	res.CompensateBacklog = backlog
+	return res
+}
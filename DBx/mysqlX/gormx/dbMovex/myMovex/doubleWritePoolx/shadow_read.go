@@ -0,0 +1,509 @@
+package doubleWritePoolx
+
+/*
+	=================================
+	此文件主要用来处理影子读比对
+	双写阶段（SrcFirst/DstFirst）按采样率在后台对另一个库执行同样的查询，逐行比对结果集，尽早发现读路径上的数据漂移
+	采样命中时主库的结果先完整读入内存，再通过内存驱动回放给调用方，后台只查影子库并与调用方拿到的结果比对，主库只查一次
+	结果集超过 MaxRows/MaxBytes 时停止读入，回放完已读入的行后继续读主库的结果集，放弃本次比对
+	=================================
+*/
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"gorm.io/gorm"
+)
+
+// ShadowReadConfig 影子读配置
+type ShadowReadConfig struct {
+	// SampleRate 采样率，取值 (0, 1]，<=0 时关闭影子读
+	SampleRate float64
+	// Timeout 单次影子库查询的超时时间，默认 3s
+	Timeout time.Duration
+	// Concurrency 同时进行的影子读上限，超过时直接放弃本次采样，默认 16
+	Concurrency int
+	// IdColumn 按此列对齐两边的行，结果集不含此列时按行序比对，默认 id
+	IdColumn string
+	// MaxRows 采样时读入内存的行数上限，超过时放弃本次比对，调用方继续读主库的结果集，默认 1000
+	MaxRows int
+	// MaxBytes 采样时读入内存的字节数上限【按列值估算】，超过时同 MaxRows，默认 1MB
+	MaxBytes int
+	// OnMismatch 可选，发现不一致时回调，如上报 kafka 见 ProducerMismatchHandler
+	OnMismatch func(ctx context.Context, m ShadowMismatch)
+}
+
+// ShadowMismatch 一次影子读发现的不一致
+type ShadowMismatch struct {
+	Pattern string
+	Query   string
+	Args    []any
+	// Events 不一致的行，有 id 列时可直接交给修复消费者
+	//   - Direction 为主库一方，SrcFirst 为 SRC，DstFirst 为 DST
+	//   - 影子库缺少的行为 target_missing，影子库多出的行为 base_missing，值不同为 neq
+	Events []events.InconsistentEvent
+}
+
+// shadowRow 扫描出的一行，列名 -> 值
+type shadowRow map[string]any
+
+// shadowEnabled 当前是否需要影子读
+func (d *DoubleWritePool) shadowEnabled(pattern string) bool {
+	if d.Config.ShadowRead.SampleRate <= 0 || d.Src == nil || d.Dst == nil {
+		return false
+	}
+	if pattern != PatternSrcFirst && pattern != PatternDstFirst {
+		return false
+	}
+	return d.Config.ShadowRead.SampleRate >= 1 || rand.Float64() < d.Config.ShadowRead.SampleRate
+}
+
+// shadowAcquire 采样命中且未积压时占用一个影子读名额，返回 true 时必须调用 shadowRelease
+func (d *DoubleWritePool) shadowAcquire(pattern string) bool {
+	if !d.shadowEnabled(pattern) {
+		return false
+	}
+	select {
+	case d.shadowSem <- struct{}{}:
+		d.shadowWg.Add(1)
+		return true
+	default:
+		// 影子读积压，放弃本次采样，保证不影响主流程
+		return false
+	}
+}
+
+func (d *DoubleWritePool) shadowRelease() {
+	<-d.shadowSem
+	d.shadowWg.Done()
+}
+
+// shadowQuery 主库查询一次并把结果完整读入内存，后台用这份结果与影子库比对，调用方拿到的是同一份结果的回放
+//   - 调用前须 shadowAcquire 成功，名额在后台比对结束后释放
+//   - 结果集超过 MaxRows/MaxBytes 时放弃比对，调用方读完已读入的行后继续读主库的结果集
+func (d *DoubleWritePool) shadowQuery(ctx context.Context, pattern string, primary gorm.ConnPool, query string, args ...any) *capturedRows {
+	captured := d.captureRows(ctx, primary, query, args...)
+	if captured.err != nil || captured.rest != nil {
+		if captured.rest != nil {
+			d.recordShadowOversize()
+		}
+		d.shadowRelease()
+		return captured
+	}
+	// 回放给调用方前先转换好，调用方扫描到 sql.RawBytes 后修改也不影响比对
+	base := captured.shadowRows()
+	go func() {
+		defer d.shadowRelease()
+		// 与请求的 ctx 解耦，请求结束后影子读仍可完成
+		ctx, cancel := context.WithTimeout(d.ctx, d.Config.ShadowRead.Timeout)
+		defer cancel()
+		d.compareShadow(ctx, pattern, base, query, args...)
+	}()
+	return captured
+}
+
+// compareShadow 影子库执行一次查询，与主库的结果逐行比对
+func (d *DoubleWritePool) compareShadow(ctx context.Context, pattern string, base []shadowRow, query string, args ...any) {
+	shadow, direction := d.Dst, "SRC"
+	if pattern == PatternDstFirst {
+		shadow, direction = d.Src, "DST"
+	}
+
+	captured := d.captureRows(ctx, shadow, query, args...)
+	err := captured.err
+	if captured.rest != nil {
+		captured.rest.Close()
+		err = errShadowOversize
+	}
+	if err != nil {
+		d.recordShadow(false, true)
+		d.L.Warn("影子读查询失败", logx.Error(err), logx.String("pattern", pattern), logx.String("sql", query))
+		return
+	}
+
+	evts := compareShadowRows(base, captured.shadowRows(), d.Config.ShadowRead.IdColumn, direction)
+	d.recordShadow(len(evts) > 0, false)
+	if len(evts) == 0 {
+		return
+	}
+	d.L.Warn("影子读发现数据不一致", logx.String("pattern", pattern), logx.String("sql", query),
+		logx.Any("args", args), logx.Int("count", len(evts)), logx.Any("events", evts))
+	if d.Config.ShadowRead.OnMismatch != nil {
+		d.Config.ShadowRead.OnMismatch(ctx, ShadowMismatch{Pattern: pattern, Query: query, Args: args, Events: evts})
+	}
+}
+
+// recordShadow 记录影子读指标，影子读为显式开启，不受 EnableMetrics 控制
+func (d *DoubleWritePool) recordShadow(mismatch, failed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Metrics.ShadowReads++
+	if mismatch {
+		d.Metrics.ShadowMismatches++
+	}
+	if failed {
+		d.Metrics.ShadowFailures++
+	}
+}
+
+// recordShadowOversize 记录主库结果集超过上限放弃比对的次数
+func (d *DoubleWritePool) recordShadowOversize() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Metrics.ShadowOversize++
+}
+
+var errShadowOversize = errors.New("影子库结果集超过 MaxRows/MaxBytes")
+
+// capturedRows 读入内存的结果集，值为驱动返回的原始值，可通过 sqlRows/sqlRow 回放成 *sql.Rows、*sql.Row
+type capturedRows struct {
+	cols  []string
+	types []*sql.ColumnType
+	rows  [][]any
+	err   error
+	// rest 超过上限时未读完的结果集，回放完 rows 后继续从这里读，回放结束时关闭
+	rest *sql.Rows
+}
+
+// captureRows 执行查询并把结果集读入内存，出错时记录在 err 中
+//   - 读入的行数超过 MaxRows 或字节数超过 MaxBytes 时停止读取，未读完的结果集保留在 rest 中
+func (d *DoubleWritePool) captureRows(ctx context.Context, pool gorm.ConnPool, query string, args ...any) *capturedRows {
+	rows, err := pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return &capturedRows{err: err}
+	}
+	res := &capturedRows{}
+	if res.cols, err = rows.Columns(); err != nil {
+		rows.Close()
+		return &capturedRows{err: err}
+	}
+	if res.types, err = rows.ColumnTypes(); err != nil {
+		rows.Close()
+		return &capturedRows{err: err}
+	}
+	size := 0
+	for rows.Next() {
+		vals, err := scanAny(rows, len(res.cols))
+		if err != nil {
+			rows.Close()
+			return &capturedRows{err: err}
+		}
+		res.rows = append(res.rows, vals)
+		for _, v := range vals {
+			size += valueSize(v)
+		}
+		if len(res.rows) > d.Config.ShadowRead.MaxRows || size > d.Config.ShadowRead.MaxBytes {
+			res.rest = rows
+			return res
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return &capturedRows{err: err}
+	}
+	return res
+}
+
+// scanAny 扫描一行，扫描到 *any 时 database/sql 会拷贝 []byte，不会复用驱动缓冲区
+func scanAny(rows *sql.Rows, n int) ([]any, error) {
+	vals := make([]any, n)
+	ptrs := make([]any, n)
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// valueSize 估算一个列值占用的字节数
+func valueSize(v any) int {
+	switch val := v.(type) {
+	case []byte:
+		return len(val)
+	case string:
+		return len(val)
+	default:
+		return 8
+	}
+}
+
+// shadowRows 转换成比对用的列名 -> 值
+func (c *capturedRows) shadowRows() []shadowRow {
+	res := make([]shadowRow, 0, len(c.rows))
+	for _, vals := range c.rows {
+		row := make(shadowRow, len(c.cols))
+		for i, col := range c.cols {
+			row[col] = normalizeValue(vals[i])
+		}
+		res = append(res, row)
+	}
+	return res
+}
+
+// sqlRows 回放成 *sql.Rows，查询出错时返回原错误
+func (c *capturedRows) sqlRows(ctx context.Context) (*sql.Rows, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	rows, err := replayDB().QueryContext(ctx, "", c)
+	if err != nil && c.rest != nil {
+		c.rest.Close()
+	}
+	return rows, err
+}
+
+// sqlRow 回放成 *sql.Row，查询出错时错误在 Scan 时返回
+func (c *capturedRows) sqlRow(ctx context.Context) *sql.Row {
+	return replayDB().QueryRowContext(ctx, "", c)
+}
+
+// replayDB 回放内存结果集用的连接池，查询参数就是 *capturedRows
+var replayDB = sync.OnceValue(func() *sql.DB {
+	return sql.OpenDB(replayConnector{})
+})
+
+var errReplayUnsupported = errors.New("内存结果集只支持查询回放")
+
+type replayConnector struct{}
+
+func (replayConnector) Connect(context.Context) (driver.Conn, error) { return replayConn{}, nil }
+func (replayConnector) Driver() driver.Driver                        { return replayDriver{} }
+
+type replayDriver struct{}
+
+func (replayDriver) Open(string) (driver.Conn, error) { return replayConn{}, nil }
+
+type replayConn struct{}
+
+func (replayConn) Prepare(string) (driver.Stmt, error) { return nil, errReplayUnsupported }
+func (replayConn) Close() error                        { return nil }
+func (replayConn) Begin() (driver.Tx, error)           { return nil, errReplayUnsupported }
+
+// CheckNamedValue 参数原样传给 QueryContext，不做驱动值转换
+func (replayConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (replayConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 1 {
+		return nil, errReplayUnsupported
+	}
+	captured, ok := args[0].Value.(*capturedRows)
+	if !ok {
+		return nil, errReplayUnsupported
+	}
+	if captured.err != nil {
+		return nil, captured.err
+	}
+	return &replayRows{captured: captured}, nil
+}
+
+// replayRows 逐行回放，列类型沿用主库的，gorm 按列类型扫描到 map 时与直接查询一致
+type replayRows struct {
+	captured *capturedRows
+	next     int
+}
+
+func (r *replayRows) Columns() []string { return r.captured.cols }
+
+func (r *replayRows) Close() error {
+	if r.captured.rest != nil {
+		return r.captured.rest.Close()
+	}
+	return nil
+}
+
+// Next 先回放内存中的行，超过上限时再继续读主库未读完的结果集
+func (r *replayRows) Next(dest []driver.Value) error {
+	vals, err := r.nextRow()
+	if err != nil {
+		return err
+	}
+	for i, v := range vals {
+		dest[i] = v
+	}
+	return nil
+}
+
+func (r *replayRows) nextRow() ([]any, error) {
+	if r.next < len(r.captured.rows) {
+		r.next++
+		return r.captured.rows[r.next-1], nil
+	}
+	rest := r.captured.rest
+	if rest == nil {
+		return nil, io.EOF
+	}
+	if !rest.Next() {
+		if err := rest.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return scanAny(rest, len(r.captured.cols))
+}
+
+func (r *replayRows) ColumnTypeScanType(i int) reflect.Type {
+	return r.captured.types[i].ScanType()
+}
+
+func (r *replayRows) ColumnTypeDatabaseTypeName(i int) string {
+	return r.captured.types[i].DatabaseTypeName()
+}
+
+func (r *replayRows) ColumnTypeNullable(i int) (bool, bool) {
+	return r.captured.types[i].Nullable()
+}
+
+func (r *replayRows) ColumnTypeLength(i int) (int64, bool) {
+	return r.captured.types[i].Length()
+}
+
+func (r *replayRows) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
+	return r.captured.types[i].DecimalSize()
+}
+
+// normalizeValue 统一驱动返回的值，[]byte 复用了驱动缓冲区需拷贝成 string
+func normalizeValue(v any) any {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.UTC()
+	default:
+		return v
+	}
+}
+
+// compareShadowRows 逐行比对，有 id 列时按 id 对齐，否则按行序
+func compareShadowRows(base, shadow []shadowRow, idColumn, direction string) []events.InconsistentEvent {
+	if idColumn == "" {
+		idColumn = "id"
+	}
+	var evts []events.InconsistentEvent
+	if hasColumn(base, shadow, idColumn) {
+		shadowMap := make(map[string]shadowRow, len(shadow))
+		for _, row := range shadow {
+			shadowMap[fmt.Sprint(row[idColumn])] = row
+		}
+		for _, row := range base {
+			key := fmt.Sprint(row[idColumn])
+			dst, ok := shadowMap[key]
+			if !ok {
+				evts = append(evts, newShadowEvent(row[idColumn], direction, events.InconsistentEventTypeTargetMissing, nil))
+				continue
+			}
+			delete(shadowMap, key)
+			if diffs := diffRow(row, dst); len(diffs) > 0 {
+				evts = append(evts, newShadowEvent(row[idColumn], direction, events.InconsistentEventTypeNEQ, diffs))
+			}
+		}
+		for _, row := range shadow {
+			if _, ok := shadowMap[fmt.Sprint(row[idColumn])]; ok {
+				evts = append(evts, newShadowEvent(row[idColumn], direction, events.InconsistentEventTypeBaseMissing, nil))
+			}
+		}
+		return evts
+	}
+
+	for i := 0; i < len(base) || i < len(shadow); i++ {
+		switch {
+		case i >= len(shadow):
+			evts = append(evts, newShadowEvent(nil, direction, events.InconsistentEventTypeTargetMissing, nil))
+		case i >= len(base):
+			evts = append(evts, newShadowEvent(nil, direction, events.InconsistentEventTypeBaseMissing, nil))
+		default:
+			if diffs := diffRow(base[i], shadow[i]); len(diffs) > 0 {
+				evts = append(evts, newShadowEvent(nil, direction, events.InconsistentEventTypeNEQ, diffs))
+			}
+		}
+	}
+	return evts
+}
+
+// hasColumn 两边结果集都含 col 列
+func hasColumn(base, shadow []shadowRow, col string) bool {
+	for _, rows := range [][]shadowRow{base, shadow} {
+		if len(rows) == 0 {
+			continue
+		}
+		if _, ok := rows[0][col]; !ok {
+			return false
+		}
+	}
+	return len(base) > 0 || len(shadow) > 0
+}
+
+// diffRow 比对一行的各列
+func diffRow(src, dst shadowRow) []myMovex.FieldDiff {
+	var diffs []myMovex.FieldDiff
+	for col, s := range src {
+		d, ok := dst[col]
+		if !ok || !reflect.DeepEqual(s, d) {
+			diffs = append(diffs, myMovex.NewFieldDiff(col, s, d))
+		}
+	}
+	return diffs
+}
+
+func newShadowEvent(id any, direction, typ string, diffs []myMovex.FieldDiff) events.InconsistentEvent {
+	return events.InconsistentEvent{ID: toInt64(id), Direction: direction, Type: typ, Diffs: diffs}
+}
+
+// toInt64 id 列转 int64，无法转换时为 0
+func toInt64(v any) int64 {
+	switch val := v.(type) {
+	case int64:
+		return val
+	case int:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case string:
+		id, _ := strconv.ParseInt(val, 10, 64)
+		return id
+	default:
+		return 0
+	}
+}
+
+// ProducerMismatchHandler 把影子读发现的不一致事件发到消息队列，由 consumerx 消费修复
+//   - 无法确定 id 的事件（结果集不含 id 列）只记日志不上报
+func ProducerMismatchHandler(producer mqX.Producer, topic string, l logx.Loggerx) func(ctx context.Context, m ShadowMismatch) {
+	return func(ctx context.Context, m ShadowMismatch) {
+		for _, evt := range m.Events {
+			if evt.ID == 0 {
+				continue
+			}
+			val, err := json.Marshal(evt)
+			if err != nil {
+				l.Error("影子读不一致事件序列化失败", logx.Error(err))
+				continue
+			}
+			err = producer.Send(ctx, &mqX.Message{Topic: topic, Key: []byte(strconv.FormatInt(evt.ID, 10)), Value: val})
+			if err != nil {
+				l.Error("影子读不一致事件上报失败", logx.Error(err), logx.Int64("id", evt.ID))
+			}
+		}
+	}
+}
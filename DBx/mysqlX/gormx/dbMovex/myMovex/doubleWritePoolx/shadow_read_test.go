@@ -0,0 +1,183 @@
+package doubleWritePoolx
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// noopPool 仅用于判断连接池非 nil
+type noopPool struct {
+	gorm.ConnPool
+}
+
+// TestCompareShadowRows 测试按 id 对齐比对
+func TestCompareShadowRows(t *testing.T) {
+	base := []shadowRow{
+		{"id": int64(1), "name": "a"},
+		{"id": int64(2), "name": "b"},
+		{"id": int64(3), "name": "c"},
+	}
+	shadow := []shadowRow{
+		{"id": int64(3), "name": "c"},
+		{"id": int64(2), "name": "b_old"},
+		{"id": int64(4), "name": "d"},
+	}
+	evts := compareShadowRows(base, shadow, "", "SRC")
+	require.Len(t, evts, 3)
+	assert.Equal(t, events.InconsistentEvent{ID: 1, Direction: "SRC", Type: events.InconsistentEventTypeTargetMissing}, evts[0])
+	assert.Equal(t, int64(2), evts[1].ID)
+	assert.Equal(t, events.InconsistentEventTypeNEQ, evts[1].Type)
+	require.Len(t, evts[1].Diffs, 1)
+	assert.Equal(t, "name", evts[1].Diffs[0].Field)
+	assert.Equal(t, events.InconsistentEvent{ID: 4, Direction: "SRC", Type: events.InconsistentEventTypeBaseMissing}, evts[2])
+
+	assert.Empty(t, compareShadowRows(base, base, "id", "DST"))
+}
+
+// TestCompareShadowRowsByOrder 测试结果集不含 id 列时按行序比对
+func TestCompareShadowRowsByOrder(t *testing.T) {
+	base := []shadowRow{{"cnt": int64(10)}, {"cnt": int64(20)}}
+	shadow := []shadowRow{{"cnt": int64(10)}}
+	evts := compareShadowRows(base, shadow, "", "DST")
+	require.Len(t, evts, 1)
+	assert.Equal(t, events.InconsistentEventTypeTargetMissing, evts[0].Type)
+
+	evts = compareShadowRows(base, []shadowRow{{"cnt": int64(10)}, {"cnt": int64(21)}}, "", "DST")
+	require.Len(t, evts, 1)
+	assert.Equal(t, events.InconsistentEventTypeNEQ, evts[0].Type)
+	assert.Equal(t, "DST", evts[0].Direction)
+}
+
+// TestShadowEnabled 测试只在双写阶段按采样率开启
+func TestShadowEnabled(t *testing.T) {
+	d := &DoubleWritePool{Src: &noopPool{}, Dst: &noopPool{}}
+	assert.False(t, d.shadowEnabled(PatternSrcFirst))
+
+	d.Config.ShadowRead.SampleRate = 1
+	assert.True(t, d.shadowEnabled(PatternSrcFirst))
+	assert.True(t, d.shadowEnabled(PatternDstFirst))
+	assert.False(t, d.shadowEnabled(PatternSrcOnly))
+	assert.False(t, d.shadowEnabled(PatternDstOnly))
+}
+
+func newMockGorm(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	gdb, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	return gdb, mock
+}
+
+// TestShadowQueryCapturesPrimary 测试主库只查一次，调用方拿到的结果与比对用的结果是同一份
+func TestShadowQueryCapturesPrimary(t *testing.T) {
+	src, srcMock := newMockGorm(t)
+	dst, dstMock := newMockGorm(t)
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	d := NewDoubleWritePool(src, dst, l, DoubleWriteConfig{RetryAttempts: 1, ShadowRead: ShadowReadConfig{SampleRate: 1}})
+	d.Pattern.Store(PatternSrcFirst)
+
+	srcMock.ExpectQuery("SELECT id, name FROM users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(int64(1), "a").AddRow(int64(2), "b"))
+	srcMock.ExpectQuery("SELECT name FROM users WHERE id").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("a"))
+	srcMock.ExpectQuery("SELECT name FROM users WHERE id").WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	// 影子读在后台并发执行，到达顺序不固定
+	dstMock.MatchExpectationsInOrder(false)
+	dstMock.ExpectQuery("SELECT id, name FROM users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(int64(1), "a").AddRow(int64(2), "c"))
+	dstMock.ExpectQuery("SELECT name FROM users WHERE id").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("a"))
+	dstMock.ExpectQuery("SELECT name FROM users WHERE id").WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	rows, err := d.QueryContext(context.Background(), "SELECT id, name FROM users")
+	require.NoError(t, err)
+	var names []string
+	for rows.Next() {
+		var id int64
+		var name string
+		require.NoError(t, rows.Scan(&id, &name))
+		names = append(names, name)
+	}
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	var name string
+	require.NoError(t, d.QueryRowContext(context.Background(), "SELECT name FROM users WHERE id = ?", 1).Scan(&name))
+	assert.Equal(t, "a", name)
+	err = d.QueryRowContext(context.Background(), "SELECT name FROM users WHERE id = ?", 3).Scan(&name)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Close 会取消进行中的影子读，先等比对完成
+	d.shadowWg.Wait()
+	require.NoError(t, d.Close())
+	require.NoError(t, srcMock.ExpectationsWereMet())
+	require.NoError(t, dstMock.ExpectationsWereMet())
+	m := d.GetMetrics()
+	assert.Equal(t, int64(3), m.ShadowReads)
+	assert.Equal(t, int64(1), m.ShadowMismatches)
+	assert.Equal(t, int64(0), m.ShadowFailures)
+}
+
+// TestShadowQueryOversize 测试结果集超过上限时放弃比对，调用方仍拿到完整的主库结果
+func TestShadowQueryOversize(t *testing.T) {
+	src, srcMock := newMockGorm(t)
+	dst, dstMock := newMockGorm(t)
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	d := NewDoubleWritePool(src, dst, l, DoubleWriteConfig{RetryAttempts: 1,
+		ShadowRead: ShadowReadConfig{SampleRate: 1, MaxRows: 2, MaxBytes: 10}})
+	d.Pattern.Store(PatternSrcFirst)
+
+	// 超过 MaxRows
+	srcMock.ExpectQuery("SELECT id, name FROM users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(int64(1), "a").AddRow(int64(2), "b").AddRow(int64(3), "c").AddRow(int64(4), "d")).
+		RowsWillBeClosed()
+	// 超过 MaxBytes
+	srcMock.ExpectQuery("SELECT name FROM users WHERE id").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("aaaaaaaaaaaa").AddRow("b")).
+		RowsWillBeClosed()
+
+	rows, err := d.QueryContext(context.Background(), "SELECT id, name FROM users")
+	require.NoError(t, err)
+	var names []string
+	for rows.Next() {
+		var id int64
+		var name string
+		require.NoError(t, rows.Scan(&id, &name))
+		names = append(names, name)
+	}
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names)
+
+	var name string
+	require.NoError(t, d.QueryRowContext(context.Background(), "SELECT name FROM users WHERE id = ?", 1).Scan(&name))
+	assert.Equal(t, "aaaaaaaaaaaa", name)
+
+	// 放弃比对，不查影子库
+	d.shadowWg.Wait()
+	require.NoError(t, d.Close())
+	require.NoError(t, srcMock.ExpectationsWereMet())
+	require.NoError(t, dstMock.ExpectationsWereMet())
+	m := d.GetMetrics()
+	assert.Equal(t, int64(0), m.ShadowReads)
+	assert.Equal(t, int64(2), m.ShadowOversize)
+}
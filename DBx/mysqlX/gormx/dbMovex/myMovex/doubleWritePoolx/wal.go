@@ -0,0 +1,207 @@
+package doubleWritePoolx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	walFileName    = "compensate.wal"
+	walOffsetName  = "compensate.offset"
+	walOffsetTmp   = "compensate.offset.tmp"
+	walMaxLineSize = 16 << 20
+)
+
+var errWalEntryTooLarge = errors.New("补偿记录超过 wal 单行上限")
+
+// WalQueue 基于本地文件的补偿队列
+//   - compensate.wal 追加写，一行一条 json 记录，每次 Push 都 fsync
+//   - compensate.offset 记录已重放到的字节位置，重启后从该位置继续
+//   - 积压清空后截断 wal 文件，避免无限增长
+//   - 单条记录编码后不能超过 16MB，超过时 Push 返回 error
+type WalQueue struct {
+	mu      sync.Mutex
+	dir     string
+	wal     *os.File
+	offset  int64 // 已重放到的字节位置
+	size    int64 // wal 文件大小
+	backlog int64
+
+	head     *CompensateEntry // Peek 缓存的最早一条记录
+	headSize int64            // 最早一条记录占用的字节数
+}
+
+// NewWalQueue 打开 dir 下的补偿 wal，不存在时创建
+func NewWalQueue(dir string) (*WalQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	q := &WalQueue{dir: dir, wal: wal}
+	if err = q.load(); err != nil {
+		_ = wal.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// load 读取 offset 并统计积压
+func (q *WalQueue) load() error {
+	stat, err := q.wal.Stat()
+	if err != nil {
+		return err
+	}
+	q.size = stat.Size()
+	raw, err := os.ReadFile(filepath.Join(q.dir, walOffsetName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		q.offset, err = strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+		if err != nil {
+			return fmt.Errorf("补偿 wal offset 文件损坏: %w", err)
+		}
+	}
+	if q.offset > q.size && q.size == 0 {
+		// 积压清空时先截断 wal 再写 offset，两步之间宕机会留下旧 offset
+		q.offset = 0
+	}
+	if q.offset > q.size {
+		return fmt.Errorf("补偿 wal offset %d 超过文件大小 %d", q.offset, q.size)
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(q.wal, q.offset, q.size-q.offset))
+	var pos int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				// 最后一行未写完整（写入过程中宕机），丢弃这部分
+				q.size = q.offset + pos
+				return q.wal.Truncate(q.size)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pos += int64(len(line))
+		q.backlog++
+	}
+}
+
+func (q *WalQueue) Push(ctx context.Context, entry CompensateEntry) error {
+	val, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	val = append(val, '\n')
+	if len(val) > walMaxLineSize {
+		// Peek 一次最多读 walMaxLineSize，超长的记录写进去就再也读不出来，会卡住后面的重放
+		return fmt.Errorf("%w: %d 字节，上限 %d", errWalEntryTooLarge, len(val), walMaxLineSize)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err = q.wal.WriteAt(val, q.size); err != nil {
+		return err
+	}
+	if err = q.wal.Sync(); err != nil {
+		return err
+	}
+	q.size += int64(len(val))
+	q.backlog++
+	return nil
+}
+
+func (q *WalQueue) Backlog() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.backlog
+}
+
+func (q *WalQueue) Peek(ctx context.Context) (CompensateEntry, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.head != nil {
+		return *q.head, true, nil
+	}
+	if q.offset >= q.size {
+		return CompensateEntry{}, false, nil
+	}
+	reader := bufio.NewReader(io.NewSectionReader(q.wal, q.offset, min(q.size-q.offset, walMaxLineSize)))
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return CompensateEntry{}, false, fmt.Errorf("读取补偿 wal 失败: %w", err)
+	}
+	var entry CompensateEntry
+	if err = json.Unmarshal(line, &entry); err != nil {
+		return CompensateEntry{}, false, fmt.Errorf("补偿 wal 记录损坏，offset %d: %w", q.offset, err)
+	}
+	q.head, q.headSize = &entry, int64(len(line))
+	return entry, true, nil
+}
+
+func (q *WalQueue) Ack(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.head == nil {
+		return errors.New("补偿 wal 没有待确认的记录")
+	}
+	offset := q.offset + q.headSize
+	if offset == q.size {
+		// 积压清空，截断 wal 从头开始，offset 写失败时重启由 load 修正
+		if err := q.wal.Truncate(0); err != nil {
+			return err
+		}
+		q.offset, q.size = 0, 0
+		q.head, q.headSize = nil, 0
+		q.backlog--
+		return q.saveOffset(0)
+	}
+	if err := q.saveOffset(offset); err != nil {
+		return err
+	}
+	q.offset = offset
+	q.head, q.headSize = nil, 0
+	q.backlog--
+	return nil
+}
+
+// saveOffset 先写临时文件再 rename，保证 offset 文件不会写一半
+func (q *WalQueue) saveOffset(offset int64) error {
+	tmp := filepath.Join(q.dir, walOffsetTmp)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(strconv.FormatInt(offset, 10)); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, walOffsetName))
+}
+
+// Close 关闭 wal 文件
+func (q *WalQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.wal.Close()
+}
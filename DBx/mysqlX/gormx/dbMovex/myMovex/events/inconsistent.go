@@ -1,5 +1,7 @@
 package events
 
+import "github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex"
+
 type InconsistentEvent struct {
 	ID int64
 	// 用什么来修，取值为 SRC，意味着，以源表为准，取值为 DST，以目标表为准
@@ -8,6 +10,9 @@ type InconsistentEvent struct {
 	// 因为他要去 DEBUG
 	// 这个是可选的
 	Type string
+	// 数据不一致（neq）时各列的差异，修数据的人据此知道是哪一列漂移了
+	// 这个也是可选的
+	Diffs []myMovex.FieldDiff `json:",omitempty"`
 }
 
 const (
@@ -3,13 +3,16 @@ package consumerx
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex"
 	events2 "github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
 	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/hgg-6/pkgTool/v2/channelx/mqX/kafkaX/saramaX/consumerX"
 	"github.com/hgg-6/pkgTool/v2/logx"
-	"github.com/IBM/sarama"
 	"gorm.io/gorm"
 	"log"
+	"time"
 )
 
 /*
@@ -22,14 +25,27 @@ type ConsumerConf struct {
 	Addr       []string
 	GroupId    string
 	SaramaConf *sarama.Config
+
+	// Batch 批量修复，一批消息只查一次基准表，目标表在同一事务内修复
+	Batch bool
+	// BatchSize 批量修复每批最大消息数，<=0 时使用 consumerX 默认值
+	BatchSize int
+	// BatchTimeout 批量修复凑批的最长等待时间，<=0 时使用 consumerX 默认值
+	BatchTimeout time.Duration
+	// DryRun 演练模式，只记录将要执行的修复动作，不写目标表，需同时配置 DbConf.AuditDb；
+	// offset 照常提交，人工确认后用 OverrideFixer.ApplyDryRun 按审计表中的演练记录执行修复
+	DryRun bool
 }
 
 type DbConf struct {
 	SrcDb *gorm.DB
 	DstDb *gorm.DB
+	// AuditDb 可选，修复审计表所在库，不为 nil 时每次修复前把字段级差异写入审计表
+	AuditDb *gorm.DB
 }
 
-type Consumer[T events2.InconsistentEvent] struct {
+// Consumer 消费不一致数据事件并修复，T 为需要修复的表对应的实体
+type Consumer[T myMovex.Entity] struct {
 	ConsumerConfig ConsumerConf
 	DbConfig       DbConf
 	//Fn             func(msg *sarama.ConsumerMessage, event events.InconsistentEvent) error
@@ -38,7 +54,7 @@ type Consumer[T events2.InconsistentEvent] struct {
 	Consumer mqX.Consumer
 }
 
-func NewConsumer[T events2.InconsistentEvent](consumerConf ConsumerConf, dbConfig DbConf, l logx.Loggerx) *Consumer[T] {
+func NewConsumer[T myMovex.Entity](consumerConf ConsumerConf, dbConfig DbConf, l logx.Loggerx) *Consumer[T] {
 	c := &Consumer[T]{
 		ConsumerConfig: consumerConf,
 		DbConfig:       dbConfig,
@@ -51,34 +67,45 @@ func NewConsumer[T events2.InconsistentEvent](consumerConf ConsumerConf, dbConfi
 		c.L.Error("new consumer group error", logx.Error(err))
 	}
 	c.Consumer = consumerX.NewKafkaConsumer(consumerCg, &consumerX.ConsumerConfig{
-		BatchSize:    0,
-		BatchTimeout: 0,
+		BatchSize:    c.ConsumerConfig.BatchSize,
+		BatchTimeout: c.ConsumerConfig.BatchTimeout,
 	})
 	return c
 }
 
 func (c *Consumer[T]) InitConsumer(ctx context.Context, topic string) error {
+	if c.ConsumerConfig.DryRun && c.DbConfig.AuditDb == nil {
+		// 演练消费后 offset 照常提交，之后只能按审计表中的演练记录执行修复
+		return errors.New("演练模式需要配置 AuditDb")
+	}
+	if c.DbConfig.AuditDb != nil {
+		if err := InitAuditTable(c.DbConfig.AuditDb); err != nil {
+			return err
+		}
+	}
 	//return c.ConsumerIn.ReceiveMessage(ctx, []messageQueuex.Tp{{Topic: topic}})
-	return c.Consumer.Subscribe(ctx, []string{topic}, newFn(&c.DbConfig, c.L))
+	return c.Consumer.Subscribe(ctx, []string{topic}, newFn[T](&c.DbConfig, c.L, c.ConsumerConfig.Batch, c.ConsumerConfig.DryRun))
 }
 
-type fn struct {
-	db *DbConf
-	l  logx.Loggerx
+type fn[T myMovex.Entity] struct {
+	db     *DbConf
+	l      logx.Loggerx
+	batch  bool
+	dryRun bool
 }
 
-func newFn(db *DbConf, l logx.Loggerx) *fn {
-	return &fn{db: db, l: l}
+func newFn[T myMovex.Entity](db *DbConf, l logx.Loggerx, batch, dryRun bool) *fn[T] {
+	return &fn[T]{db: db, l: l, batch: batch, dryRun: dryRun}
 }
 
-func (f *fn) IsBatch() bool {
-	return false
+func (f *fn[T]) IsBatch() bool {
+	return f.batch
 }
 
-func (f *fn) Handle(ctx context.Context, msg *mqX.Message) error {
+func (f *fn[T]) Handle(ctx context.Context, msg *mqX.Message) error {
 	log.Println("receive message")
 	f.l.Info("receive message", logx.Any("msg: ", msg))
-	ov, err := NewOverrideFixer[events2.TestUser](f.db.SrcDb, f.db.DstDb)
+	ov, err := NewOverrideFixer[T](f.db.SrcDb, f.db.DstDb)
 	if err != nil {
 		return err
 	}
@@ -88,7 +115,7 @@ func (f *fn) Handle(ctx context.Context, msg *mqX.Message) error {
 		return err
 	}
 	// 修复失败时返回 error，让上游不 ACK 以便重试。
-	if err := ov.Fix(context.Background(), event.ID); err != nil {
+	if err := ov.Audit(f.l, f.db.AuditDb).DryRun(f.dryRun).FixEvent(context.Background(), event); err != nil {
 		f.l.Error("修复不一致数据失败", logx.Int64("id", event.ID), logx.Error(err))
 		return err
 	}
@@ -96,6 +123,27 @@ func (f *fn) Handle(ctx context.Context, msg *mqX.Message) error {
 	return nil
 }
 
-func (f *fn) HandleBatch(ctx context.Context, msgs []*mqX.Message) (success bool, err error) {
+func (f *fn[T]) HandleBatch(ctx context.Context, msgs []*mqX.Message) (success bool, err error) {
+	ov, err := NewOverrideFixer[T](f.db.SrcDb, f.db.DstDb)
+	if err != nil {
+		return false, err
+	}
+	evts := make([]events2.InconsistentEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		var event events2.InconsistentEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			// 无法解析的消息重试也没用，记录后跳过
+			f.l.Error("解析不一致数据事件失败", logx.String("topic", msg.Topic), logx.Error(err))
+			continue
+		}
+		evts = append(evts, event)
+	}
+	actions, err := ov.Audit(f.l, f.db.AuditDb).DryRun(f.dryRun).FixEvents(ctx, evts)
+	if err != nil {
+		// 修复失败时不提交本批 offset，让上游重试
+		f.l.Error("批量修复不一致数据失败", logx.Int("count", len(evts)), logx.Error(err))
+		return false, err
+	}
+	f.l.Info("批量消费不一致数据成功", logx.Int("count", len(actions)), logx.Any("dry_run", f.dryRun))
 	return true, nil
 }
@@ -2,17 +2,22 @@ package consumerx
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex"
 	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/hgg-6/pkgTool/v2/logx"
 	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
 	"github.com/IBM/sarama"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -76,7 +81,7 @@ func TestNewConsumerGroupHandler1(t *testing.T) {
 
 	cfg := sarama.NewConfig()
 	// 创建消费者配置
-	cm := NewConsumer(ConsumerConf{
+	cm := NewConsumer[events.TestUser](ConsumerConf{
 		Addr:       addr,
 		GroupId:    "test_group",
 		SaramaConf: cfg,
@@ -124,3 +129,48 @@ func isConnectionError(err error) bool {
 func containsIgnoreCase(s, substr string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
+
+// testOrder 另一张表的实体，确认消费者按 T 修复而不是固定的 TestUser
+type testOrder struct {
+	Id    int64 `gorm:"primaryKey"`
+	Price int64
+}
+
+func (o testOrder) ID() int64 { return o.Id }
+
+func (o testOrder) CompareTo(dst myMovex.Entity) bool {
+	val, ok := dst.(testOrder)
+	return ok && o == val
+}
+
+func (o testOrder) Types() string { return "testOrder" }
+
+// TestFnHandleBatchEntity 测试批量修复按消费者的实体类型查询和修复对应的表
+func TestFnHandleBatchEntity(t *testing.T) {
+	base, baseMock := newMockDB(t)
+	target, targetMock := newMockDB(t)
+	orderColumns := []string{"id", "price"}
+	baseMock.ExpectQuery("SELECT \\* FROM `test_orders` ORDER BY id").WillReturnRows(sqlmock.NewRows(orderColumns))
+	baseMock.ExpectQuery("SELECT \\* FROM `test_orders` WHERE id IN").WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 100))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("INSERT INTO `test_orders`").WillReturnResult(sqlmock.NewResult(1, 1))
+	targetMock.ExpectExec("DELETE FROM `test_orders` WHERE id IN").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	targetMock.ExpectCommit()
+
+	msgs := make([]*mqX.Message, 0, 2)
+	for _, evt := range []events.InconsistentEvent{
+		{ID: 1, Direction: "SRC", Type: events.InconsistentEventTypeTargetMissing},
+		{ID: 2, Direction: "SRC", Type: events.InconsistentEventTypeBaseMissing},
+	} {
+		val, err := json.Marshal(evt)
+		require.NoError(t, err)
+		msgs = append(msgs, &mqX.Message{Topic: "dbMove", Value: val})
+	}
+	ok, err := newFn[testOrder](&DbConf{SrcDb: base, DstDb: target}, InitLog(), true, false).
+		HandleBatch(context.Background(), msgs)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, baseMock.ExpectationsWereMet())
+	require.NoError(t, targetMock.ExpectationsWereMet())
+}
@@ -2,8 +2,13 @@ package consumerx
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/logx"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -13,6 +18,48 @@ type OverrideFixer[T myMovex.Entity] struct {
 	target *gorm.DB
 
 	columns []string
+
+	l       logx.Loggerx // 可选，记录修复前的字段级差异
+	auditDb *gorm.DB     // 可选，修复审计表所在库
+	dryRun  bool         // 演练模式，只记录将要做的修复，不写目标表
+}
+
+const (
+	FixActionUpsert = "upsert" // 基准表存在，覆盖写目标表
+	FixActionDelete = "delete" // 基准表不存在，删除目标表数据
+	FixActionNone   = "none"   // 演练时发现目标表已一致，无需修复
+)
+
+// FixAction 一条数据的修复动作
+type FixAction struct {
+	ID        int64               `json:"id"`
+	Direction string              `json:"direction"`
+	Type      string              `json:"type"`
+	Action    string              `json:"action"`
+	Diffs     []myMovex.FieldDiff `json:"diffs,omitempty"`
+}
+
+// FixAudit 修复审计记录，保存每次修复时的不一致类型和字段级差异
+type FixAudit struct {
+	Id        int64  `gorm:"primaryKey,autoIncrement"`
+	BizTable  string `gorm:"type:varchar(128);index:idx_biz"` // 修复的表，取自 Entity.Types()
+	BizId     int64  `gorm:"index:idx_biz"`                   // 修复的数据 id
+	Direction string `gorm:"type:varchar(16)"`
+	Type      string `gorm:"type:varchar(32)"`
+	Action    string `gorm:"type:varchar(16)"` // 修复动作 upsert/delete/none
+	DryRun    bool   `gorm:"index"`            // 演练记录，未真正修复，供人工确认后再执行
+	Diffs     string `gorm:"type:text"`
+	AppliedAt int64  // 演练记录被 ApplyDryRun 执行的时间，0 为未执行
+	Ctime     int64
+}
+
+func (FixAudit) TableName() string {
+	return "db_move_fix_audits"
+}
+
+// InitAuditTable 创建修复审计表
+func InitAuditTable(db *gorm.DB) error {
+	return db.AutoMigrate(&FixAudit{})
 }
 
 func NewOverrideFixer[T myMovex.Entity](base *gorm.DB, target *gorm.DB) (*OverrideFixer[T], error) {
@@ -27,6 +74,209 @@ func NewOverrideFixer[T myMovex.Entity](base *gorm.DB, target *gorm.DB) (*Overri
 	}
 	return &OverrideFixer[T]{base: base, target: target, columns: columns}, nil
 }
+
+// Audit 设置修复前差异的记录方式，l 记日志，auditDb 写审计表【需先 InitAuditTable】，均可为 nil
+func (f *OverrideFixer[T]) Audit(l logx.Loggerx, auditDb *gorm.DB) *OverrideFixer[T] {
+	f.l = l
+	f.auditDb = auditDb
+	return f
+}
+
+// DryRun 设置演练模式，开启后只记录将要执行的修复动作【日志/审计表】，不写目标表，便于人工确认后再修复
+func (f *OverrideFixer[T]) DryRun(dryRun bool) *OverrideFixer[T] {
+	f.dryRun = dryRun
+	return f
+}
+
+// FixEvent 按不一致事件修复，修复前先记录事件携带的字段级差异
+func (f *OverrideFixer[T]) FixEvent(ctx context.Context, evt events.InconsistentEvent) error {
+	_, err := f.FixEvents(ctx, []events.InconsistentEvent{evt})
+	return err
+}
+
+// FixEvents 批量修复不一致事件
+//   - 同一 id 只修复一次，以最后一条事件为准
+//   - 基准表一次 SELECT 取回整批数据，目标表的 upsert 和 delete 在同一事务内完成
+//   - 演练模式下额外查询目标表计算实际差异，只记录修复动作，不写目标表
+func (f *OverrideFixer[T]) FixEvents(ctx context.Context, evts []events.InconsistentEvent) ([]FixAction, error) {
+	ids, latest := dedupeEvents(evts)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var srcs []T
+	err := f.base.WithContext(ctx).Where("id IN ?", ids).Find(&srcs).Error
+	if err != nil {
+		return nil, err
+	}
+	srcMap := make(map[int64]T, len(srcs))
+	for _, src := range srcs {
+		srcMap[src.ID()] = src
+	}
+
+	actions := make([]FixAction, 0, len(ids))
+	upserts := make([]T, 0, len(srcs))
+	deletes := make([]int64, 0, len(ids)-len(srcs))
+	for _, id := range ids {
+		evt := latest[id]
+		act := FixAction{ID: id, Direction: evt.Direction, Type: evt.Type, Diffs: evt.Diffs}
+		if src, ok := srcMap[id]; ok {
+			act.Action = FixActionUpsert
+			upserts = append(upserts, src)
+		} else {
+			act.Action = FixActionDelete
+			deletes = append(deletes, id)
+		}
+		actions = append(actions, act)
+	}
+
+	if f.dryRun {
+		if err = f.preview(ctx, ids, srcMap, actions); err != nil {
+			return nil, err
+		}
+		return actions, f.record(ctx, actions)
+	}
+
+	// 审计记录在目标表事务提交后再写，回滚的修复不会留下已执行的审计记录；
+	// 审计写入失败时返回错误让上游重试，重复修复是幂等的
+	err = f.target.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(upserts) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.AssignmentColumns(f.columns),
+			}).Create(&upserts).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(deletes) > 0 {
+			return tx.Where("id IN ?", deletes).Delete(new(T)).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return actions, f.record(ctx, actions)
+}
+
+// ApplyDryRun 人工确认演练审计记录后真正修复
+//   - 取本表未执行的演练记录【auditIds 为空时取全部】，按记录的 id 重新回查基准表修复目标表，演练时已一致的记录跳过
+//   - 修复成功后写入正式审计记录，并把演练记录标记为已执行
+//   - 需配置 auditDb 且关闭演练模式
+func (f *OverrideFixer[T]) ApplyDryRun(ctx context.Context, auditIds ...int64) ([]FixAction, error) {
+	if f.auditDb == nil {
+		return nil, errors.New("执行演练记录需要配置审计表")
+	}
+	if f.dryRun {
+		return nil, errors.New("演练模式下不能执行演练记录")
+	}
+	var t T
+	query := f.auditDb.WithContext(ctx).
+		Where("biz_table = ? AND dry_run = ? AND applied_at = ?", t.Types(), true, 0)
+	if len(auditIds) > 0 {
+		query = query.Where("id IN ?", auditIds)
+	}
+	var audits []FixAudit
+	if err := query.Order("id").Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	if len(audits) == 0 {
+		return nil, nil
+	}
+	evts := make([]events.InconsistentEvent, 0, len(audits))
+	ids := make([]int64, 0, len(audits))
+	for _, a := range audits {
+		ids = append(ids, a.Id)
+		if a.Action == FixActionNone {
+			continue
+		}
+		evt := events.InconsistentEvent{ID: a.BizId, Direction: a.Direction, Type: a.Type}
+		_ = json.Unmarshal([]byte(a.Diffs), &evt.Diffs)
+		evts = append(evts, evt)
+	}
+	actions, err := f.FixEvents(ctx, evts)
+	if err != nil {
+		return nil, err
+	}
+	err = f.auditDb.WithContext(ctx).Model(&FixAudit{}).
+		Where("id IN ?", ids).Update("applied_at", time.Now().UnixMilli()).Error
+	return actions, err
+}
+
+// preview 演练模式下查询目标表当前数据，用实际差异替换事件携带的差异
+func (f *OverrideFixer[T]) preview(ctx context.Context, ids []int64, srcMap map[int64]T, actions []FixAction) error {
+	var dsts []T
+	err := f.target.WithContext(ctx).Where("id IN ?", ids).Find(&dsts).Error
+	if err != nil {
+		return err
+	}
+	dstMap := make(map[int64]T, len(dsts))
+	for _, dst := range dsts {
+		dstMap[dst.ID()] = dst
+	}
+	for i := range actions {
+		act := &actions[i]
+		src, srcOk := srcMap[act.ID]
+		dst, dstOk := dstMap[act.ID]
+		switch {
+		case srcOk && dstOk:
+			act.Diffs = myMovex.Diff(src, dst, f.base.NamingStrategy)
+			if len(act.Diffs) == 0 {
+				act.Action = FixActionNone
+			}
+		case !srcOk && !dstOk:
+			act.Action = FixActionNone
+		}
+	}
+	return nil
+}
+
+// record 记录修复动作，写日志和审计表
+func (f *OverrideFixer[T]) record(ctx context.Context, actions []FixAction) error {
+	var t T
+	if f.l != nil {
+		for _, act := range actions {
+			f.l.Info("修复不一致数据", logx.String("table", t.Types()), logx.Int64("id", act.ID),
+				logx.String("direction", act.Direction), logx.String("type", act.Type),
+				logx.String("action", act.Action), logx.Any("dry_run", f.dryRun), logx.Any("diffs", act.Diffs))
+		}
+	}
+	if f.auditDb == nil {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	audits := make([]FixAudit, 0, len(actions))
+	for _, act := range actions {
+		diffs, err := json.Marshal(act.Diffs)
+		if err != nil {
+			return err
+		}
+		audits = append(audits, FixAudit{
+			BizTable:  t.Types(),
+			BizId:     act.ID,
+			Direction: act.Direction,
+			Type:      act.Type,
+			Action:    act.Action,
+			DryRun:    f.dryRun,
+			Diffs:     string(diffs),
+			Ctime:     now,
+		})
+	}
+	return f.auditDb.WithContext(ctx).Create(&audits).Error
+}
+
+// dedupeEvents 按 id 去重，保持首次出现的顺序，事件取最后一条
+func dedupeEvents(evts []events.InconsistentEvent) ([]int64, map[int64]events.InconsistentEvent) {
+	ids := make([]int64, 0, len(evts))
+	latest := make(map[int64]events.InconsistentEvent, len(evts))
+	for _, evt := range evts {
+		if _, ok := latest[evt.ID]; !ok {
+			ids = append(ids, evt.ID)
+		}
+		latest[evt.ID] = evt
+	}
+	return ids, latest
+}
+
 func (f *OverrideFixer[T]) Fix(ctx context.Context, id int64) error {
 	// 最最粗暴的
 	var t T
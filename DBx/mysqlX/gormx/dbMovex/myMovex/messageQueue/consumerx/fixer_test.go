@@ -0,0 +1,181 @@
+package consumerx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestDedupeEvents 测试同一 id 只保留最后一条事件且保持顺序
+func TestDedupeEvents(t *testing.T) {
+	ids, latest := dedupeEvents([]events.InconsistentEvent{
+		{ID: 2, Type: events.InconsistentEventTypeNEQ},
+		{ID: 1, Type: events.InconsistentEventTypeTargetMissing},
+		{ID: 2, Type: events.InconsistentEventTypeBaseMissing},
+	})
+	assert.Equal(t, []int64{2, 1}, ids)
+	assert.Equal(t, events.InconsistentEventTypeBaseMissing, latest[2].Type)
+}
+
+// TestOverrideFixerFixEvents 测试批量修复和演练模式
+func TestOverrideFixerFixEvents(t *testing.T) {
+	srcDb, err := setupTestSrcDB()
+	if err != nil {
+		t.Skipf("跳过测试：无法连接源数据库: %v", err)
+		return
+	}
+	dstDb, err := setupTestDstDB()
+	if err != nil {
+		t.Skipf("跳过测试：无法连接目标数据库: %v", err)
+		return
+	}
+	ids := []int64{90001, 90002, 90003}
+	cleanup := func() {
+		srcDb.Where("id IN ?", ids).Delete(&events.TestUser{})
+		dstDb.Where("id IN ?", ids).Delete(&events.TestUser{})
+	}
+	cleanup()
+	defer cleanup()
+
+	require.NoError(t, srcDb.Create([]events.TestUser{
+		{Id: 90001, Name: "a", Email: "fix_90001@test.com"},
+		{Id: 90002, Name: "b", Email: "fix_90002@test.com"},
+	}).Error)
+	require.NoError(t, dstDb.Create([]events.TestUser{
+		{Id: 90002, Name: "b_old", Email: "fix_90002@test.com"},
+		{Id: 90003, Name: "c", Email: "fix_90003@test.com"},
+	}).Error)
+
+	evts := []events.InconsistentEvent{
+		{ID: 90001, Direction: "SRC", Type: events.InconsistentEventTypeTargetMissing},
+		{ID: 90002, Direction: "SRC", Type: events.InconsistentEventTypeNEQ},
+		{ID: 90003, Direction: "SRC", Type: events.InconsistentEventTypeBaseMissing},
+	}
+	fixer, err := NewOverrideFixer[events.TestUser](srcDb, dstDb)
+	require.NoError(t, err)
+
+	// 演练模式只返回修复动作，不写目标表
+	actions, err := fixer.DryRun(true).FixEvents(context.Background(), evts)
+	require.NoError(t, err)
+	require.Len(t, actions, 3)
+	assert.Equal(t, FixActionUpsert, actions[0].Action)
+	assert.Equal(t, FixActionUpsert, actions[1].Action)
+	assert.NotEmpty(t, actions[1].Diffs)
+	assert.Equal(t, FixActionDelete, actions[2].Action)
+	var cnt int64
+	dstDb.Model(&events.TestUser{}).Where("id IN ?", ids).Count(&cnt)
+	assert.Equal(t, int64(2), cnt)
+
+	_, err = fixer.DryRun(false).FixEvents(context.Background(), evts)
+	require.NoError(t, err)
+	var dsts []events.TestUser
+	require.NoError(t, dstDb.Where("id IN ?", ids).Order("id").Find(&dsts).Error)
+	require.Len(t, dsts, 2)
+	assert.Equal(t, "a", dsts[0].Name)
+	assert.Equal(t, "b", dsts[1].Name)
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	gdb, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	return gdb, mock
+}
+
+var userColumns = []string{"id", "nick_name", "email", "updated_at", "ctime", "utime"}
+
+// newMockFixer 基准库、目标库、审计库都用 sqlmock
+func newMockFixer(t *testing.T) (*OverrideFixer[events.TestUser], sqlmock.Sqlmock, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	base, baseMock := newMockDB(t)
+	target, targetMock := newMockDB(t)
+	audit, auditMock := newMockDB(t)
+	baseMock.ExpectQuery("SELECT \\* FROM `test_users` ORDER BY id").WillReturnRows(sqlmock.NewRows(userColumns))
+	fixer, err := NewOverrideFixer[events.TestUser](base, target)
+	require.NoError(t, err)
+	return fixer.Audit(nil, audit), baseMock, targetMock, auditMock
+}
+
+// TestOverrideFixerAuditAfterCommit 测试目标表事务回滚时不写审计记录，提交后才写
+func TestOverrideFixerAuditAfterCommit(t *testing.T) {
+	fixer, baseMock, targetMock, auditMock := newMockFixer(t)
+	evts := []events.InconsistentEvent{{ID: 1, Direction: "SRC", Type: events.InconsistentEventTypeTargetMissing}}
+
+	// 事务回滚：审计库没有任何预期，写了审计会返回审计库的错误
+	baseMock.ExpectQuery("SELECT \\* FROM `test_users` WHERE id IN").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "a", "a@x.com", 0, 0, 0))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("INSERT INTO `test_users`").WillReturnError(errors.New("deadlock"))
+	targetMock.ExpectRollback()
+	_, err := fixer.FixEvents(context.Background(), evts)
+	assert.EqualError(t, err, "deadlock")
+
+	// 事务提交后写审计
+	baseMock.ExpectQuery("SELECT \\* FROM `test_users` WHERE id IN").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "a", "a@x.com", 0, 0, 0))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("INSERT INTO `test_users`").WillReturnResult(sqlmock.NewResult(1, 1))
+	targetMock.ExpectCommit()
+	auditMock.ExpectBegin()
+	auditMock.ExpectExec("INSERT INTO `db_move_fix_audits`").WillReturnResult(sqlmock.NewResult(1, 1))
+	auditMock.ExpectCommit()
+	actions, err := fixer.FixEvents(context.Background(), evts)
+	require.NoError(t, err)
+	assert.Equal(t, FixActionUpsert, actions[0].Action)
+
+	require.NoError(t, baseMock.ExpectationsWereMet())
+	require.NoError(t, targetMock.ExpectationsWereMet())
+	require.NoError(t, auditMock.ExpectationsWereMet())
+}
+
+// TestOverrideFixerApplyDryRun 测试按演练审计记录执行修复并标记为已执行
+func TestOverrideFixerApplyDryRun(t *testing.T) {
+	fixer, baseMock, targetMock, auditMock := newMockFixer(t)
+
+	_, err := fixer.DryRun(true).ApplyDryRun(context.Background())
+	assert.Error(t, err)
+	fixer.DryRun(false)
+
+	auditMock.ExpectQuery("SELECT \\* FROM `db_move_fix_audits` WHERE").
+		WithArgs("TestUser", true, 0, 10, 11).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "biz_table", "biz_id", "direction", "type", "action", "dry_run", "diffs", "applied_at", "ctime"}).
+			AddRow(10, "TestUser", 1, "SRC", events.InconsistentEventTypeNEQ, FixActionUpsert, true,
+				`[{"field":"nick_name","type":"string","src":"a","dst":"b"}]`, 0, 0).
+			AddRow(11, "TestUser", 2, "SRC", events.InconsistentEventTypeNEQ, FixActionNone, true, "null", 0, 0))
+	// 演练时已一致的 2 不再修复，只修复 1
+	baseMock.ExpectQuery("SELECT \\* FROM `test_users` WHERE id IN").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "a", "a@x.com", 0, 0, 0))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("INSERT INTO `test_users`").WillReturnResult(sqlmock.NewResult(1, 1))
+	targetMock.ExpectCommit()
+	auditMock.ExpectBegin()
+	auditMock.ExpectExec("INSERT INTO `db_move_fix_audits`").WillReturnResult(sqlmock.NewResult(12, 1))
+	auditMock.ExpectCommit()
+	auditMock.ExpectBegin()
+	auditMock.ExpectExec("UPDATE `db_move_fix_audits` SET `applied_at`=\\? WHERE id IN").
+		WithArgs(sqlmock.AnyArg(), 10, 11).WillReturnResult(sqlmock.NewResult(0, 2))
+	auditMock.ExpectCommit()
+
+	actions, err := fixer.ApplyDryRun(context.Background(), 10, 11)
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, int64(1), actions[0].ID)
+	assert.Equal(t, FixActionUpsert, actions[0].Action)
+	require.Len(t, actions[0].Diffs, 1)
+	assert.Equal(t, "nick_name", actions[0].Diffs[0].Field)
+
+	require.NoError(t, baseMock.ExpectationsWereMet())
+	require.NoError(t, targetMock.ExpectationsWereMet())
+	require.NoError(t, auditMock.ExpectationsWereMet())
+}
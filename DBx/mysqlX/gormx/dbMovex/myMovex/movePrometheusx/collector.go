@@ -0,0 +1,178 @@
+package movePrometheusx
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/doubleWritePoolx"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/scheduler"
+	"github.com/hgg-6/pkgTool/v2/observationX/prometheusX"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var patterns = []string{
+	doubleWritePoolx.PatternSrcOnly,
+	doubleWritePoolx.PatternSrcFirst,
+	doubleWritePoolx.PatternDstFirst,
+	doubleWritePoolx.PatternDstOnly,
+}
+
+// SchedulerSource 提供调度器监控指标，*scheduler.Scheduler 实现了该接口
+type SchedulerSource interface {
+	Metrics() scheduler.SchedulerMetrics
+}
+
+// Collector 数据迁移监控指标
+//   - 双写池的读写次数、耗时、第二个库写失败、重试由双写池执行时实时上报
+//   - 当前双写模式、补偿积压、影子读、校验进度和不一致数量在采集时读取
+//   - 同一个 PrometheusStr 只需创建一个 Collector，多张表用 WatchPool/WatchScheduler 的 name 区分
+type Collector struct {
+	ops       *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	secondary *prometheus.CounterVec
+	retries   *prometheus.CounterVec
+
+	pattern           *prometheus.Desc
+	compensateBacklog *prometheus.Desc
+	compensate        *prometheus.Desc
+	shadowReads       *prometheus.Desc
+	validationRuns    *prometheus.Desc
+	checkpoint        *prometheus.Desc
+	discrepancies     *prometheus.Desc
+	inconsistencies   *prometheus.Desc
+
+	mu         sync.RWMutex
+	pools      map[string]*doubleWritePoolx.DoubleWritePool
+	schedulers []SchedulerSource
+}
+
+// NewCollector 创建并注册数据迁移监控指标，buckets 为读写耗时的分桶【秒】，为空时使用 prometheus.DefBuckets
+func NewCollector(px *prometheusX.PrometheusStr, buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	c := &Collector{
+		ops: px.NewCounterVec("db_move_pool_ops_total", "双写池读写次数，result 为 success/error",
+			[]string{"name", "op", "pattern", "result"}),
+		latency: px.NewHistogramVec("db_move_pool_op_duration_seconds", "双写池读写耗时",
+			[]string{"name", "op", "pattern"}, buckets),
+		secondary: px.NewCounterVec("db_move_pool_secondary_failures_total", "双写第二个库写失败次数",
+			[]string{"name", "pattern", "target"}),
+		retries: px.NewCounterVec("db_move_pool_retries_total", "双写写操作重试次数",
+			[]string{"name", "pattern"}),
+
+		pattern: px.NewDesc("db_move_pool_pattern", "当前双写模式，当前模式为 1，其余为 0",
+			[]string{"name", "pattern"}),
+		compensateBacklog: px.NewDesc("db_move_pool_compensate_backlog", "补偿队列积压数",
+			[]string{"name"}),
+		compensate: px.NewDesc("db_move_pool_compensate_total", "补偿写次数，result 为 pushed/replayed/failed",
+			[]string{"name", "result"}),
+		shadowReads: px.NewDesc("db_move_pool_shadow_reads_total", "影子读次数，result 为 total/mismatch/failed/oversize",
+			[]string{"name", "result"}),
+		validationRuns: px.NewDesc("db_move_validation_runs_total", "校验启动次数，kind 为 full/incr",
+			[]string{"name", "kind"}),
+		checkpoint: px.NewDesc("db_move_validation_checkpoint_id", "keyset 全量校验已校验到的 id",
+			[]string{"name", "direction", "side"}),
+		discrepancies: px.NewDesc("db_move_validation_discrepancies", "最近一次完整全量校验发现的不一致数量",
+			[]string{"name"}),
+		inconsistencies: px.NewDesc("db_move_inconsistencies_total", "累计发现的不一致数据条数",
+			[]string{"name", "type"}),
+
+		pools: make(map[string]*doubleWritePoolx.DoubleWritePool),
+	}
+	if err := px.Register(c); err != nil && !errors.Is(err, prometheusX.ErrAlreadyRegistered) {
+		panic(err)
+	}
+	return c
+}
+
+// WatchPool 采集双写池指标，并把读写观测挂到双写池上
+func (c *Collector) WatchPool(name string, pool *doubleWritePoolx.DoubleWritePool) *Collector {
+	c.mu.Lock()
+	c.pools[name] = pool
+	c.mu.Unlock()
+	pool.SetObserver(&poolObserver{c: c, name: name})
+	return c
+}
+
+// WatchScheduler 采集调度器的校验进度和不一致数量，name 取自 SchedulerMetrics.Name
+func (c *Collector) WatchScheduler(s SchedulerSource) *Collector {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schedulers = append(c.schedulers, s)
+	return c
+}
+
+// Describe 实现 prometheus.Collector，只描述采集时读取的指标，实时上报的指标已单独注册
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pattern
+	ch <- c.compensateBacklog
+	ch <- c.compensate
+	ch <- c.shadowReads
+	ch <- c.validationRuns
+	ch <- c.checkpoint
+	ch <- c.discrepancies
+	ch <- c.inconsistencies
+}
+
+// Collect 实现 prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, pool := range c.pools {
+		current := pool.Pattern.Load()
+		for _, p := range patterns {
+			val := 0.0
+			if p == current {
+				val = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.pattern, prometheus.GaugeValue, val, name, p)
+		}
+		m := pool.Snapshot()
+		ch <- prometheus.MustNewConstMetric(c.compensateBacklog, prometheus.GaugeValue, float64(m.CompensateBacklog), name)
+		ch <- prometheus.MustNewConstMetric(c.compensate, prometheus.CounterValue, float64(m.CompensatePushed), name, "pushed")
+		ch <- prometheus.MustNewConstMetric(c.compensate, prometheus.CounterValue, float64(m.CompensateReplayed), name, "replayed")
+		ch <- prometheus.MustNewConstMetric(c.compensate, prometheus.CounterValue, float64(m.CompensateFailures), name, "failed")
+		ch <- prometheus.MustNewConstMetric(c.shadowReads, prometheus.CounterValue, float64(m.ShadowReads), name, "total")
+		ch <- prometheus.MustNewConstMetric(c.shadowReads, prometheus.CounterValue, float64(m.ShadowMismatches), name, "mismatch")
+		ch <- prometheus.MustNewConstMetric(c.shadowReads, prometheus.CounterValue, float64(m.ShadowFailures), name, "failed")
+		ch <- prometheus.MustNewConstMetric(c.shadowReads, prometheus.CounterValue, float64(m.ShadowOversize), name, "oversize")
+	}
+	for _, s := range c.schedulers {
+		m := s.Metrics()
+		ch <- prometheus.MustNewConstMetric(c.validationRuns, prometheus.CounterValue, float64(m.FullValidationRuns), m.Name, "full")
+		ch <- prometheus.MustNewConstMetric(c.validationRuns, prometheus.CounterValue, float64(m.IncrValidationRuns), m.Name, "incr")
+		ch <- prometheus.MustNewConstMetric(c.discrepancies, prometheus.GaugeValue, float64(m.DataDiscrepancies), m.Name)
+		for direction, cp := range m.Checkpoints {
+			ch <- prometheus.MustNewConstMetric(c.checkpoint, prometheus.GaugeValue, float64(cp.BaseToTarget), m.Name, direction, "base_to_target")
+			ch <- prometheus.MustNewConstMetric(c.checkpoint, prometheus.GaugeValue, float64(cp.TargetToBase), m.Name, direction, "target_to_base")
+		}
+		for typ, cnt := range m.Inconsistencies {
+			ch <- prometheus.MustNewConstMetric(c.inconsistencies, prometheus.CounterValue, float64(cnt), m.Name, typ)
+		}
+	}
+}
+
+// poolObserver 单个双写池的读写观测
+type poolObserver struct {
+	c    *Collector
+	name string
+}
+
+func (o *poolObserver) ObserveOp(op, pattern string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	o.c.ops.WithLabelValues(o.name, op, pattern, result).Inc()
+	o.c.latency.WithLabelValues(o.name, op, pattern).Observe(duration.Seconds())
+}
+
+func (o *poolObserver) ObserveSecondaryFailure(pattern, target string) {
+	o.c.secondary.WithLabelValues(o.name, pattern, target).Inc()
+}
+
+func (o *poolObserver) ObserveRetry(pattern string) {
+	o.c.retries.WithLabelValues(o.name, pattern).Inc()
+}
@@ -0,0 +1,71 @@
+package movePrometheusx
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/doubleWritePoolx"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/scheduler"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/validator"
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/hgg-6/pkgTool/v2/observationX/prometheusX"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var _ SchedulerSource = (*scheduler.Scheduler[events.TestUser, any])(nil)
+
+// fakeScheduler 仅测试用的调度器指标
+type fakeScheduler struct{}
+
+func (fakeScheduler) Metrics() scheduler.SchedulerMetrics {
+	return scheduler.SchedulerMetrics{
+		Name:               "user",
+		FullValidationRuns: 2,
+		Checkpoints:        map[string]validator.Checkpoint{"SRC": {BaseToTarget: 100, TargetToBase: 80}},
+		Inconsistencies:    map[string]int64{events.InconsistentEventTypeNEQ: 3},
+	}
+}
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	px := prometheusX.New(prometheusX.WithNamespace("hgg"), prometheusX.WithRegisterer(reg), prometheusX.WithGatherer(reg))
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	emptyDB := &gorm.DB{Config: &gorm.Config{}}
+	pool := doubleWritePoolx.NewDoubleWritePool(emptyDB, emptyDB, l)
+	defer pool.Close()
+	require.NoError(t, pool.UpdatePattern(doubleWritePoolx.PatternSrcFirst))
+
+	NewCollector(px).WatchPool("user", pool).WatchScheduler(fakeScheduler{})
+	// 源库为 nil，执行失败也会被观测到
+	_, err := pool.ExecContext(context.Background(), "UPDATE users SET name = ?", "a")
+	assert.Error(t, err)
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP hgg_db_move_pool_pattern 当前双写模式，当前模式为 1，其余为 0
+# TYPE hgg_db_move_pool_pattern gauge
+hgg_db_move_pool_pattern{name="user",pattern="dst_first"} 0
+hgg_db_move_pool_pattern{name="user",pattern="dst_only"} 0
+hgg_db_move_pool_pattern{name="user",pattern="src_first"} 1
+hgg_db_move_pool_pattern{name="user",pattern="src_only"} 0
+# HELP hgg_db_move_pool_ops_total 双写池读写次数，result 为 success/error
+# TYPE hgg_db_move_pool_ops_total counter
+hgg_db_move_pool_ops_total{name="user",op="exec",pattern="src_first",result="error"} 1
+# HELP hgg_db_move_inconsistencies_total 累计发现的不一致数据条数
+# TYPE hgg_db_move_inconsistencies_total counter
+hgg_db_move_inconsistencies_total{name="user",type="neq"} 3
+# HELP hgg_db_move_validation_checkpoint_id keyset 全量校验已校验到的 id
+# TYPE hgg_db_move_validation_checkpoint_id gauge
+hgg_db_move_validation_checkpoint_id{direction="SRC",name="user",side="base_to_target"} 100
+hgg_db_move_validation_checkpoint_id{direction="SRC",name="user",side="target_to_base"} 80
+`), "hgg_db_move_pool_pattern", "hgg_db_move_pool_ops_total", "hgg_db_move_inconsistencies_total", "hgg_db_move_validation_checkpoint_id")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, testutil.CollectAndCount(reg, "hgg_db_move_pool_compensate_backlog"))
+}
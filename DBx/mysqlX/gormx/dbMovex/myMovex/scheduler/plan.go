@@ -0,0 +1,460 @@
+package scheduler
+
+/*
+	=================================
+	此文件主要封装多表迁移计划：多张相关的表按依赖顺序、按分组统一推进双写模式
+	=================================
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/doubleWritePoolx"
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"github.com/hgg-6/pkgTool/v2/webx/ginx"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	errPlanCompleted = errors.New("迁移计划已完成，所有表均为目标库只写模式")
+	errPlanRunning   = errors.New("迁移计划正在执行中")
+	errPlanEmpty     = errors.New("迁移计划中没有注册任何表")
+)
+
+// patternOrder 迁移计划推进的阶段顺序，下标与 doubleWritePoolx.PatternIndex 一致
+var patternOrder = []string{
+	doubleWritePoolx.PatternSrcOnly,
+	doubleWritePoolx.PatternSrcFirst,
+	doubleWritePoolx.PatternDstFirst,
+	doubleWritePoolx.PatternDstOnly,
+}
+
+// Table 迁移计划中的一张表，*Scheduler 实现了该接口
+type Table interface {
+	// Name 表名，在迁移计划中唯一
+	Name() string
+	// SwitchPattern 切换双写模式
+	SwitchPattern(pattern string) error
+	// ValidateOnce 同步执行一次全量校验，返回不一致数据条数
+	ValidateOnce(ctx context.Context) (int64, error)
+	// Status 当前迁移状态
+	Status() TableStatus
+	// RegisterRoutes 注册单表的控制接口
+	RegisterRoutes(server *gin.RouterGroup)
+}
+
+// PlanConfig 迁移计划配置
+type PlanConfig struct {
+	StableWait          time.Duration `json:"stable_wait"`          // 自动迁移时每推进一个阶段后的稳定等待时间，默认 5s
+	ValidationTimeout   time.Duration `json:"validation_timeout"`   // 单表一致性校验超时，默认 30m
+	ValidateConcurrency int           `json:"validate_concurrency"` // 同一分组内并发校验的表数量，默认 4
+}
+
+// PlanStatus 迁移计划汇总状态
+type PlanStatus struct {
+	Pattern   string        `json:"pattern"`    // 计划当前所处阶段，即所有表中最靠前的双写模式
+	Running   bool          `json:"running"`    // 是否有后台推进任务在执行
+	LastError string        `json:"last_error"` // 最后一次推进失败的原因
+	Tables    []TableStatus `json:"tables"`     // 按切换顺序排列的各表状态
+}
+
+type planTable struct {
+	table     Table
+	group     string
+	dependsOn []string
+}
+
+// MigrationPlan 多表迁移计划
+//   - 多张表一起按 SrcOnly -> SrcFirst -> DstFirst -> DstOnly 推进
+//   - 被依赖的表先切换；同一分组的表只有全部校验无不一致时才一起切换
+type MigrationPlan struct {
+	lock     sync.Mutex
+	stepLock sync.Mutex // 保证同一时刻只有一次推进
+	l        logx.Loggerx
+	config   PlanConfig
+
+	tables  map[string]*planTable
+	names   []string // 注册顺序
+	running bool
+	lastErr string
+}
+
+// NewMigrationPlan 创建多表迁移计划
+func NewMigrationPlan(l logx.Loggerx, config ...PlanConfig) *MigrationPlan {
+	var cfg PlanConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.StableWait <= 0 {
+		cfg.StableWait = 5 * time.Second
+	}
+	if cfg.ValidationTimeout <= 0 {
+		cfg.ValidationTimeout = 30 * time.Minute
+	}
+	if cfg.ValidateConcurrency <= 0 {
+		cfg.ValidateConcurrency = 4
+	}
+	return &MigrationPlan{
+		l:      l,
+		config: cfg,
+		tables: make(map[string]*planTable),
+	}
+}
+
+// Register 注册一张表
+//   - group 分组名，同组的表一起切换，为空时以表名单独成组
+//   - dependsOn 依赖的表名，推进时先切换被依赖的表
+func (p *MigrationPlan) Register(t Table, group string, dependsOn ...string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	name := t.Name()
+	if _, ok := p.tables[name]; ok {
+		return fmt.Errorf("表 %s 已注册", name)
+	}
+	if group == "" {
+		group = name
+	}
+	p.tables[name] = &planTable{table: t, group: group, dependsOn: dependsOn}
+	p.names = append(p.names, name)
+	return nil
+}
+
+// RegisterRoutes 注册迁移计划的汇总接口，各表的控制接口挂在 /tables/{表名} 下
+//   - 需在所有表 Register 之后调用
+func (p *MigrationPlan) RegisterRoutes(server *gin.RouterGroup) {
+	server.GET("/status", ginx.Wrap(p.GetStatus))          // 汇总状态
+	server.GET("/health", ginx.Wrap(p.HealthCheck))        // 汇总健康检查
+	server.POST("/advance", ginx.Wrap(p.AdvanceAsync))     // 推进一个阶段
+	server.POST("/auto-migrate", ginx.Wrap(p.AutoMigrate)) // 自动推进到目标库只写
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, name := range p.names {
+		p.tables[name].table.RegisterRoutes(server.Group("/tables/" + name))
+	}
+}
+
+// Status 迁移计划汇总状态
+func (p *MigrationPlan) Status() PlanStatus {
+	p.lock.Lock()
+	var tables []*planTable
+	if groups, err := p.groups(); err == nil {
+		for _, group := range groups {
+			tables = append(tables, group...)
+		}
+	} else {
+		// 依赖关系有误时按注册顺序展示
+		for _, name := range p.names {
+			tables = append(tables, p.tables[name])
+		}
+	}
+	res := PlanStatus{Running: p.running, LastError: p.lastErr}
+	p.lock.Unlock()
+
+	minIdx := len(patternOrder) - 1
+	for _, pt := range tables {
+		st := pt.table.Status()
+		st.Group = pt.group
+		st.DependsOn = pt.dependsOn
+		res.Tables = append(res.Tables, st)
+		if idx := doubleWritePoolx.PatternIndex(st.Pattern); idx < minIdx {
+			minIdx = idx
+			// 未知模式原样展示
+			res.Pattern = st.Pattern
+		}
+	}
+	if len(tables) > 0 && minIdx >= 0 {
+		res.Pattern = patternOrder[minIdx]
+	}
+	return res
+}
+
+// GetStatus 汇总状态接口
+func (p *MigrationPlan) GetStatus(c *gin.Context) (ginx.Result, error) {
+	return ginx.Result{
+		Data: p.Status(),
+		Msg:  "OK",
+	}, nil
+}
+
+// HealthCheck 汇总健康检查接口，任一表的双写池不健康即失败
+func (p *MigrationPlan) HealthCheck(c *gin.Context) (ginx.Result, error) {
+	unhealthy := make(map[string]map[string]string)
+	for _, st := range p.Status().Tables {
+		if len(st.Health) > 0 {
+			unhealthy[st.Name] = st.Health
+		}
+	}
+	if len(unhealthy) > 0 {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "健康检查失败",
+			Data: unhealthy,
+		}, nil
+	}
+	return ginx.Result{
+		Msg: "服务健康",
+	}, nil
+}
+
+// AdvanceAsync 后台推进一个阶段，结果通过 /status 查看
+func (p *MigrationPlan) AdvanceAsync(c *gin.Context) (ginx.Result, error) {
+	if err := p.startBackground(func(ctx context.Context) error {
+		_, err := p.Advance(ctx)
+		return err
+	}); err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  err.Error(),
+		}, nil
+	}
+	return ginx.Result{
+		Msg: "已开始推进迁移计划",
+	}, nil
+}
+
+// AutoMigrate 后台自动推进到目标库只写，结果通过 /status 查看
+func (p *MigrationPlan) AutoMigrate(c *gin.Context) (ginx.Result, error) {
+	if err := p.startBackground(p.Run); err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  err.Error(),
+		}, nil
+	}
+	return ginx.Result{
+		Msg: "迁移计划自动迁移流程已启动",
+	}, nil
+}
+
+// startBackground 后台执行推进任务，同一时刻只允许一个
+func (p *MigrationPlan) startBackground(fn func(ctx context.Context) error) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.running {
+		return errPlanRunning
+	}
+	p.running = true
+	go func() {
+		err := fn(context.Background())
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		p.running = false
+		if err != nil {
+			p.lastErr = err.Error()
+			p.l.Error("迁移计划推进失败", logx.Error(err))
+			return
+		}
+		p.lastErr = ""
+	}()
+	return nil
+}
+
+// Run 自动推进直到所有表都为目标库只写模式，任一分组校验不通过即停止
+func (p *MigrationPlan) Run(ctx context.Context) error {
+	for {
+		pattern, err := p.Advance(ctx)
+		if errors.Is(err, errPlanCompleted) {
+			p.l.Info("迁移计划完成")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if pattern == doubleWritePoolx.PatternDstOnly {
+			p.l.Info("迁移计划完成")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.config.StableWait):
+		}
+	}
+}
+
+// Advance 把所有表推进到下一个阶段，返回推进后的阶段
+//   - 按分组依赖顺序逐组切换，组内按表依赖顺序切换
+//   - 从双写切换到 DstFirst / DstOnly 前，组内每张表都需校验无不一致，否则该组及后续分组都不切换
+//   - 组内某张表切换失败时，已切换的表回滚到原模式
+func (p *MigrationPlan) Advance(ctx context.Context) (string, error) {
+	p.stepLock.Lock()
+	defer p.stepLock.Unlock()
+
+	p.lock.Lock()
+	groups, err := p.groups()
+	p.lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	cur := len(patternOrder) - 1
+	for _, group := range groups {
+		for _, pt := range group {
+			// 未知模式为 -1，推进到 SrcOnly
+			if idx := doubleWritePoolx.PatternIndex(pt.table.Status().Pattern); idx < cur {
+				cur = idx
+			}
+		}
+	}
+	if cur == len(patternOrder)-1 {
+		return "", errPlanCompleted
+	}
+	target := patternOrder[cur+1]
+	p.l.Info("迁移计划开始推进", logx.String("pattern", target))
+
+	for _, group := range groups {
+		if err = p.advanceGroup(ctx, group, target); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// advanceGroup 把一个分组内落后于 target 的表切换到 target
+func (p *MigrationPlan) advanceGroup(ctx context.Context, group []*planTable, target string) error {
+	targetIdx := doubleWritePoolx.PatternIndex(target)
+	var pending []*planTable
+	var prev []string
+	for _, pt := range group {
+		pattern := pt.table.Status().Pattern
+		if doubleWritePoolx.PatternIndex(pattern) < targetIdx {
+			pending = append(pending, pt)
+			prev = append(prev, pattern)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	groupName := pending[0].group
+
+	if target == doubleWritePoolx.PatternDstFirst || target == doubleWritePoolx.PatternDstOnly {
+		if err := p.validateGroup(ctx, pending); err != nil {
+			return fmt.Errorf("分组 %s 校验未通过，不切换到 %s: %w", groupName, target, err)
+		}
+	}
+
+	for i, pt := range pending {
+		if err := pt.table.SwitchPattern(target); err != nil {
+			// 回滚本组已切换的表，保证同组的表模式一致
+			for j := i - 1; j >= 0; j-- {
+				if er := pending[j].table.SwitchPattern(prev[j]); er != nil {
+					p.l.Error("迁移计划回滚失败", logx.Error(er),
+						logx.String("table", pending[j].table.Name()), logx.String("pattern", prev[j]))
+				}
+			}
+			return fmt.Errorf("分组 %s 的表 %s 切换到 %s 失败: %w", groupName, pt.table.Name(), target, err)
+		}
+	}
+	p.l.Info("迁移计划分组已切换", logx.String("group", groupName), logx.String("pattern", target))
+	return nil
+}
+
+// validateGroup 并发校验分组内的表，任一表有不一致数据或校验出错即失败
+func (p *MigrationPlan) validateGroup(ctx context.Context, tables []*planTable) error {
+	var eg errgroup.Group
+	eg.SetLimit(p.config.ValidateConcurrency)
+	for _, pt := range tables {
+		eg.Go(func() error {
+			vctx, cancel := context.WithTimeout(ctx, p.config.ValidationTimeout)
+			defer cancel()
+			cnt, err := pt.table.ValidateOnce(vctx)
+			if err != nil {
+				return fmt.Errorf("表 %s 校验失败: %w", pt.table.Name(), err)
+			}
+			if cnt > 0 {
+				return fmt.Errorf("表 %s 存在 %d 条不一致数据", pt.table.Name(), cnt)
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+// order 按表依赖拓扑排序后的表名，依赖相同时保持注册顺序，调用方需持有 p.lock
+func (p *MigrationPlan) order() ([]string, error) {
+	if len(p.names) == 0 {
+		return nil, errPlanEmpty
+	}
+	deps := make(map[string][]string, len(p.names))
+	for _, name := range p.names {
+		for _, dep := range p.tables[name].dependsOn {
+			if _, ok := p.tables[dep]; !ok {
+				return nil, fmt.Errorf("表 %s 依赖的表 %s 未注册", name, dep)
+			}
+		}
+		deps[name] = p.tables[name].dependsOn
+	}
+	return topoSort(p.names, deps)
+}
+
+// groups 按分组依赖顺序排列的分组，组内的表按表依赖顺序排列，调用方需持有 p.lock
+func (p *MigrationPlan) groups() ([][]*planTable, error) {
+	names, err := p.order()
+	if err != nil {
+		return nil, err
+	}
+	var groupNames []string
+	members := make(map[string][]*planTable)
+	groupDeps := make(map[string][]string)
+	for _, name := range names {
+		pt := p.tables[name]
+		if _, ok := members[pt.group]; !ok {
+			groupNames = append(groupNames, pt.group)
+		}
+		members[pt.group] = append(members[pt.group], pt)
+		for _, dep := range pt.dependsOn {
+			if depGroup := p.tables[dep].group; depGroup != pt.group {
+				groupDeps[pt.group] = append(groupDeps[pt.group], depGroup)
+			}
+		}
+	}
+	sorted, err := topoSort(groupNames, groupDeps)
+	if err != nil {
+		return nil, fmt.Errorf("分组依赖有误: %w", err)
+	}
+	res := make([][]*planTable, 0, len(sorted))
+	for _, g := range sorted {
+		res = append(res, members[g])
+	}
+	return res, nil
+}
+
+// topoSort 稳定的拓扑排序，deps[n] 中的节点排在 n 之前，存在循环依赖时返回错误
+func topoSort(nodes []string, deps map[string][]string) ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(nodes))
+	res := make([]string, 0, len(nodes))
+	var visit func(n string) error
+	visit = func(n string) error {
+		switch marks[n] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("存在循环依赖: %s", n)
+		}
+		marks[n] = visiting
+		for _, dep := range deps[n] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[n] = visited
+		res = append(res, n)
+		return nil
+	}
+	for _, n := range nodes {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
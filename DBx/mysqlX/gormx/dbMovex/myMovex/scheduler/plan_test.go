@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/doubleWritePoolx"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ Table = (*Scheduler[events.TestUser, any])(nil)
+
+// fakeTable 仅测试用的表，记录切换顺序
+type fakeTable struct {
+	name         string
+	pattern      string
+	discrepancy  int64
+	switchErr    error
+	switchRecord *[]string
+	mu           *sync.Mutex
+}
+
+func (f *fakeTable) Name() string { return f.name }
+
+func (f *fakeTable) SwitchPattern(pattern string) error {
+	if f.switchErr != nil && pattern != doubleWritePoolx.PatternSrcOnly {
+		return f.switchErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pattern = pattern
+	*f.switchRecord = append(*f.switchRecord, f.name+":"+pattern)
+	return nil
+}
+
+func (f *fakeTable) ValidateOnce(ctx context.Context) (int64, error) {
+	return f.discrepancy, nil
+}
+
+func (f *fakeTable) Status() TableStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return TableStatus{Name: f.name, Pattern: f.pattern}
+}
+
+func (f *fakeTable) RegisterRoutes(server *gin.RouterGroup) {}
+
+func newTestPlan() (*MigrationPlan, map[string]*fakeTable, *[]string) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	plan := NewMigrationPlan(l, PlanConfig{StableWait: time.Millisecond, ValidateConcurrency: 2})
+	record := &[]string{}
+	mu := &sync.Mutex{}
+	tables := make(map[string]*fakeTable)
+	for _, name := range []string{"order_item", "order", "user", "user_profile"} {
+		tables[name] = &fakeTable{name: name, pattern: doubleWritePoolx.PatternSrcOnly, switchRecord: record, mu: mu}
+	}
+	return plan, tables, record
+}
+
+// TestMigrationPlanOrder 测试按依赖顺序、按分组推进
+func TestMigrationPlanOrder(t *testing.T) {
+	plan, tables, record := newTestPlan()
+	// order 分组依赖 user 分组
+	require.NoError(t, plan.Register(tables["order_item"], "order", "order"))
+	require.NoError(t, plan.Register(tables["order"], "order", "user"))
+	require.NoError(t, plan.Register(tables["user"], "user"))
+	require.NoError(t, plan.Register(tables["user_profile"], "user", "user"))
+	assert.Error(t, plan.Register(tables["user"], "user"))
+
+	pattern, err := plan.Advance(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, pattern)
+	assert.Equal(t, []string{
+		"user:src_first", "user_profile:src_first",
+		"order:src_first", "order_item:src_first",
+	}, *record)
+
+	require.NoError(t, plan.Run(context.Background()))
+	status := plan.Status()
+	assert.Equal(t, doubleWritePoolx.PatternDstOnly, status.Pattern)
+	assert.Equal(t, []string{"user", "user_profile", "order", "order_item"}, tableNames(status.Tables))
+	assert.Equal(t, "order", status.Tables[2].Group)
+
+	_, err = plan.Advance(context.Background())
+	assert.ErrorIs(t, err, errPlanCompleted)
+}
+
+// TestMigrationPlanValidationGate 测试分组内有不一致数据时整组都不切换
+func TestMigrationPlanValidationGate(t *testing.T) {
+	plan, tables, _ := newTestPlan()
+	require.NoError(t, plan.Register(tables["user"], "user"))
+	require.NoError(t, plan.Register(tables["order"], "order", "user"))
+	require.NoError(t, plan.Register(tables["order_item"], "order", "order"))
+
+	_, err := plan.Advance(context.Background())
+	require.NoError(t, err)
+
+	tables["order_item"].discrepancy = 3
+	_, err = plan.Advance(context.Background())
+	require.Error(t, err)
+	// user 分组已切换，order 分组因 order_item 不一致整组保持双写源库优先
+	assert.Equal(t, doubleWritePoolx.PatternDstFirst, tables["user"].pattern)
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, tables["order"].pattern)
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, tables["order_item"].pattern)
+
+	// 修复后继续推进，只切换落后的分组
+	tables["order_item"].discrepancy = 0
+	pattern, err := plan.Advance(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, doubleWritePoolx.PatternDstFirst, pattern)
+	assert.Equal(t, doubleWritePoolx.PatternDstFirst, plan.Status().Pattern)
+}
+
+// TestMigrationPlanRollback 测试组内切换失败时回滚已切换的表
+func TestMigrationPlanRollback(t *testing.T) {
+	plan, tables, _ := newTestPlan()
+	require.NoError(t, plan.Register(tables["order"], "order"))
+	require.NoError(t, plan.Register(tables["order_item"], "order", "order"))
+	tables["order_item"].switchErr = errors.New("mock switch error")
+
+	_, err := plan.Advance(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, doubleWritePoolx.PatternSrcOnly, tables["order"].pattern)
+	assert.Equal(t, doubleWritePoolx.PatternSrcOnly, tables["order_item"].pattern)
+}
+
+// TestMigrationPlanUnknownPattern 测试推进顺序与双写池一致，未知模式排在 SrcOnly 之前
+func TestMigrationPlanUnknownPattern(t *testing.T) {
+	for i, pattern := range patternOrder {
+		assert.Equal(t, i, doubleWritePoolx.PatternIndex(pattern))
+	}
+
+	plan, tables, record := newTestPlan()
+	tables["user"].pattern = ""
+	require.NoError(t, plan.Register(tables["user"], "user"))
+	require.NoError(t, plan.Register(tables["order"], "order", "user"))
+	assert.Equal(t, "", plan.Status().Pattern)
+
+	pattern, err := plan.Advance(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, doubleWritePoolx.PatternSrcOnly, pattern)
+	assert.Equal(t, []string{"user:src_only"}, *record)
+	assert.Equal(t, doubleWritePoolx.PatternSrcOnly, plan.Status().Pattern)
+}
+
+// TestMigrationPlanInvalidDeps 测试依赖未注册和循环依赖
+func TestMigrationPlanInvalidDeps(t *testing.T) {
+	plan, tables, _ := newTestPlan()
+	require.NoError(t, plan.Register(tables["order"], "", "user"))
+	_, err := plan.Advance(context.Background())
+	assert.Error(t, err)
+
+	require.NoError(t, plan.Register(tables["user"], "", "order"))
+	_, err = plan.Advance(context.Background())
+	assert.Error(t, err)
+}
+
+func tableNames(tables []TableStatus) []string {
+	res := make([]string, 0, len(tables))
+	for _, t := range tables {
+		res = append(res, t.Name)
+	}
+	return res
+}
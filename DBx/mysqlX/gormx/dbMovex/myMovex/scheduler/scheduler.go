@@ -8,14 +8,16 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/gin-gonic/gin"
 	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex"
 	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/doubleWritePoolx"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/stateStorex"
 	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/validator"
 	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/hgg-6/pkgTool/v2/logx"
 	"github.com/hgg-6/pkgTool/v2/webx/ginx"
-	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"sync"
 	"time"
@@ -46,14 +48,15 @@ type MigrationStats struct {
 // Scheduler 用来统一管理整个迁移过程
 // 它不是必须的，你可以理解为这是为了方便用户操作而引入。
 type Scheduler[T myMovex.Entity, Pdr any] struct {
-	lock    sync.Mutex
-	src     *gorm.DB
-	dst     *gorm.DB
-	pool    *doubleWritePoolx.DoubleWritePool // 双写池
-	l       logx.Loggerx
-	Pattern string         // 模式
-	State   MigrationState // 迁移状态
-	Stats   MigrationStats // 迁移统计信息
+	lock     sync.Mutex
+	saveLock sync.Mutex // 串行持久化迁移进度，不阻塞读取
+	src      *gorm.DB
+	dst      *gorm.DB
+	pool     *doubleWritePoolx.DoubleWritePool // 双写池
+	l        logx.Loggerx
+	Pattern  string         // 模式
+	State    MigrationState // 迁移状态
+	Stats    MigrationStats // 迁移统计信息
 
 	cancelFull func() // 全量校验的取消函数
 	cancelIncr func() // 增量校验的取消函数
@@ -65,6 +68,16 @@ type Scheduler[T myMovex.Entity, Pdr any] struct {
 	// 新增字段
 	vdt    map[string]*validator.Validator[T, Pdr] // 活跃的校验器
 	config SchedulerConfig                         // 调度器配置
+
+	cpLock      sync.Mutex
+	checkpoints map[string]validator.Checkpoint // keyset 全量校验断点，key 为校验方向 SRC/DST
+	cpSaveLock  sync.Mutex                      // 串行持久化断点，不阻塞读取
+
+	store     stateStorex.StateStore // 迁移进度存储，为 nil 时进度只保存在内存中
+	stateName string                 // 迁移任务名
+
+	incLock      sync.Mutex
+	inconsistent map[string]int64 // 本进程各校验器累计发现的不一致数据条数，key 为不一致类型
 }
 
 // SchedulerConfig 调度器配置
@@ -73,6 +86,9 @@ type SchedulerConfig struct {
 	MaxValidationErrors  int           `json:"max_validation_errors"`  // 最大允许的校验错误数
 	EnableAutoPromotion  bool          `json:"enable_auto_promotion"`  // 自动升级
 	ValidationTimeout    time.Duration `json:"validation_timeout"`     // 校验超时
+	// KeysetBatchSize > 0 时全量校验使用 keyset 游标分批模式，每批取 KeysetBatchSize 条，
+	// 中途停止后再次开启会从上次的断点继续
+	KeysetBatchSize int `json:"keyset_batch_size"`
 }
 
 // NewScheduler
@@ -97,6 +113,8 @@ func NewScheduler[T myMovex.Entity, Pdr any](l logx.Loggerx, src *gorm.DB, dst *
 		pool:              pool,
 		producer:          producer,
 		MessageQueueTopic: "dbMove",
+		checkpoints:       make(map[string]validator.Checkpoint),
+		inconsistent:      make(map[string]int64),
 	}
 }
 
@@ -126,19 +144,12 @@ func (s *Scheduler[T, Pdr]) RegisterRoutes(server *gin.RouterGroup) {
 
 // SrcOnly 只读写源表
 func (s *Scheduler[T, Pdr]) SrcOnly(c *gin.Context) (ginx.Result, error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.Pattern = doubleWritePoolx.PatternSrcOnly
-	if err := s.pool.UpdatePattern(doubleWritePoolx.PatternSrcOnly); err != nil {
+	if err := s.SwitchPattern(doubleWritePoolx.PatternSrcOnly); err != nil {
 		return ginx.Result{
 			Code: 5,
 			Msg:  "切换模式失败",
 		}, err
 	}
-	s.Pattern = doubleWritePoolx.PatternSrcOnly
-	s.State = StateSrcOnly
-	s.Stats.CurrentState = StateSrcOnly
-	s.l.Info("切换到源库只写模式")
 	return ginx.Result{
 		Msg: "已切换到源库只写模式",
 	}, nil
@@ -146,19 +157,12 @@ func (s *Scheduler[T, Pdr]) SrcOnly(c *gin.Context) (ginx.Result, error) {
 
 // SrcFirst 双写，源库优先
 func (s *Scheduler[T, Pdr]) SrcFirst(c *gin.Context) (ginx.Result, error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.Pattern = doubleWritePoolx.PatternSrcFirst
-	if err := s.pool.UpdatePattern(doubleWritePoolx.PatternSrcFirst); err != nil {
+	if err := s.SwitchPattern(doubleWritePoolx.PatternSrcFirst); err != nil {
 		return ginx.Result{
 			Code: 5,
 			Msg:  "切换模式失败",
 		}, err
 	}
-	s.Pattern = doubleWritePoolx.PatternSrcFirst
-	s.State = StateSrcFirst
-	s.Stats.CurrentState = StateSrcFirst
-	s.l.Info("切换到双写，源库优先模式")
 	return ginx.Result{
 		Msg: "已切换到双写，源库优先模式",
 	}, nil
@@ -166,19 +170,12 @@ func (s *Scheduler[T, Pdr]) SrcFirst(c *gin.Context) (ginx.Result, error) {
 
 // DstFirst 双写，目标库优先
 func (s *Scheduler[T, Pdr]) DstFirst(c *gin.Context) (ginx.Result, error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.Pattern = doubleWritePoolx.PatternDstFirst
-	if err := s.pool.UpdatePattern(doubleWritePoolx.PatternDstFirst); err != nil {
+	if err := s.SwitchPattern(doubleWritePoolx.PatternDstFirst); err != nil {
 		return ginx.Result{
 			Code: 5,
 			Msg:  "切换模式失败",
 		}, err
 	}
-	s.Pattern = doubleWritePoolx.PatternDstFirst
-	s.State = StateDstFirst
-	s.Stats.CurrentState = StateDstFirst
-	s.l.Info("切换到双写，目标库优先模式")
 	return ginx.Result{
 		Msg: "已切换到双写，目标库优先模式",
 	}, nil
@@ -186,24 +183,45 @@ func (s *Scheduler[T, Pdr]) DstFirst(c *gin.Context) (ginx.Result, error) {
 
 // DstOnly 只读写目标表
 func (s *Scheduler[T, Pdr]) DstOnly(c *gin.Context) (ginx.Result, error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.Pattern = doubleWritePoolx.PatternDstOnly
-	if err := s.pool.UpdatePattern(doubleWritePoolx.PatternDstOnly); err != nil {
+	if err := s.SwitchPattern(doubleWritePoolx.PatternDstOnly); err != nil {
 		return ginx.Result{
 			Code: 5,
 			Msg:  "切换模式失败",
 		}, err
 	}
-	s.Pattern = doubleWritePoolx.PatternDstOnly
-	s.State = StateDstOnly
-	s.Stats.CurrentState = StateDstOnly
-	s.l.Info("切换到目标库只写模式")
 	return ginx.Result{
 		Msg: "已切换到目标库只写模式",
 	}, nil
 }
 
+// patternStates 双写模式对应的迁移状态
+var patternStates = map[string]MigrationState{
+	doubleWritePoolx.PatternSrcOnly:  StateSrcOnly,
+	doubleWritePoolx.PatternSrcFirst: StateSrcFirst,
+	doubleWritePoolx.PatternDstFirst: StateDstFirst,
+	doubleWritePoolx.PatternDstOnly:  StateDstOnly,
+}
+
+// SwitchPattern 切换双写模式，不依赖 http 上下文，供代码中直接调用或迁移计划编排
+func (s *Scheduler[T, Pdr]) SwitchPattern(pattern string) error {
+	state, ok := patternStates[pattern]
+	if !ok {
+		return fmt.Errorf("未知的 Pattern %s", pattern)
+	}
+	s.lock.Lock()
+	if err := s.pool.UpdatePattern(pattern); err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	s.Pattern = pattern
+	s.State = state
+	s.Stats.CurrentState = state
+	s.lock.Unlock()
+	s.saveState()
+	s.l.Info("切换双写模式", logx.String("pattern", pattern), logx.String("table", s.Name()))
+	return nil
+}
+
 // StopIncrementValidation 停止增量校验
 func (s *Scheduler[T, Pdr]) StopIncrementValidation(c *gin.Context) (ginx.Result, error) {
 	s.lock.Lock()
@@ -218,11 +236,11 @@ func (s *Scheduler[T, Pdr]) StopIncrementValidation(c *gin.Context) (ginx.Result
 func (s *Scheduler[T, Pdr]) StartIncrementValidation(c *gin.Context, req StartIncrRequest) (ginx.Result, error) {
 	// 开启增量校验
 	s.lock.Lock()
-	defer s.lock.Unlock()
 	// 取消上一次的
 	cancel := s.cancelIncr
 	v, err := s.newValidator()
 	if err != nil {
+		s.lock.Unlock()
 		return ginx.Result{
 			Code: 5,
 			Msg:  "系统异常",
@@ -241,6 +259,8 @@ func (s *Scheduler[T, Pdr]) StartIncrementValidation(c *gin.Context, req StartIn
 		er := v.Validate(ctx)
 		s.l.Warn("退出增量校验", logx.Error(er))
 	}()
+	s.lock.Unlock()
+	s.saveState()
 	return ginx.Result{
 		Msg: "OK, 启动增量校验成功",
 	}, nil
@@ -260,18 +280,30 @@ func (s *Scheduler[T, Pdr]) StopFullValidation(c *gin.Context) (ginx.Result, err
 func (s *Scheduler[T, Pdr]) StartFullValidation(c *gin.Context) (ginx.Result, error) {
 	// 可以考虑去重的问题
 	s.lock.Lock()
-	defer s.lock.Unlock()
 	// 取消上一次的
 	cancel := s.cancelFull
 	v, err := s.newValidator()
 	if err != nil {
+		s.lock.Unlock()
 		return ginx.Result{}, err
 	}
 	var ctx context.Context
 	ctx, s.cancelFull = context.WithCancel(context.Background())
 
+	direction := s.direction()
+	keyset := s.config.KeysetBatchSize > 0
+	if keyset {
+		v.Keyset().BatchSize(s.config.KeysetBatchSize).
+			Resume(s.getCheckpoint(direction)).
+			OnCheckpoint(func(cp validator.Checkpoint) {
+				s.setCheckpoint(direction, cp)
+			})
+	}
+
 	// 增加统计信息
 	s.Stats.FullValidationRuns++
+	s.lock.Unlock()
+	s.saveState()
 
 	go func() {
 		// 先取消上一次的
@@ -279,6 +311,20 @@ func (s *Scheduler[T, Pdr]) StartFullValidation(c *gin.Context) (ginx.Result, er
 		er := v.Validate(ctx)
 		if er != nil {
 			s.l.Warn("退出全量校验", logx.Error(er))
+			return
+		}
+		if ctx.Err() != nil {
+			// 被中途取消的保留断点供下次续跑
+			return
+		}
+		// keyset 模式从断点续跑时，Inconsistencies 含断点中记录的重启前发现的条数
+		s.lock.Lock()
+		s.Stats.DataDiscrepancies = int(v.Inconsistencies())
+		s.lock.Unlock()
+		s.saveState()
+		// 完整扫完一遍才清空断点
+		if keyset {
+			s.setCheckpoint(direction, validator.Checkpoint{})
 		}
 	}()
 	return ginx.Result{
@@ -286,17 +332,243 @@ func (s *Scheduler[T, Pdr]) StartFullValidation(c *gin.Context) (ginx.Result, er
 	}, nil
 }
 
+// direction 当前模式下的校验方向，SRC 以源库为准，DST 以目标库为准
+func (s *Scheduler[T, Pdr]) direction() string {
+	switch s.Pattern {
+	case doubleWritePoolx.PatternDstFirst, doubleWritePoolx.PatternDstOnly:
+		return "DST"
+	default:
+		return "SRC"
+	}
+}
+
+// getCheckpoint 获取某个校验方向的 keyset 断点
+func (s *Scheduler[T, Pdr]) getCheckpoint(direction string) validator.Checkpoint {
+	s.cpLock.Lock()
+	defer s.cpLock.Unlock()
+	return s.checkpoints[direction]
+}
+
+// setCheckpoint 记录某个校验方向的 keyset 断点
+//   - 内存中的断点在 cpLock 内更新，持久化在释放 cpLock 之后进行，不让存储的延迟阻塞 Status、Metrics
+//   - 持久化由 cpSaveLock 串行，每次写入该方向最新的断点，避免并发写入时旧断点覆盖新断点
+func (s *Scheduler[T, Pdr]) setCheckpoint(direction string, cp validator.Checkpoint) {
+	s.cpLock.Lock()
+	s.checkpoints[direction] = cp
+	s.cpLock.Unlock()
+	if s.store == nil {
+		return
+	}
+	s.cpSaveLock.Lock()
+	defer s.cpSaveLock.Unlock()
+	cp = s.getCheckpoint(direction)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := stateStorex.SaveCheckpoint(ctx, s.store, s.stateName, direction, cp); err != nil {
+		s.l.Error("持久化校验断点失败", logx.Error(err), logx.String("direction", direction))
+	}
+}
+
+// UseStateStore 设置迁移进度存储，并从中恢复双写模式、迁移状态、统计信息和各方向的校验断点
+//   - name 迁移任务名，同一迁移任务的多个 pod 需一致
+//   - 需在启动校验、注册路由之前调用
+func (s *Scheduler[T, Pdr]) UseStateStore(ctx context.Context, store stateStorex.StateStore, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	snap, err := stateStorex.LoadSnapshot(ctx, store, name)
+	if err != nil {
+		return fmt.Errorf("加载迁移进度失败: %w", err)
+	}
+	s.store = store
+	s.stateName = name
+	if snap.IsEmpty() {
+		s.l.Info("未找到已保存的迁移进度，从头开始", logx.String("name", name))
+		return nil
+	}
+
+	if snap.Pattern != "" && snap.Pattern != s.pool.Pattern.Load() {
+		if err = s.pool.UpdatePattern(snap.Pattern); err != nil {
+			return fmt.Errorf("恢复双写模式失败: %w", err)
+		}
+	}
+	if snap.Pattern != "" {
+		s.Pattern = snap.Pattern
+	}
+	if snap.State != "" {
+		s.State = MigrationState(snap.State)
+	}
+	if len(snap.Stats) > 0 {
+		if err = json.Unmarshal(snap.Stats, &s.Stats); err != nil {
+			return fmt.Errorf("恢复统计信息失败: %w", err)
+		}
+	}
+	s.cpLock.Lock()
+	for direction, cp := range snap.Checkpoints {
+		s.checkpoints[direction] = cp
+	}
+	s.cpLock.Unlock()
+	s.l.Info("已恢复迁移进度", logx.String("name", name),
+		logx.String("pattern", s.Pattern), logx.String("state", string(s.State)))
+	return nil
+}
+
+// saveState 持久化双写模式、迁移状态和统计信息，调用方不能持有 s.lock
+//   - 在 s.lock 内取状态快照，持久化在释放 s.lock 之后进行，不让存储的延迟阻塞 Status、Metrics
+//   - 持久化由 saveLock 串行，每次写入最新的状态，避免并发写入时旧状态覆盖新状态
+func (s *Scheduler[T, Pdr]) saveState() {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	s.lock.Lock()
+	store, name := s.store, s.stateName
+	pattern, state, stats := s.Pattern, s.State, s.Stats
+	s.lock.Unlock()
+	if store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := store.Save(ctx, name, stateStorex.FieldPattern, []byte(pattern))
+	if err == nil {
+		err = store.Save(ctx, name, stateStorex.FieldState, []byte(state))
+	}
+	if err == nil {
+		err = stateStorex.SaveJSON(ctx, store, name, stateStorex.FieldStats, stats)
+	}
+	if err != nil {
+		s.l.Error("持久化迁移进度失败", logx.Error(err), logx.String("name", name))
+	}
+}
+
 // newValidator 创建校验器
 func (s *Scheduler[T, Pdr]) newValidator() (*validator.Validator[T, Pdr], error) {
+	var v *validator.Validator[T, Pdr]
 	switch s.Pattern {
 	case doubleWritePoolx.PatternSrcOnly, doubleWritePoolx.PatternSrcFirst:
-		return validator.NewValidator[T, Pdr](s.src, s.dst, "SRC", s.l, &validator.MessageQueueStr[Pdr]{Producer: s.producer, MessageQueueTopic: s.MessageQueueTopic}), nil
+		v = validator.NewValidator[T, Pdr](s.src, s.dst, "SRC", s.l, &validator.MessageQueueStr[Pdr]{Producer: s.producer, MessageQueueTopic: s.MessageQueueTopic})
 	case doubleWritePoolx.PatternDstFirst, doubleWritePoolx.PatternDstOnly:
 		//return validator.NewValidator[T, Pdr](s.dst, s.src, "DST", s.l, s.producer), nil
-		return validator.NewValidator[T, Pdr](s.dst, s.src, "DST", s.l, &validator.MessageQueueStr[Pdr]{Producer: s.producer, MessageQueueTopic: s.MessageQueueTopic}), nil
+		v = validator.NewValidator[T, Pdr](s.dst, s.src, "DST", s.l, &validator.MessageQueueStr[Pdr]{Producer: s.producer, MessageQueueTopic: s.MessageQueueTopic})
 	default:
 		return nil, fmt.Errorf("未知的 Pattern %s", s.Pattern)
 	}
+	return v.OnInconsistent(s.recordInconsistent), nil
+}
+
+// recordInconsistent 累计各类型的不一致数据条数
+func (s *Scheduler[T, Pdr]) recordInconsistent(typ string) {
+	s.incLock.Lock()
+	defer s.incLock.Unlock()
+	s.inconsistent[typ]++
+}
+
+// SchedulerMetrics 调度器监控指标
+type SchedulerMetrics struct {
+	Name               string
+	Pattern            string
+	State              MigrationState
+	FullValidationRuns int
+	IncrValidationRuns int
+	DataDiscrepancies  int                             // 最近一次完整全量校验发现的不一致数量
+	Checkpoints        map[string]validator.Checkpoint // keyset 全量校验进度，key 为校验方向 SRC/DST
+	Inconsistencies    map[string]int64                // 本进程累计发现的不一致数据条数，key 为不一致类型
+}
+
+// Metrics 当前的监控指标快照
+func (s *Scheduler[T, Pdr]) Metrics() SchedulerMetrics {
+	s.lock.Lock()
+	res := SchedulerMetrics{
+		Name:               s.Name(),
+		Pattern:            s.Pattern,
+		State:              s.State,
+		FullValidationRuns: s.Stats.FullValidationRuns,
+		IncrValidationRuns: s.Stats.IncrValidationRuns,
+		DataDiscrepancies:  s.Stats.DataDiscrepancies,
+	}
+	s.lock.Unlock()
+
+	s.cpLock.Lock()
+	res.Checkpoints = make(map[string]validator.Checkpoint, len(s.checkpoints))
+	for k, v := range s.checkpoints {
+		res.Checkpoints[k] = v
+	}
+	s.cpLock.Unlock()
+
+	s.incLock.Lock()
+	res.Inconsistencies = make(map[string]int64, len(s.inconsistent))
+	for k, v := range s.inconsistent {
+		res.Inconsistencies[k] = v
+	}
+	s.incLock.Unlock()
+	return res
+}
+
+// Name 迁移的表名，取自 Entity.Types()
+func (s *Scheduler[T, Pdr]) Name() string {
+	var t T
+	return t.Types()
+}
+
+// ValidateOnce 同步执行一次完整的全量校验，返回发现的不一致数据条数
+//   - 总是从头校验，不使用也不更新 keyset 断点，用于切换模式前的一致性确认
+//   - ctx 被取消或超时时校验不完整，返回 ctx 的错误
+func (s *Scheduler[T, Pdr]) ValidateOnce(ctx context.Context) (int64, error) {
+	s.lock.Lock()
+	v, err := s.newValidator()
+	if err != nil {
+		s.lock.Unlock()
+		return 0, err
+	}
+	if s.config.KeysetBatchSize > 0 {
+		v.Keyset().BatchSize(s.config.KeysetBatchSize)
+	}
+	s.Stats.FullValidationRuns++
+	s.lock.Unlock()
+	s.saveState()
+
+	if err = v.Validate(ctx); err != nil {
+		return 0, err
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	cnt := v.Inconsistencies()
+
+	s.lock.Lock()
+	s.Stats.DataDiscrepancies = int(cnt)
+	s.lock.Unlock()
+	s.saveState()
+	return cnt, nil
+}
+
+// TableStatus 单表迁移状态
+type TableStatus struct {
+	Name      string            `json:"name"`                 // 表名
+	Group     string            `json:"group,omitempty"`      // 迁移计划中的分组
+	DependsOn []string          `json:"depends_on,omitempty"` // 迁移计划中依赖的表
+	Pattern   string            `json:"pattern"`              // 双写模式
+	State     MigrationState    `json:"state"`                // 迁移状态
+	Stats     MigrationStats    `json:"stats"`                // 统计信息
+	Health    map[string]string `json:"health,omitempty"`     // 健康检查失败项
+}
+
+// Status 当前迁移状态，不依赖 http 上下文
+func (s *Scheduler[T, Pdr]) Status() TableStatus {
+	health := s.pool.HealthCheck()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := TableStatus{
+		Name:    s.Name(),
+		Pattern: s.Pattern,
+		State:   s.State,
+		Stats:   s.Stats,
+	}
+	if len(health) > 0 {
+		res.Health = make(map[string]string, len(health))
+		for k, err := range health {
+			res.Health[k] = err.Error()
+		}
+	}
+	return res
 }
 
 func (s *Scheduler[T, Pdr]) GetStatus(c *gin.Context) (ginx.Result, error) {
@@ -306,13 +578,21 @@ func (s *Scheduler[T, Pdr]) GetStatus(c *gin.Context) (ginx.Result, error) {
 	health := s.pool.HealthCheck()
 	metrics := s.pool.GetMetrics()
 
+	s.cpLock.Lock()
+	checkpoints := make(map[string]validator.Checkpoint, len(s.checkpoints))
+	for k, v := range s.checkpoints {
+		checkpoints[k] = v
+	}
+	s.cpLock.Unlock()
+
 	status := map[string]interface{}{
-		"current_state":   s.State,
-		"current_pattern": s.Pattern,
-		"migration_stats": s.Stats,
-		"pool_health":     health,
-		"pool_metrics":    metrics,
-		"uptime":          time.Since(s.Stats.StartTime).String(),
+		"current_state":          s.State,
+		"current_pattern":        s.Pattern,
+		"migration_stats":        s.Stats,
+		"pool_health":            health,
+		"pool_metrics":           metrics,
+		"validation_checkpoints": checkpoints,
+		"uptime":                 time.Since(s.Stats.StartTime).String(),
 	}
 
 	return ginx.Result{
@@ -355,81 +635,73 @@ func (s *Scheduler[T, Pdr]) AutoMigrate(c *gin.Context) (ginx.Result, error) {
 		Msg: "自动迁移流程已启动",
 	}, nil
 }
+
+// executeMigrationPlan 按 SrcOnly -> SrcFirst -> 全量校验 -> DstFirst -> DstOnly 推进，
+// 任一步切换失败【如补偿队列有积压被双写池拒绝】时停在当前模式，不持久化未生效的模式
 func (s *Scheduler[T, Pdr]) executeMigrationPlan() {
 	s.l.Info("开始自动迁移流程")
 
 	// 阶段1: 只写源库
-	err := s.pool.UpdatePattern(doubleWritePoolx.PatternSrcOnly)
-	if err != nil {
+	if err := s.SwitchPattern(doubleWritePoolx.PatternSrcOnly); err != nil {
 		s.l.Error("自动迁移失败, 更新双写模式失败", logx.Error(err))
+		return
 	}
-	s.State = StateSrcOnly
 
 	// 阶段2: 双写，源库优先 + 全量校验
 	time.Sleep(5 * time.Second) // 等待稳定
-	err = s.pool.UpdatePattern(doubleWritePoolx.PatternSrcFirst)
-	if err != nil {
+	if err := s.SwitchPattern(doubleWritePoolx.PatternSrcFirst); err != nil {
 		s.l.Error("自动迁移失败, 更新双写模式失败", logx.Error(err))
+		return
 	}
-	s.State = StateSrcFirst
 
 	// 启动全量校验
-	v, _ := s.newValidator()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
+	cnt, err := s.ValidateOnce(ctx)
+	if err != nil {
+		s.l.Error("迁移失败，全量校验未通过", logx.Error(err))
+		return
+	}
+	if cnt > 0 {
+		s.l.Error("迁移失败，全量校验发现不一致数据", logx.Int64("inconsistencies", cnt))
+		return
+	}
+	s.l.Info("全量校验通过，切换到目标库优先")
 
-	if err = v.Validate(ctx); err == nil {
-		s.l.Info("全量校验通过，切换到目标库优先")
-
-		// 阶段3: 双写，目标库优先
-		err = s.pool.UpdatePattern(doubleWritePoolx.PatternDstFirst)
-		if err != nil {
-			s.l.Error("自动迁移失败, 更新双写模式失败", logx.Error(err))
-		}
-		s.State = StateDstFirst
-
-		// 阶段4: 只写目标库
-		time.Sleep(5 * time.Second)
-		err = s.pool.UpdatePattern(doubleWritePoolx.PatternDstOnly)
-		if err != nil {
-			s.l.Error("自动迁移失败, 更新双写模式失败", logx.Error(err))
-		}
-		s.State = StateDstOnly
+	// 阶段3: 双写，目标库优先
+	if err = s.SwitchPattern(doubleWritePoolx.PatternDstFirst); err != nil {
+		s.l.Error("自动迁移失败, 更新双写模式失败", logx.Error(err))
+		return
+	}
 
-		s.l.Info("数据迁移完成")
-	} else {
-		s.l.Error("迁移失败，全量校验未通过", logx.Error(err))
+	// 阶段4: 只写目标库
+	time.Sleep(5 * time.Second)
+	if err = s.SwitchPattern(doubleWritePoolx.PatternDstOnly); err != nil {
+		s.l.Error("自动迁移失败, 更新双写模式失败", logx.Error(err))
+		return
 	}
+	s.l.Info("数据迁移完成")
 }
 
-// 自动升级
+// autoPromoteIfReady 数据一致时自动升级到下一个双写模式，双写池拒绝切换时保持当前模式
 func (s *Scheduler[T, Pdr]) autoPromoteIfReady() {
-	if !s.config.EnableAutoPromotion {
+	s.lock.Lock()
+	enabled, state, discrepancies := s.config.EnableAutoPromotion, s.State, s.Stats.DataDiscrepancies
+	s.lock.Unlock()
+	if !enabled || discrepancies != 0 {
 		return
 	}
 
-	switch s.State {
+	switch state {
 	case StateSrcFirst:
-		if s.Stats.DataDiscrepancies == 0 {
-			s.l.Info("数据一致，自动切换到双写目标库优先模式")
-			err := s.pool.UpdatePattern(doubleWritePoolx.PatternDstFirst)
-			if err != nil {
-				s.l.Error("自动切换到双写目标库优先模式, 更新双写模式失败", logx.Error(err))
-			}
-			s.State = StateDstFirst
-			s.Stats.CurrentState = StateDstFirst
-			s.Pattern = doubleWritePoolx.PatternDstFirst
+		s.l.Info("数据一致，自动切换到双写目标库优先模式")
+		if err := s.SwitchPattern(doubleWritePoolx.PatternDstFirst); err != nil {
+			s.l.Error("自动切换到双写目标库优先模式, 更新双写模式失败", logx.Error(err))
 		}
 	case StateDstFirst:
-		if s.Stats.DataDiscrepancies == 0 {
-			s.l.Info("数据一致，自动切换到只写目标库模式")
-			err := s.pool.UpdatePattern(doubleWritePoolx.PatternDstOnly)
-			if err != nil {
-				s.l.Error("自动切换到只写目标库模式, 更新双写模式失败", logx.Error(err))
-			}
-			s.State = StateDstOnly
-			s.Stats.CurrentState = StateDstOnly
-			s.Pattern = doubleWritePoolx.PatternDstOnly
+		s.l.Info("数据一致，自动切换到只写目标库模式")
+		if err := s.SwitchPattern(doubleWritePoolx.PatternDstOnly); err != nil {
+			s.l.Error("自动切换到只写目标库模式, 更新双写模式失败", logx.Error(err))
 		}
 	}
 }
@@ -440,6 +712,13 @@ type StartIncrRequest struct {
 	Interval int64 `json:"interval"` // 睡眠间隔
 }
 
+// SetConfig 设置调度器配置
+func (s *Scheduler[T, Pdr]) SetConfig(cfg SchedulerConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.config = cfg
+}
+
 // SetMessageQueueTopic  设置消息队列主题Topic
 func (s *Scheduler[T, Pdr]) SetMessageQueueTopic(Topic string) {
 	s.MessageQueueTopic = Topic
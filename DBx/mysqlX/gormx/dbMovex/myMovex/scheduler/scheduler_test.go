@@ -1,8 +1,11 @@
 package scheduler
 
 import (
+	"context"
 	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/doubleWritePoolx"
 	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/stateStorex"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/validator"
 	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/hgg-6/pkgTool/v2/channelx/mqX/kafkaX/saramaX/producerX"
 	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
@@ -13,7 +16,9 @@ import (
 	"gorm.io/gorm"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -303,6 +308,179 @@ func TestNewValidator(t *testing.T) {
 	require.Nil(t, validator)
 }
 
+// TestSchedulerKeysetCheckpoint 测试 keyset 断点按校验方向记录
+func TestSchedulerKeysetCheckpoint(t *testing.T) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	scheduler := NewScheduler[events.TestUser, any](l, nil, nil, nil, nil)
+	scheduler.SetConfig(SchedulerConfig{KeysetBatchSize: 500})
+	assert.Equal(t, 500, scheduler.config.KeysetBatchSize)
+
+	// 源库优先时以源库为准
+	scheduler.Pattern = doubleWritePoolx.PatternSrcFirst
+	assert.Equal(t, "SRC", scheduler.direction())
+	scheduler.setCheckpoint(scheduler.direction(), validator.Checkpoint{BaseToTarget: 1000, TargetToBase: 800})
+
+	// 目标库优先时以目标库为准，断点互不影响
+	scheduler.Pattern = doubleWritePoolx.PatternDstFirst
+	assert.Equal(t, "DST", scheduler.direction())
+	assert.Equal(t, validator.Checkpoint{}, scheduler.getCheckpoint("DST"))
+	assert.Equal(t, validator.Checkpoint{BaseToTarget: 1000, TargetToBase: 800}, scheduler.getCheckpoint("SRC"))
+}
+
+// blockStore Save 阻塞到 release 关闭
+type blockStore struct {
+	mapStore
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (b *blockStore) Save(ctx context.Context, name string, field string, val []byte) error {
+	b.saving <- struct{}{}
+	<-b.release
+	return b.mapStore.Save(ctx, name, field, val)
+}
+
+// TestSchedulerCheckpointSaveUnlocked 测试持久化断点时不持有 cpLock，读取断点不被存储延迟阻塞
+func TestSchedulerCheckpointSaveUnlocked(t *testing.T) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	scheduler := NewScheduler[events.TestUser, any](l, nil, nil, nil, nil)
+	store := &blockStore{mapStore: mapStore{data: make(map[string][]byte)},
+		saving: make(chan struct{}), release: make(chan struct{})}
+	scheduler.store, scheduler.stateName = store, "user"
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scheduler.setCheckpoint("SRC", validator.Checkpoint{BaseToTarget: 100})
+	}()
+	<-store.saving
+	// 存储阻塞中，内存断点已更新且可读取
+	assert.Equal(t, validator.Checkpoint{BaseToTarget: 100}, scheduler.getCheckpoint("SRC"))
+	assert.Equal(t, int64(100), scheduler.Metrics().Checkpoints["SRC"].BaseToTarget)
+	close(store.release)
+	<-done
+	data, _ := store.Load(context.Background(), "user")
+	assert.NotEmpty(t, data)
+}
+
+// TestSchedulerStateSaveUnlocked 测试持久化迁移进度时不持有 s.lock，读取状态不被存储延迟阻塞
+func TestSchedulerStateSaveUnlocked(t *testing.T) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	emptyDB := &gorm.DB{Config: &gorm.Config{}}
+	pool := doubleWritePoolx.NewDoubleWritePool(emptyDB, emptyDB, l, doubleWritePoolx.DoubleWriteConfig{RetryAttempts: 1})
+	scheduler := NewScheduler[events.TestUser, any](l, nil, nil, pool, nil)
+	store := &blockStore{mapStore: mapStore{data: make(map[string][]byte)},
+		saving: make(chan struct{}, 3), release: make(chan struct{})}
+	scheduler.store, scheduler.stateName = store, "user"
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, scheduler.SwitchPattern(doubleWritePoolx.PatternSrcFirst))
+	}()
+	<-store.saving
+	// 存储阻塞中，内存状态已更新且可读取
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, scheduler.Metrics().Pattern)
+	close(store.release)
+	<-done
+	data, _ := store.Load(context.Background(), "user")
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, string(data[stateStorex.FieldPattern]))
+}
+
+// backlogQueue 只记录积压数的补偿队列
+type backlogQueue struct {
+	backlog atomic.Int64
+}
+
+func (q *backlogQueue) Push(ctx context.Context, entry doubleWritePoolx.CompensateEntry) error {
+	q.backlog.Add(1)
+	return nil
+}
+
+func (q *backlogQueue) Backlog() int64 {
+	return q.backlog.Load()
+}
+
+// TestSchedulerPromoteRefused 测试双写池拒绝推进时不更新、不持久化被拒绝的模式
+func TestSchedulerPromoteRefused(t *testing.T) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	store := &mapStore{data: make(map[string][]byte)}
+	emptyDB := &gorm.DB{Config: &gorm.Config{}}
+	queue := &backlogQueue{}
+	pool := doubleWritePoolx.NewDoubleWritePool(emptyDB, emptyDB, l, doubleWritePoolx.DoubleWriteConfig{
+		RetryAttempts: 1, Compensate: doubleWritePoolx.CompensateConfig{Queue: queue}})
+	scheduler := NewScheduler[events.TestUser, any](l, nil, nil, pool, nil)
+	require.NoError(t, scheduler.UseStateStore(context.Background(), store, "user"))
+	require.NoError(t, scheduler.SwitchPattern(doubleWritePoolx.PatternSrcFirst))
+	scheduler.SetConfig(SchedulerConfig{EnableAutoPromotion: true})
+
+	// 补偿队列有积压，双写池拒绝推进
+	queue.backlog.Store(1)
+	scheduler.autoPromoteIfReady()
+	assert.Equal(t, StateSrcFirst, scheduler.Status().State)
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, pool.Pattern.Load())
+	data, _ := store.Load(context.Background(), "user")
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, string(data[stateStorex.FieldPattern]))
+
+	// 积压清空后正常推进
+	queue.backlog.Store(0)
+	scheduler.autoPromoteIfReady()
+	assert.Equal(t, StateDstFirst, scheduler.Status().State)
+	data, _ = store.Load(context.Background(), "user")
+	assert.Equal(t, doubleWritePoolx.PatternDstFirst, string(data[stateStorex.FieldPattern]))
+}
+
+// mapStore 仅测试用的内存进度存储
+type mapStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *mapStore) Save(ctx context.Context, name string, field string, val []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[name+"/"+field] = val
+	return nil
+}
+
+func (m *mapStore) Load(ctx context.Context, name string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[string][]byte)
+	for k, v := range m.data {
+		if field, ok := strings.CutPrefix(k, name+"/"); ok {
+			res[field] = v
+		}
+	}
+	return res, nil
+}
+
+// TestSchedulerStateStore 测试重启后从进度存储恢复
+func TestSchedulerStateStore(t *testing.T) {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	store := &mapStore{data: make(map[string][]byte)}
+	emptyDB := &gorm.DB{Config: &gorm.Config{}}
+	cfg := doubleWritePoolx.DoubleWriteConfig{RetryAttempts: 1, StateStore: store, StateName: "user"}
+
+	// 第一个 pod：切换模式、记录断点
+	pool := doubleWritePoolx.NewDoubleWritePool(emptyDB, emptyDB, l, cfg)
+	scheduler := NewScheduler[events.TestUser, any](l, nil, nil, pool, nil)
+	require.NoError(t, scheduler.UseStateStore(context.Background(), store, "user"))
+	_, err := scheduler.SrcFirst(nil)
+	require.NoError(t, err)
+	scheduler.setCheckpoint("SRC", validator.Checkpoint{BaseToTarget: 1000})
+
+	// 重启后的 pod：双写池和调度器都恢复到重启前的进度
+	newPool := doubleWritePoolx.NewDoubleWritePool(emptyDB, emptyDB, l, cfg)
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, newPool.Pattern.Load())
+	newScheduler := NewScheduler[events.TestUser, any](l, nil, nil, newPool, nil)
+	require.NoError(t, newScheduler.UseStateStore(context.Background(), store, "user"))
+	assert.Equal(t, doubleWritePoolx.PatternSrcFirst, newScheduler.Pattern)
+	assert.Equal(t, StateSrcFirst, newScheduler.State)
+	assert.Equal(t, StateSrcFirst, newScheduler.Stats.CurrentState)
+	assert.Equal(t, validator.Checkpoint{BaseToTarget: 1000}, newScheduler.getCheckpoint("SRC"))
+}
+
 // BenchmarkSchedulerPatternSwitch 性能测试：模式切换
 func BenchmarkSchedulerPatternSwitch(b *testing.B) {
 	srcDB := setupTestSrcDB()
@@ -0,0 +1,59 @@
+package stateStorex
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StateModel 迁移进度表，一个迁移任务的每一项状态占一行
+type StateModel struct {
+	Name  string `gorm:"primaryKey;type:varchar(128)"`
+	Field string `gorm:"primaryKey;type:varchar(128)"`
+	Value []byte `gorm:"type:blob"`
+	Utime int64
+}
+
+func (StateModel) TableName() string {
+	return "db_move_states"
+}
+
+// GormStateStore 基于 gorm 表的迁移进度存储
+type GormStateStore struct {
+	db *gorm.DB
+}
+
+// NewGormStateStore 创建基于 gorm 的进度存储，会自动建表
+//   - db 建议使用独立于双写池的连接，避免进度表也被双写
+func NewGormStateStore(db *gorm.DB) (*GormStateStore, error) {
+	if err := db.AutoMigrate(&StateModel{}); err != nil {
+		return nil, err
+	}
+	return &GormStateStore{db: db}, nil
+}
+
+func (g *GormStateStore) Save(ctx context.Context, name string, field string, val []byte) error {
+	return g.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"value", "utime"}),
+	}).Create(&StateModel{
+		Name:  name,
+		Field: field,
+		Value: val,
+		Utime: time.Now().UnixMilli(),
+	}).Error
+}
+
+func (g *GormStateStore) Load(ctx context.Context, name string) (map[string][]byte, error) {
+	var rows []StateModel
+	err := g.db.WithContext(ctx).Where("name = ?", name).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]byte, len(rows))
+	for _, row := range rows {
+		res[row.Field] = row.Value
+	}
+	return res, nil
+}
@@ -0,0 +1,47 @@
+package stateStorex
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStateStore 基于 redis hash 的迁移进度存储，一个迁移任务对应一个 hash
+type RedisStateStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStateStore 创建基于 redis 的进度存储，key 默认为 db_move:state:{name}
+func NewRedisStateStore(client redis.Cmdable) *RedisStateStore {
+	return &RedisStateStore{
+		client: client,
+		prefix: "db_move:state:",
+	}
+}
+
+// SetPrefix 设置 key 前缀
+func (r *RedisStateStore) SetPrefix(prefix string) *RedisStateStore {
+	r.prefix = prefix
+	return r
+}
+
+func (r *RedisStateStore) Save(ctx context.Context, name string, field string, val []byte) error {
+	return r.client.HSet(ctx, r.key(name), field, val).Err()
+}
+
+func (r *RedisStateStore) Load(ctx context.Context, name string) (map[string][]byte, error) {
+	vals, err := r.client.HGetAll(ctx, r.key(name)).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]byte, len(vals))
+	for field, val := range vals {
+		res[field] = []byte(val)
+	}
+	return res, nil
+}
+
+func (r *RedisStateStore) key(name string) string {
+	return r.prefix + name
+}
@@ -0,0 +1,105 @@
+package stateStorex
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/validator"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// memStore 仅测试用的内存存储
+type memStore struct {
+	mu   sync.Mutex
+	data map[string]map[string][]byte
+}
+
+func (m *memStore) Save(ctx context.Context, name string, field string, val []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		m.data = make(map[string]map[string][]byte)
+	}
+	if m.data[name] == nil {
+		m.data[name] = make(map[string][]byte)
+	}
+	m.data[name][field] = val
+	return nil
+}
+
+func (m *memStore) Load(ctx context.Context, name string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[string][]byte)
+	for k, v := range m.data[name] {
+		res[k] = v
+	}
+	return res, nil
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	testSnapshot(t, &memStore{})
+}
+
+// TestRedisStateStore 需要本地 redis
+func TestRedisStateStore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("无法连接 redis: %v", err)
+	}
+	store := NewRedisStateStore(client).SetPrefix("test:db_move:state:")
+	defer client.Del(context.Background(), "test:db_move:state:user")
+	testSnapshot(t, store)
+}
+
+// TestGormStateStore 需要本地 mysql
+func TestGormStateStore(t *testing.T) {
+	db, err := gorm.Open(mysql.Open("root:root@tcp(localhost:13306)/src_db?parseTime=true"), &gorm.Config{})
+	if err != nil {
+		t.Skipf("无法连接数据库: %v", err)
+	}
+	store, err := NewGormStateStore(db)
+	require.NoError(t, err)
+	defer db.Where("name = ?", "user").Delete(&StateModel{})
+	testSnapshot(t, store)
+}
+
+func testSnapshot(t *testing.T, store StateStore) {
+	ctx := context.Background()
+
+	snap, err := LoadSnapshot(ctx, store, "user")
+	require.NoError(t, err)
+	assert.True(t, snap.IsEmpty())
+
+	require.NoError(t, store.Save(ctx, "user", FieldPattern, []byte("src_first")))
+	require.NoError(t, store.Save(ctx, "user", FieldState, []byte("src_first")))
+	require.NoError(t, SaveJSON(ctx, store, "user", FieldStats, map[string]int{"full_validation_runs": 2}))
+	require.NoError(t, SaveCheckpoint(ctx, store, "user", "SRC", validator.Checkpoint{BaseToTarget: 100, TargetToBase: 50}))
+	// 同一项再次保存覆盖旧值
+	require.NoError(t, SaveCheckpoint(ctx, store, "user", "SRC", validator.Checkpoint{BaseToTarget: 200, TargetToBase: 150}))
+	require.NoError(t, SaveCheckpoint(ctx, store, "user", "DST", validator.Checkpoint{BaseToTarget: 10}))
+
+	snap, err = LoadSnapshot(ctx, store, "user")
+	require.NoError(t, err)
+	assert.False(t, snap.IsEmpty())
+	assert.Equal(t, "src_first", snap.Pattern)
+	assert.Equal(t, "src_first", snap.State)
+	assert.JSONEq(t, `{"full_validation_runs":2}`, string(snap.Stats))
+	assert.Equal(t, map[string]validator.Checkpoint{
+		"SRC": {BaseToTarget: 200, TargetToBase: 150},
+		"DST": {BaseToTarget: 10},
+	}, snap.Checkpoints)
+
+	// 不同迁移任务互不影响
+	other, err := LoadSnapshot(ctx, store, "order")
+	require.NoError(t, err)
+	assert.True(t, other.IsEmpty())
+}
@@ -0,0 +1,85 @@
+package stateStorex
+
+/*
+	=================================
+	此文件主要定义迁移进度持久化存储，pod 重启后可从中恢复双写模式、校验断点、统计信息
+	=================================
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/validator"
+)
+
+// StateStore 迁移进度存储
+//   - 以迁移任务名 name 为维度，每个任务下按 field 分项保存，各项互不覆盖
+//   - 双写池与调度器各自只写自己关心的项，多个 pod 共享同一 name 即可共享进度
+type StateStore interface {
+	// Save 保存迁移任务 name 下的一项状态
+	Save(ctx context.Context, name string, field string, val []byte) error
+	// Load 读取迁移任务 name 下的全部状态，不存在时返回空 map
+	Load(ctx context.Context, name string) (map[string][]byte, error)
+}
+
+const (
+	FieldPattern          = "pattern"     // 双写模式
+	FieldState            = "state"       // 调度器迁移状态
+	FieldStats            = "stats"       // 调度器统计信息【json】
+	FieldCheckpointPrefix = "checkpoint:" // 校验断点前缀，后接校验方向 SRC/DST【json】
+)
+
+// Snapshot 迁移进度快照
+type Snapshot struct {
+	Pattern     string                          // 双写模式
+	State       string                          // 迁移状态
+	Stats       []byte                          // 统计信息原始 json，由调度器自行解码
+	Checkpoints map[string]validator.Checkpoint // 各校验方向的 keyset 断点
+}
+
+// IsEmpty 是否没有任何已保存的进度
+func (s Snapshot) IsEmpty() bool {
+	return s.Pattern == "" && s.State == "" && len(s.Stats) == 0 && len(s.Checkpoints) == 0
+}
+
+// LoadSnapshot 读取迁移任务 name 的进度快照
+func LoadSnapshot(ctx context.Context, store StateStore, name string) (Snapshot, error) {
+	snap := Snapshot{Checkpoints: make(map[string]validator.Checkpoint)}
+	fields, err := store.Load(ctx, name)
+	if err != nil {
+		return snap, err
+	}
+	for field, val := range fields {
+		switch {
+		case field == FieldPattern:
+			snap.Pattern = string(val)
+		case field == FieldState:
+			snap.State = string(val)
+		case field == FieldStats:
+			snap.Stats = val
+		case strings.HasPrefix(field, FieldCheckpointPrefix):
+			var cp validator.Checkpoint
+			if err = json.Unmarshal(val, &cp); err != nil {
+				return snap, err
+			}
+			snap.Checkpoints[strings.TrimPrefix(field, FieldCheckpointPrefix)] = cp
+		}
+	}
+	return snap, nil
+}
+
+// SaveCheckpoint 保存某个校验方向的断点
+func SaveCheckpoint(ctx context.Context, store StateStore, name, direction string, cp validator.Checkpoint) error {
+	return SaveJSON(ctx, store, name, FieldCheckpointPrefix+direction, cp)
+}
+
+// SaveJSON 以 json 格式保存一项状态
+func SaveJSON(ctx context.Context, store StateStore, name, field string, v any) error {
+	val, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return store.Save(ctx, name, field, val)
+}
@@ -572,7 +572,7 @@ func (m *MoveTest) TestScheduler() {
 func (m *MoveTest) TestConsumer() {
 	var addr []string = []string{"localhost:9094"}
 	cfg := sarama.NewConfig()
-	cm := consumerx.NewConsumer(consumerx.ConsumerConf{Addr: addr, GroupId: "test_group", SaramaConf: cfg}, consumerx.DbConf{SrcDb: m.srcDb, DstDb: m.dstDb}, initLog())
+	cm := consumerx.NewConsumer[events.TestUser](consumerx.ConsumerConf{Addr: addr, GroupId: "test_group", SaramaConf: cfg}, consumerx.DbConf{SrcDb: m.srcDb, DstDb: m.dstDb}, initLog())
 	err := cm.InitConsumer(context.Background(), "dbMove")
 	assert.NoError(m.T(), err)
 }
@@ -17,9 +17,14 @@ import (
 	"github.com/hgg-6/pkgTool/v2/sliceX"
 	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// errBackoff 全量模式【sleepInterval <= 0】下查询出错后的重试间隔
+const errBackoff = time.Second
+
 type MessageQueueStr[Pdr any] struct {
 	//Producer          messageQueuex.ProducerIn[Pdr]
 	Producer          mqX.Producer
@@ -44,6 +49,24 @@ type Validator[T myMovex.Entity, Pdr any] struct {
 	// > 0 就认为睡眠
 	sleepInterval time.Duration
 	fromBase      func(ctx context.Context, offset int) (T, error)
+
+	// keyset 游标模式：按 id > lastID 分批扫描，替代 offset 逐条扫描
+	keyset       bool
+	cpMu         sync.Mutex
+	checkpoint   Checkpoint          // 当前校验进度
+	onCheckpoint func(cp Checkpoint) // 每校验完一批回调，调用方可据此持久化断点
+
+	inconsistencies atomic.Int64     // 本校验器发现的不一致数据条数
+	onInconsistent  func(typ string) // 每发现一条不一致数据回调，typ 为不一致类型
+}
+
+// Checkpoint keyset 校验断点，记录两个方向各自已校验到的最大 id
+type Checkpoint struct {
+	BaseToTarget int64 `json:"base_to_target"` // base -> target 已校验到的 id
+	TargetToBase int64 `json:"target_to_base"` // target -> base 已校验到的 id
+	// Inconsistencies 到这个断点为止累计发现的不一致数据条数，含从断点恢复之前发现的；
+	// 另一个方向未完成的批次续跑时会重新计数，只会偏大不会偏小
+	Inconsistencies int64 `json:"inconsistencies,omitempty"`
 }
 
 func NewValidator[T myMovex.Entity, Pdr any](base *gorm.DB, target *gorm.DB, direction string, l logx.Loggerx, producerConf *MessageQueueStr[Pdr]) *Validator[T, Pdr] {
@@ -77,8 +100,11 @@ func (v *Validator[T, Pdr]) Validate(ctx context.Context) error {
 	return eg.Wait()
 }
 
-// target -> base
+// base -> target
 func (v *Validator[T, Pdr]) validateBaseToTarget(ctx context.Context) error {
+	if v.keyset {
+		return v.validateBaseToTargetKeyset(ctx)
+	}
 	offset := 0
 	for {
 		src, err := v.fromBase(ctx, offset)
@@ -96,9 +122,7 @@ func (v *Validator[T, Pdr]) validateBaseToTarget(ctx context.Context) error {
 		if err != nil {
 			// 查询出错时不递增 offset，避免跳过该记录（瞬态错误重试同一位置）。
 			v.l.Error("base -> target 查询 base 失败", logx.Error(err))
-			if v.sleepInterval > 0 {
-				time.Sleep(v.sleepInterval)
-			}
+			v.backoff(ctx)
 			continue
 		}
 
@@ -116,8 +140,7 @@ func (v *Validator[T, Pdr]) validateBaseToTarget(ctx context.Context) error {
 			equal := src.CompareTo(dst)
 			if !equal {
 				// 要丢一条消息到 Kafka 上
-				v.notify(src.ID(), events.InconsistentEventTypeNEQ)
-				v.l.Warn("base -> target 数据不一致", logx.Int64("id", src.ID()))
+				v.notifyNEQ(src, dst)
 			}
 		default:
 			v.l.Error("base -> target 查询 target 失败",
@@ -148,6 +171,137 @@ func (v *Validator[T, Pdr]) SleepInterval(interval time.Duration) *Validator[T,
 	return v
 }
 
+// Keyset 开启游标分页模式：按 id > lastID 每次取 batchSize 条，整批用一次 IN 查询比对目标表。
+// 大表下避免 offset 扫描的 O(n²) 开销，也不会因为源表写入导致漏校验或重复校验。
+func (v *Validator[T, Pdr]) Keyset() *Validator[T, Pdr] {
+	v.keyset = true
+	return v
+}
+
+// BatchSize 设置每批校验的数量，<= 0 时忽略
+func (v *Validator[T, Pdr]) BatchSize(size int) *Validator[T, Pdr] {
+	if size > 0 {
+		v.batchSize = size
+	}
+	return v
+}
+
+// Resume 从断点恢复，仅 keyset 模式生效，Inconsistencies 从断点中记录的条数继续累计
+func (v *Validator[T, Pdr]) Resume(cp Checkpoint) *Validator[T, Pdr] {
+	v.cpMu.Lock()
+	defer v.cpMu.Unlock()
+	v.checkpoint = cp
+	v.inconsistencies.Store(cp.Inconsistencies)
+	return v
+}
+
+// OnCheckpoint 设置断点回调，每校验完一批调用一次（两个方向并发校验，回调需自行保证并发安全）
+func (v *Validator[T, Pdr]) OnCheckpoint(fn func(cp Checkpoint)) *Validator[T, Pdr] {
+	v.onCheckpoint = fn
+	return v
+}
+
+// OnInconsistent 设置不一致数据回调，每发现一条调用一次（两个方向并发校验，回调需自行保证并发安全）
+func (v *Validator[T, Pdr]) OnInconsistent(fn func(typ string)) *Validator[T, Pdr] {
+	v.onInconsistent = fn
+	return v
+}
+
+// Checkpoint 返回当前校验进度
+func (v *Validator[T, Pdr]) Checkpoint() Checkpoint {
+	v.cpMu.Lock()
+	defer v.cpMu.Unlock()
+	return v.checkpoint
+}
+
+// saveCheckpoint 推进断点并回调
+func (v *Validator[T, Pdr]) saveCheckpoint(update func(cp *Checkpoint)) {
+	v.cpMu.Lock()
+	update(&v.checkpoint)
+	v.checkpoint.Inconsistencies = v.inconsistencies.Load()
+	cp := v.checkpoint
+	v.cpMu.Unlock()
+	if v.onCheckpoint != nil {
+		v.onCheckpoint(cp)
+	}
+}
+
+// validateBaseToTargetKeyset keyset 模式 base -> target
+func (v *Validator[T, Pdr]) validateBaseToTargetKeyset(ctx context.Context) error {
+	lastID := v.Checkpoint().BaseToTarget
+	for {
+		srcs, err := v.batchFromBase(ctx, lastID)
+		if err == context.DeadlineExceeded || err == context.Canceled || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			// 查询出错时不推进游标，瞬态错误重试同一批次。
+			v.l.Error("base -> target 批量查询 base 失败", logx.Int64("last_id", lastID), logx.Error(err))
+			v.backoff(ctx)
+			continue
+		}
+		if len(srcs) == 0 {
+			// 全量模式扫完即结束；增量模式从当前游标继续等待新数据。
+			if v.sleepInterval <= 0 {
+				return nil
+			}
+			time.Sleep(v.sleepInterval)
+			continue
+		}
+
+		ids := sliceX.Map(srcs, func(idx int, t T) int64 {
+			return t.ID()
+		})
+		var dsts []T
+		err = v.target.WithContext(ctx).Where("id IN ?", ids).Find(&dsts).Error
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// 目标表查询失败同样不推进游标，重试该批次。
+			v.l.Error("base -> target 批量查询 target 失败", logx.Int64("last_id", lastID), logx.Error(err))
+			v.backoff(ctx)
+			continue
+		}
+		dstMap := make(map[int64]T, len(dsts))
+		for _, dst := range dsts {
+			dstMap[dst.ID()] = dst
+		}
+		for _, src := range srcs {
+			dst, ok := dstMap[src.ID()]
+			if !ok {
+				v.notify(src.ID(), events.InconsistentEventTypeTargetMissing)
+				v.l.Warn("base -> target 缺少 target 数据", logx.Int64("id", src.ID()))
+				continue
+			}
+			if !src.CompareTo(dst) {
+				v.notifyNEQ(src, dst)
+			}
+		}
+
+		lastID = srcs[len(srcs)-1].ID()
+		v.saveCheckpoint(func(cp *Checkpoint) {
+			cp.BaseToTarget = lastID
+		})
+		// 不足一批说明已扫到末尾
+		if len(srcs) < v.batchSize && v.sleepInterval <= 0 {
+			return nil
+		}
+	}
+}
+
+// batchFromBase 按 id 游标批量取 base 数据
+func (v *Validator[T, Pdr]) batchFromBase(ctx context.Context, lastID int64) ([]T, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+	var srcs []T
+	err := v.base.WithContext(dbCtx).
+		Where("id > ?", lastID).
+		Order("id").Limit(v.batchSize).
+		Find(&srcs).Error
+	return srcs, err
+}
+
 func (v *Validator[T, Pdr]) fullFromBase(ctx context.Context, offset int) (T, error) {
 	dbCtx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
@@ -173,6 +327,9 @@ func (v *Validator[T, Pdr]) incrFromBase(ctx context.Context, offset int) (T, er
 
 // target -> base
 func (v *Validator[T, Pdr]) validateTargetToBase(ctx context.Context) error {
+	if v.keyset {
+		return v.validateTargetToBaseKeyset(ctx)
+	}
 	offset := 0
 	for {
 		var ts []T
@@ -194,9 +351,7 @@ func (v *Validator[T, Pdr]) validateTargetToBase(ctx context.Context) error {
 		if err != nil {
 			// 查询出错时不递增 offset，避免跳过该批次。
 			v.l.Error("target => base 查询 target 失败", logx.Error(err))
-			if v.sleepInterval > 0 {
-				time.Sleep(v.sleepInterval)
-			}
+			v.backoff(ctx)
 			continue
 		}
 		var srcTs []T
@@ -234,6 +389,75 @@ func (v *Validator[T, Pdr]) validateTargetToBase(ctx context.Context) error {
 	}
 }
 
+// validateTargetToBaseKeyset keyset 模式 target -> base，只比对 id 是否存在
+func (v *Validator[T, Pdr]) validateTargetToBaseKeyset(ctx context.Context) error {
+	lastID := v.Checkpoint().TargetToBase
+	for {
+		var ts []T
+		err := v.target.WithContext(ctx).Select("id").
+			Where("id > ?", lastID).
+			Order("id").Limit(v.batchSize).
+			Find(&ts).Error
+		if err == context.DeadlineExceeded || err == context.Canceled || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			v.l.Error("target => base 批量查询 target 失败", logx.Int64("last_id", lastID), logx.Error(err))
+			v.backoff(ctx)
+			continue
+		}
+		if len(ts) == 0 {
+			if v.sleepInterval <= 0 {
+				return nil
+			}
+			time.Sleep(v.sleepInterval)
+			continue
+		}
+
+		var srcTs []T
+		ids := sliceX.Map(ts, func(idx int, t T) int64 {
+			return t.ID()
+		})
+		err = v.base.WithContext(ctx).Select("id").
+			Where("id IN ?", ids).Find(&srcTs).Error
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			v.l.Error("target => base 批量查询 base 失败", logx.Int64("last_id", lastID), logx.Error(err))
+			v.backoff(ctx)
+			continue
+		}
+		diff := sliceX.DiffSetFunc(ts, srcTs, func(src, dst T) bool {
+			return src.ID() == dst.ID()
+		})
+		v.notifyBaseMissing(diff)
+
+		lastID = ts[len(ts)-1].ID()
+		v.saveCheckpoint(func(cp *Checkpoint) {
+			cp.TargetToBase = lastID
+		})
+		if len(ts) < v.batchSize && v.sleepInterval <= 0 {
+			return nil
+		}
+	}
+}
+
+// backoff 查询出错后等待再重试同一位置：增量模式按 sleepInterval，全量模式按 errBackoff，
+// 避免数据库持续出错时空转打满数据库和日志
+func (v *Validator[T, Pdr]) backoff(ctx context.Context) {
+	d := v.sleepInterval
+	if d <= 0 {
+		d = errBackoff
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
 // 批量发送 base 缺失的消息到 Kafka
 func (v *Validator[T, Pdr]) notifyBaseMissing(ts []T) {
 	for _, val := range ts {
@@ -241,14 +465,31 @@ func (v *Validator[T, Pdr]) notifyBaseMissing(ts []T) {
 	}
 }
 
+// Inconsistencies 返回本校验器已发现的不一致数据条数，从断点恢复时含断点中记录的条数
+func (v *Validator[T, Pdr]) Inconsistencies() int64 {
+	return v.inconsistencies.Load()
+}
+
+// notifyNEQ 上报数据不一致，附带字段级差异
+func (v *Validator[T, Pdr]) notifyNEQ(src, dst T) {
+	diffs := myMovex.Diff(src, dst, v.base.NamingStrategy)
+	v.notify(src.ID(), events.InconsistentEventTypeNEQ, diffs...)
+	v.l.Warn("base -> target 数据不一致", logx.Int64("id", src.ID()), logx.Any("diffs", diffs))
+}
+
 // 上报发送不一致消息到 Kafka
-func (v *Validator[T, Pdr]) notify(id int64, typ string) {
+func (v *Validator[T, Pdr]) notify(id int64, typ string, diffs ...myMovex.FieldDiff) {
+	v.inconsistencies.Add(1)
+	if v.onInconsistent != nil {
+		v.onInconsistent(typ)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 	val, _ := json.Marshal(events.InconsistentEvent{
 		ID:        id,
 		Type:      typ,
 		Direction: v.direction,
+		Diffs:     diffs,
 	})
 	//err := v.MessageQueueConf.Producer.SendMessage(ctx, messageQueuex.Tp{Topic: v.MessageQueueConf.MessageQueueTopic}, val)
 	err := v.MessageQueueConf.Producer.Send(ctx, &mqX.Message{Topic: v.MessageQueueConf.MessageQueueTopic, Value: val})
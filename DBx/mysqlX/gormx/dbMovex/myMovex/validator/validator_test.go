@@ -0,0 +1,140 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hgg-6/pkgTool/v2/DBx/mysqlX/gormx/dbMovex/myMovex/events"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX/memoryX"
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	gdb, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	return gdb, mock
+}
+
+func userRows(users ...events.TestUser) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "nick_name", "email", "updated_at", "ctime", "utime"})
+	for _, u := range users {
+		rows.AddRow(u.Id, u.Name, u.Email, u.UpdatedAt, u.Ctime, u.Utime)
+	}
+	return rows
+}
+
+func idRows(ids ...int64) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id"})
+	for _, id := range ids {
+		rows.AddRow(id)
+	}
+	return rows
+}
+
+// TestValidatorKeyset 测试 keyset 模式从断点恢复、按批推进断点、查询出错后退避重试同一批次
+func TestValidatorKeyset(t *testing.T) {
+	base, baseMock := newMockDB(t)
+	target, targetMock := newMockDB(t)
+	broker := memoryX.NewBroker(1)
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+
+	var cps []Checkpoint
+	v := NewValidator[events.TestUser, any](base, target, "SRC", l, &MessageQueueStr[any]{
+		Producer: broker, MessageQueueTopic: "inconsistent",
+	}).Keyset().BatchSize(2).
+		Resume(Checkpoint{BaseToTarget: 10, TargetToBase: 20, Inconsistencies: 5}).
+		OnCheckpoint(func(cp Checkpoint) { cps = append(cps, cp) })
+
+	// base -> target：第一次查询出错，全量模式退避后重试同一批次
+	selectBase := "SELECT \\* FROM `test_users` WHERE id > \\?"
+	baseMock.ExpectQuery(selectBase).WithArgs(10, 2).WillReturnError(errors.New("bad connection"))
+	baseMock.ExpectQuery(selectBase).WithArgs(10, 2).WillReturnRows(userRows(
+		events.TestUser{Id: 11, Name: "a"}, events.TestUser{Id: 12, Name: "b"}))
+	targetMock.ExpectQuery("SELECT \\* FROM `test_users` WHERE id IN").WithArgs(11, 12).
+		WillReturnRows(userRows(events.TestUser{Id: 11, Name: "a"}))
+	// 不足一批，扫完结束
+	baseMock.ExpectQuery(selectBase).WithArgs(12, 2).WillReturnRows(userRows(events.TestUser{Id: 13, Name: "c"}))
+	targetMock.ExpectQuery("SELECT \\* FROM `test_users` WHERE id IN").WithArgs(13).
+		WillReturnRows(userRows(events.TestUser{Id: 13, Name: "x"}))
+
+	// 查询与预期不符时会一直退避重试，用超时兜底
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	require.NoError(t, v.validateBaseToTarget(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), errBackoff)
+	// 断点带上累计的不一致条数，含恢复前的 5 条
+	assert.Equal(t, []Checkpoint{{BaseToTarget: 12, TargetToBase: 20, Inconsistencies: 6}, {BaseToTarget: 13, TargetToBase: 20, Inconsistencies: 7}}, cps)
+
+	// target -> base：只比对 id 是否存在
+	cps = nil
+	selectTarget := "SELECT `id` FROM `test_users` WHERE id > \\?"
+	targetMock.ExpectQuery(selectTarget).WithArgs(20, 2).WillReturnRows(idRows(21, 22))
+	baseMock.ExpectQuery("SELECT `id` FROM `test_users` WHERE id IN").WithArgs(21, 22).WillReturnRows(idRows(21))
+	targetMock.ExpectQuery(selectTarget).WithArgs(22, 2).WillReturnRows(idRows())
+	require.NoError(t, v.validateTargetToBase(ctx))
+	assert.Equal(t, []Checkpoint{{BaseToTarget: 13, TargetToBase: 22, Inconsistencies: 8}}, cps)
+	assert.Equal(t, Checkpoint{BaseToTarget: 13, TargetToBase: 22, Inconsistencies: 8}, v.Checkpoint())
+
+	require.NoError(t, baseMock.ExpectationsWereMet())
+	require.NoError(t, targetMock.ExpectationsWereMet())
+
+	// 不一致数据：12 target 缺失、13 字段不同、22 base 缺失，加上恢复前的 5 条
+	assert.Equal(t, int64(8), v.Inconsistencies())
+	var got []events.InconsistentEvent
+	for _, msg := range broker.Messages("inconsistent") {
+		var evt events.InconsistentEvent
+		require.NoError(t, json.Unmarshal(msg.Value, &evt))
+		got = append(got, evt)
+	}
+	require.Len(t, got, 3)
+	assert.Equal(t, int64(12), got[0].ID)
+	assert.Equal(t, events.InconsistentEventTypeTargetMissing, got[0].Type)
+	assert.Equal(t, int64(13), got[1].ID)
+	assert.Equal(t, events.InconsistentEventTypeNEQ, got[1].Type)
+	assert.Equal(t, int64(22), got[2].ID)
+	assert.Equal(t, events.InconsistentEventTypeBaseMissing, got[2].Type)
+}
+
+// countLogger 统计 Error 日志条数
+type countLogger struct {
+	logx.Loggerx
+	errs atomic.Int64
+}
+
+func (l *countLogger) Error(msg string, fields ...logx.Field) { l.errs.Add(1) }
+
+// TestValidatorBackoff 全量模式持续查询出错时按 errBackoff 退避，不空转，ctx 结束后退出
+func TestValidatorBackoff(t *testing.T) {
+	base, baseMock := newMockDB(t)
+	target, _ := newMockDB(t)
+	l := &countLogger{}
+	v := NewValidator[events.TestUser, any](base, target, "SRC", l, nil).Keyset()
+	for i := 0; i < 10; i++ {
+		baseMock.ExpectQuery("SELECT").WillReturnError(errors.New("db down"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), errBackoff*3/2)
+	defer cancel()
+	require.NoError(t, v.validateBaseToTarget(ctx))
+	// 第 0s、第 1s 各查询一次
+	assert.Equal(t, int64(2), l.errs.Load())
+}
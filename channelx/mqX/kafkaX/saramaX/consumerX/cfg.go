@@ -11,6 +11,14 @@ type ConsumerConfig struct {
 	// 默认：5秒
 	// 若为 0，则禁用超时，仅按数量触发
 	BatchTimeout time.Duration
+
+	// Workers 单条消费时按 Message.Key 哈希分发的并发协程数，同一个 Key 保持顺序，handler 需并发安全
+	// 默认：0，<=1 时每个分区逐条处理；只提交到最小的连续已完成 offset
+	Workers int
+
+	// FailurePolicy 处理失败的策略【进程内重试 -> 重试 topic -> 死信 topic】
+	// 默认：nil，Handle/HandleBatch 返回错误时 ConsumeClaim 返回该错误，claim 结束
+	FailurePolicy *FailurePolicy
 }
 
 func DefaultConsumerConfig() *ConsumerConfig {
@@ -27,4 +35,7 @@ func (c *ConsumerConfig) Validate() {
 	if c.BatchTimeout < 0 {
 		c.BatchTimeout = 5 * time.Second
 	}
+	if c.FailurePolicy != nil {
+		c.FailurePolicy.validate()
+	}
 }
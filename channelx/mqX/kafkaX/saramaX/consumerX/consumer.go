@@ -5,8 +5,8 @@ package consumerX
 import (
 	"context"
 	"fmt"
-	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"time"
 )
 
@@ -66,13 +66,12 @@ func (a *consumerGroupHandlerAdapter) ConsumeClaim(sess sarama.ConsumerGroupSess
 	switch a.handler.IsBatch() {
 	case false:
 		// 非批量模式：走单条逻辑
+		if a.config.Workers > 1 {
+			return a.consumeOrdered(sess, claim)
+		}
 		for msg := range claim.Messages() {
-			genericMsg := &mqX.Message{
-				Topic: msg.Topic,
-				Key:   msg.Key,
-				Value: msg.Value,
-			}
-			if err := a.handler.Handle(context.Background(), genericMsg); err != nil {
+			genericMsg := toMessage(msg)
+			if err := a.handle(sess.Context(), genericMsg); err != nil {
 				errs = err
 				return err
 			}
@@ -96,7 +95,7 @@ func (a *consumerGroupHandlerAdapter) ConsumeClaim(sess sarama.ConsumerGroupSess
 				return nil
 			}
 
-			success, err := a.handler.HandleBatch(context.Background(), msgBuffer)
+			success, err := a.handleBatch(sess.Context(), msgBuffer)
 			if err != nil {
 				errs = err
 				return err
@@ -134,10 +133,12 @@ func (a *consumerGroupHandlerAdapter) ConsumeClaim(sess sarama.ConsumerGroupSess
 				if !ok {
 					return errs
 				}
-				genericMsg := &mqX.Message{
-					Topic: msg.Topic,
-					Key:   msg.Key,
-					Value: msg.Value,
+				genericMsg := toMessage(msg)
+				if a.config.FailurePolicy != nil {
+					// 重试 topic 的消息等到延迟时间后再进入缓冲区
+					if err := waitNotBefore(sess.Context(), genericMsg); err != nil {
+						return err
+					}
 				}
 				if len(msgBuffer) == 0 && batchTimeout > 0 {
 					timer = time.NewTimer(batchTimeout)
@@ -160,3 +161,63 @@ func (a *consumerGroupHandlerAdapter) ConsumeClaim(sess sarama.ConsumerGroupSess
 	}
 	return fmt.Errorf("unknown batch mode, 未知的批量模式/单条模式， 未实现IsBatch()接口")
 }
+
+// handle 处理单条消息，配置了 FailurePolicy 时失败的消息投递到重试 topic/死信 topic 后返回 nil
+func (a *consumerGroupHandlerAdapter) handle(ctx context.Context, msg *mqX.Message) error {
+	p := a.config.FailurePolicy
+	if p == nil {
+		return a.handler.Handle(context.Background(), msg)
+	}
+	if err := waitNotBefore(ctx, msg); err != nil {
+		return err
+	}
+	err := p.retry(ctx, func() error {
+		return a.handler.Handle(context.Background(), msg)
+	})
+	if err == nil || p.Producer == nil {
+		return err
+	}
+	return p.forward(ctx, []*mqX.Message{msg}, err)
+}
+
+// handleBatch 批量处理，配置了 FailurePolicy 时失败的整批消息投递到重试 topic/死信 topic 后返回 true
+func (a *consumerGroupHandlerAdapter) handleBatch(ctx context.Context, msgs []*mqX.Message) (bool, error) {
+	p := a.config.FailurePolicy
+	if p == nil {
+		return a.handler.HandleBatch(context.Background(), msgs)
+	}
+	var success bool
+	err := p.retry(ctx, func() error {
+		var err error
+		success, err = a.handler.HandleBatch(context.Background(), msgs)
+		return err
+	})
+	if err == nil || p.Producer == nil {
+		return success, err
+	}
+	if err = p.forward(ctx, msgs, err); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// toMessage 映射 key、value、消息头、分区、offset 和时间戳，Key、Value、消息头与 sarama 共享内存
+func toMessage(msg *sarama.ConsumerMessage) *mqX.Message {
+	m := &mqX.Message{
+		Topic:     msg.Topic,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+	}
+	if len(msg.Headers) > 0 {
+		m.Headers = make([]mqX.Header, 0, len(msg.Headers))
+		for _, h := range msg.Headers {
+			if h != nil {
+				m.Headers = append(m.Headers, mqX.Header{Key: string(h.Key), Value: h.Value})
+			}
+		}
+	}
+	return m
+}
@@ -7,8 +7,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -67,3 +67,60 @@ func TestNewKafkaConsumer(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+// fakeClaim、fakeSession 只实现 ConsumeClaim 用到的方法
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	ch chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.ch }
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return context.Background() }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type recordHandler struct {
+	MyHandler
+	msgs []*mqX.Message
+}
+
+func (h *recordHandler) Handle(ctx context.Context, msg *mqX.Message) error {
+	h.msgs = append(h.msgs, msg)
+	return nil
+}
+
+// 消息头、分区、offset 和时间戳传给 handler
+func TestConsumerGroupHandlerAdapter_Metadata(t *testing.T) {
+	ts := time.UnixMilli(1700000000000)
+	claim := &fakeClaim{ch: make(chan *sarama.ConsumerMessage, 1)}
+	claim.ch <- &sarama.ConsumerMessage{
+		Topic: "user-events", Partition: 3, Offset: 42, Timestamp: ts,
+		Key: []byte("k"), Value: []byte("v"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("trace-id"), Value: []byte("abc")},
+			{Key: []byte("schema"), Value: []byte("v2")},
+		},
+	}
+	close(claim.ch)
+	sess := &fakeSession{}
+	h := &recordHandler{}
+	assert.NoError(t, newConsumerGroupHandlerAdapter(h, nil).ConsumeClaim(sess, claim))
+
+	assert.Equal(t, []*mqX.Message{{
+		Topic: "user-events", Key: []byte("k"), Value: []byte("v"),
+		Headers:   []mqX.Header{{Key: "trace-id", Value: []byte("abc")}, {Key: "schema", Value: []byte("v2")}},
+		Partition: 3, Offset: 42, Timestamp: ts,
+	}}, h.msgs)
+	schema, ok := h.msgs[0].GetHeader("schema")
+	assert.True(t, ok)
+	assert.Equal(t, "v2", string(schema))
+	assert.Equal(t, []int64{42}, sess.marked)
+}
@@ -0,0 +1,198 @@
+package consumerX
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+)
+
+// 失败的消息投递到重试 topic、死信 topic 时带上的消息头，原有的消息头全部保留
+const (
+	HeaderOriginalTopic     = "x-original-topic"     // 最初的 topic
+	HeaderOriginalPartition = "x-original-partition" // 最初的分区
+	HeaderOriginalOffset    = "x-original-offset"    // 最初的 offset
+	HeaderRetryCount        = "x-retry-count"        // 已经投递过几级重试 topic
+	HeaderError             = "x-error"              // 最后一次处理的错误
+	HeaderFailedAt          = "x-failed-at"          // 最后一次失败的时间，unix 毫秒
+	HeaderNotBefore         = "x-retry-not-before"   // 重试 topic 的消息在这个时间【unix 毫秒】之后才处理
+)
+
+// FailurePolicy 处理失败的策略：进程内重试 -> 分级重试 topic -> 死信 topic，投递成功后提交 offset，不再阻塞分区
+//   - 重试 topic 为 <topic>.retry.<延迟>，如 user-events.retry.5s、user-events.retry.1m，死信 topic 为 <topic>.dlq
+//   - 需要同时订阅原 topic 和全部重试 topic【RetryTopics】，重试 topic 的消息等到延迟时间后再交给 handler
+//   - 批量模式下 HandleBatch 失败时整批消息一起重试、投递
+type FailurePolicy struct {
+	// Retries 进程内重试次数，不含第一次，默认 0
+	Retries int
+	// Backoff 进程内重试的间隔，每次翻倍，默认 100ms
+	Backoff time.Duration
+	// MaxBackoff 进程内重试间隔的上限，默认 5s
+	MaxBackoff time.Duration
+	// RetryDelays 分级重试 topic 的延迟，如 []time.Duration{5 * time.Second, time.Minute}，为空时进程内重试失败后直接进死信
+	RetryDelays []time.Duration
+	// DLQSuffix 死信 topic 的后缀，默认 .dlq
+	DLQSuffix string
+	// Producer 投递重试 topic、死信 topic 的生产者，建议使用同步生产者，确保投递成功后再提交 offset；
+	// 为 nil 时进程内重试失败后返回错误，与不配置 FailurePolicy 时一致
+	Producer mqX.Producer
+}
+
+func (p *FailurePolicy) validate() {
+	if p.Retries < 0 {
+		p.Retries = 0
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	if p.DLQSuffix == "" {
+		p.DLQSuffix = ".dlq"
+	}
+}
+
+// RetryTopic 第 i 级重试 topic，如 user-events.retry.5s
+func (p *FailurePolicy) RetryTopic(topic string, i int) string {
+	return topic + ".retry." + formatDelay(p.RetryDelays[i])
+}
+
+// DLQTopic 死信 topic
+func (p *FailurePolicy) DLQTopic(topic string) string {
+	return topic + p.DLQSuffix
+}
+
+// RetryTopics 需要订阅的 topic：原 topic 和全部重试 topic
+func (p *FailurePolicy) RetryTopics(topic string) []string {
+	topics := []string{topic}
+	for i := range p.RetryDelays {
+		topics = append(topics, p.RetryTopic(topic, i))
+	}
+	return topics
+}
+
+// formatDelay 5s、1m、2h、500ms
+func formatDelay(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	case d%time.Second == 0:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	default:
+		return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+	}
+}
+
+// retry 进程内重试 fn，ctx 结束时返回最后一次的错误
+func (p *FailurePolicy) retry(ctx context.Context, fn func() error) error {
+	err := fn()
+	backoff := p.Backoff
+	for i := 0; i < p.Retries && err != nil; i++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff = min(backoff*2, p.MaxBackoff)
+		err = fn()
+	}
+	return err
+}
+
+// forward 进程内重试失败的消息投递到下一级重试 topic，已经过了全部重试 topic 的投递到死信 topic
+func (p *FailurePolicy) forward(ctx context.Context, msgs []*mqX.Message, cause error) error {
+	now := time.Now()
+	for _, m := range msgs {
+		retried, _ := strconv.Atoi(header(m, HeaderRetryCount))
+		origin := header(m, HeaderOriginalTopic)
+		if origin == "" {
+			origin = m.Topic
+		}
+		out := &mqX.Message{
+			Key:     bytes.Clone(m.Key),
+			Value:   bytes.Clone(m.Value),
+			Headers: make([]mqX.Header, 0, len(m.Headers)+7),
+		}
+		for _, h := range m.Headers {
+			out.Headers = append(out.Headers, mqX.Header{Key: h.Key, Value: bytes.Clone(h.Value)})
+		}
+		if header(m, HeaderOriginalTopic) == "" {
+			out.SetHeader(HeaderOriginalTopic, []byte(m.Topic))
+			out.SetHeader(HeaderOriginalPartition, []byte(strconv.FormatInt(int64(m.Partition), 10)))
+			out.SetHeader(HeaderOriginalOffset, []byte(strconv.FormatInt(m.Offset, 10)))
+		}
+		out.SetHeader(HeaderError, []byte(cause.Error()))
+		out.SetHeader(HeaderFailedAt, []byte(strconv.FormatInt(now.UnixMilli(), 10)))
+		if retried < len(p.RetryDelays) {
+			out.Topic = p.RetryTopic(origin, retried)
+			out.SetHeader(HeaderRetryCount, []byte(strconv.Itoa(retried+1)))
+			out.SetHeader(HeaderNotBefore, []byte(strconv.FormatInt(now.Add(p.RetryDelays[retried]).UnixMilli(), 10)))
+		} else {
+			out.Topic = p.DLQTopic(origin)
+			out.Headers = removeHeader(out.Headers, HeaderNotBefore)
+		}
+		if err := p.Producer.Send(ctx, out); err != nil {
+			return fmt.Errorf("投递 %s 失败: %w, 处理错误: %w", out.Topic, err, cause)
+		}
+	}
+	return nil
+}
+
+// waitNotBefore 重试 topic 的消息等到延迟时间后再处理
+func waitNotBefore(ctx context.Context, m *mqX.Message) error {
+	ms, err := strconv.ParseInt(header(m, HeaderNotBefore), 10, 64)
+	if err != nil {
+		return nil
+	}
+	d := time.Until(time.UnixMilli(ms))
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReplayMessage 死信消息还原为投递到最初 topic 的消息，去掉失败时加上的消息头，供死信重放工具使用
+func ReplayMessage(m *mqX.Message) *mqX.Message {
+	out := &mqX.Message{Topic: header(m, HeaderOriginalTopic), Key: m.Key, Value: m.Value}
+	if out.Topic == "" {
+		out.Topic = m.Topic
+	}
+	for _, h := range m.Headers {
+		if !strings.HasPrefix(h.Key, "x-original-") && !strings.HasPrefix(h.Key, "x-retry-") &&
+			h.Key != HeaderError && h.Key != HeaderFailedAt {
+			out.Headers = append(out.Headers, h)
+		}
+	}
+	return out
+}
+
+func header(m *mqX.Message, key string) string {
+	v, _ := m.GetHeader(key)
+	return string(v)
+}
+
+func removeHeader(headers []mqX.Header, key string) []mqX.Header {
+	res := headers[:0]
+	for _, h := range headers {
+		if h.Key != key {
+			res = append(res, h)
+		}
+	}
+	return res
+}
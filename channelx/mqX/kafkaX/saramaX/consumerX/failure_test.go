@@ -0,0 +1,217 @@
+package consumerX
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProducer 记录投递到重试 topic、死信 topic 的消息
+type fakeProducer struct {
+	msgs []*mqX.Message
+	err  error
+}
+
+func (p *fakeProducer) Send(ctx context.Context, msg *mqX.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func (p *fakeProducer) SendBatch(ctx context.Context, msgs []*mqX.Message) error {
+	for _, m := range msgs {
+		if err := p.Send(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *fakeProducer) Close() error { return nil }
+
+// failHandler 前 failures 次处理失败，failures < 0 时一直失败
+type failHandler struct {
+	MyHandler
+	batch    bool
+	failures int
+	calls    int
+	at       []time.Time
+}
+
+func (h *failHandler) IsBatch() bool { return h.batch }
+
+func (h *failHandler) Handle(ctx context.Context, msg *mqX.Message) error {
+	h.calls++
+	h.at = append(h.at, time.Now())
+	if h.failures < 0 || h.calls <= h.failures {
+		return errors.New("db down")
+	}
+	return nil
+}
+
+func (h *failHandler) HandleBatch(ctx context.Context, msgs []*mqX.Message) (bool, error) {
+	return true, h.Handle(ctx, nil)
+}
+
+func consumeOne(t *testing.T, cfg *ConsumerConfig, h mqX.ConsumerHandlerType, msgs ...*sarama.ConsumerMessage) (*fakeSession, error) {
+	t.Helper()
+	claim := &fakeClaim{ch: make(chan *sarama.ConsumerMessage, len(msgs))}
+	for _, m := range msgs {
+		claim.ch <- m
+	}
+	close(claim.ch)
+	sess := &fakeSession{}
+	return sess, newConsumerGroupHandlerAdapter(h, cfg).ConsumeClaim(sess, claim)
+}
+
+func TestFailurePolicy_Topics(t *testing.T) {
+	p := &FailurePolicy{RetryDelays: []time.Duration{5 * time.Second, time.Minute, 2 * time.Hour, 1500 * time.Millisecond}}
+	p.validate()
+	assert.Equal(t, []string{"user-events", "user-events.retry.5s", "user-events.retry.1m",
+		"user-events.retry.2h", "user-events.retry.1500ms"}, p.RetryTopics("user-events"))
+	assert.Equal(t, "user-events.dlq", p.DLQTopic("user-events"))
+}
+
+func TestFailurePolicy_InProcessRetry(t *testing.T) {
+	prod := &fakeProducer{}
+	h := &failHandler{failures: 2}
+	sess, err := consumeOne(t, &ConsumerConfig{FailurePolicy: &FailurePolicy{
+		Retries: 2, Backoff: 10 * time.Millisecond, RetryDelays: []time.Duration{5 * time.Second}, Producer: prod,
+	}}, h, &sarama.ConsumerMessage{Topic: "user-events", Offset: 7})
+	require.NoError(t, err)
+	assert.Equal(t, 3, h.calls)
+	// 退避翻倍：10ms、20ms
+	assert.GreaterOrEqual(t, h.at[2].Sub(h.at[0]), 30*time.Millisecond)
+	assert.Empty(t, prod.msgs)
+	assert.Equal(t, []int64{7}, sess.marked)
+}
+
+func TestFailurePolicy_Forward(t *testing.T) {
+	delays := []time.Duration{5 * time.Second, time.Minute}
+	testCases := []struct {
+		name    string
+		msg     *sarama.ConsumerMessage
+		topic   string
+		retried string
+	}{
+		{
+			name: "原 topic 进第一级重试",
+			msg: &sarama.ConsumerMessage{Topic: "user-events", Partition: 3, Offset: 42, Key: []byte("k"), Value: []byte("v"),
+				Headers: []*sarama.RecordHeader{{Key: []byte("trace-id"), Value: []byte("abc")}}},
+			topic:   "user-events.retry.5s",
+			retried: "1",
+		},
+		{
+			name: "第一级重试进第二级重试",
+			msg: &sarama.ConsumerMessage{Topic: "user-events.retry.5s", Partition: 0, Offset: 9, Key: []byte("k"), Value: []byte("v"),
+				Headers: []*sarama.RecordHeader{
+					{Key: []byte("trace-id"), Value: []byte("abc")},
+					{Key: []byte(HeaderOriginalTopic), Value: []byte("user-events")},
+					{Key: []byte(HeaderOriginalPartition), Value: []byte("3")},
+					{Key: []byte(HeaderOriginalOffset), Value: []byte("42")},
+					{Key: []byte(HeaderRetryCount), Value: []byte("1")},
+					{Key: []byte(HeaderNotBefore), Value: []byte(strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10))},
+				}},
+			topic:   "user-events.retry.1m",
+			retried: "2",
+		},
+		{
+			name: "最后一级重试进死信",
+			msg: &sarama.ConsumerMessage{Topic: "user-events.retry.1m", Partition: 1, Offset: 5, Key: []byte("k"), Value: []byte("v"),
+				Headers: []*sarama.RecordHeader{
+					{Key: []byte("trace-id"), Value: []byte("abc")},
+					{Key: []byte(HeaderOriginalTopic), Value: []byte("user-events")},
+					{Key: []byte(HeaderOriginalPartition), Value: []byte("3")},
+					{Key: []byte(HeaderOriginalOffset), Value: []byte("42")},
+					{Key: []byte(HeaderRetryCount), Value: []byte("2")},
+				}},
+			topic:   "user-events.dlq",
+			retried: "2",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prod := &fakeProducer{}
+			sess, err := consumeOne(t, &ConsumerConfig{FailurePolicy: &FailurePolicy{
+				RetryDelays: delays, Producer: prod,
+			}}, &failHandler{failures: -1}, tc.msg)
+			require.NoError(t, err)
+			assert.Equal(t, []int64{tc.msg.Offset}, sess.marked)
+			require.Len(t, prod.msgs, 1)
+
+			out := prod.msgs[0]
+			assert.Equal(t, tc.topic, out.Topic)
+			assert.Equal(t, "k", string(out.Key))
+			assert.Equal(t, "v", string(out.Value))
+			assert.Equal(t, "abc", header(out, "trace-id"))
+			assert.Equal(t, "user-events", header(out, HeaderOriginalTopic))
+			assert.Equal(t, "3", header(out, HeaderOriginalPartition))
+			assert.Equal(t, "42", header(out, HeaderOriginalOffset))
+			assert.Equal(t, tc.retried, header(out, HeaderRetryCount))
+			assert.Equal(t, "db down", header(out, HeaderError))
+			assert.NotEmpty(t, header(out, HeaderFailedAt))
+			_, delayed := out.GetHeader(HeaderNotBefore)
+			assert.Equal(t, tc.topic != "user-events.dlq", delayed)
+
+			// 死信重放还原为原 topic 和业务消息头
+			replay := ReplayMessage(out)
+			assert.Equal(t, "user-events", replay.Topic)
+			assert.Equal(t, []mqX.Header{{Key: "trace-id", Value: []byte("abc")}}, replay.Headers)
+		})
+	}
+}
+
+func TestFailurePolicy_NotBefore(t *testing.T) {
+	notBefore := time.Now().Add(100 * time.Millisecond)
+	h := &failHandler{}
+	_, err := consumeOne(t, &ConsumerConfig{FailurePolicy: &FailurePolicy{Producer: &fakeProducer{}}}, h,
+		&sarama.ConsumerMessage{Topic: "user-events.retry.5s", Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderNotBefore), Value: []byte(strconv.FormatInt(notBefore.UnixMilli(), 10))},
+		}})
+	require.NoError(t, err)
+	require.Len(t, h.at, 1)
+	assert.False(t, h.at[0].Before(notBefore.Truncate(time.Millisecond)))
+}
+
+func TestFailurePolicy_ProducerError(t *testing.T) {
+	sess, err := consumeOne(t, &ConsumerConfig{FailurePolicy: &FailurePolicy{
+		Producer: &fakeProducer{err: errors.New("kafka down")},
+	}}, &failHandler{failures: -1}, &sarama.ConsumerMessage{Topic: "user-events", Offset: 1})
+	assert.ErrorContains(t, err, "kafka down")
+	assert.ErrorContains(t, err, "db down")
+	assert.Empty(t, sess.marked)
+}
+
+func TestFailurePolicy_NoProducer(t *testing.T) {
+	h := &failHandler{failures: -1}
+	sess, err := consumeOne(t, &ConsumerConfig{FailurePolicy: &FailurePolicy{Retries: 1, Backoff: time.Millisecond}},
+		h, &sarama.ConsumerMessage{Topic: "user-events", Offset: 1})
+	assert.EqualError(t, err, "db down")
+	assert.Equal(t, 2, h.calls)
+	assert.Empty(t, sess.marked)
+}
+
+func TestFailurePolicy_Batch(t *testing.T) {
+	prod := &fakeProducer{}
+	sess, err := consumeOne(t, &ConsumerConfig{BatchSize: 2, FailurePolicy: &FailurePolicy{Producer: prod}},
+		&failHandler{batch: true, failures: -1},
+		&sarama.ConsumerMessage{Topic: "user-events", Offset: 1},
+		&sarama.ConsumerMessage{Topic: "user-events", Offset: 2},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, sess.marked)
+	require.Len(t, prod.msgs, 2)
+	for i, m := range prod.msgs {
+		assert.Equal(t, "user-events.dlq", m.Topic)
+		assert.Equal(t, strconv.Itoa(i+1), header(m, HeaderOriginalOffset))
+	}
+}
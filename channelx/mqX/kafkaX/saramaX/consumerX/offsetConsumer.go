@@ -3,8 +3,8 @@ package consumerX
 import (
 	"context"
 	"fmt"
-	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"sync"
 	"time"
 )
@@ -146,11 +146,7 @@ func (oc *OffsetConsumer) ConsumeFrom(ctx context.Context, topic string,
 			}
 
 			// 转换为通用 Message
-			kafkaMsg := &mqX.Message{
-				Topic: msg.Topic,
-				Key:   msg.Key,
-				Value: msg.Value,
-			}
+			kafkaMsg := toMessage(msg)
 
 			msgBuffer = append(msgBuffer, kafkaMsg)
 
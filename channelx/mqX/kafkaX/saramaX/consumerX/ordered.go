@@ -0,0 +1,125 @@
+package consumerX
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+)
+
+// workerQueueSize 每个 worker 的待处理消息数，满了之后阻塞拉取，避免积压过多未提交的消息
+const workerQueueSize = 64
+
+// offsetTracker 按拉取顺序记录在途消息，只提交到最小的连续已完成位置，崩溃后不会跳过未处理的消息
+type offsetTracker struct {
+	mu      sync.Mutex
+	sess    sarama.ConsumerGroupSession
+	pending []*trackedMsg
+}
+
+type trackedMsg struct {
+	msg  *sarama.ConsumerMessage
+	done bool
+}
+
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) *trackedMsg {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tm := &trackedMsg{msg: msg}
+	t.pending = append(t.pending, tm)
+	return tm
+}
+
+// done 标记处理完成，并提交队头连续完成的最后一条
+func (t *offsetTracker) done(tm *trackedMsg) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tm.done = true
+	var last *sarama.ConsumerMessage
+	i := 0
+	for ; i < len(t.pending) && t.pending[i].done; i++ {
+		last = t.pending[i].msg
+	}
+	if last == nil {
+		return
+	}
+	clear(t.pending[:i])
+	t.pending = t.pending[i:]
+	t.sess.MarkMessage(last, "")
+}
+
+type orderedJob struct {
+	tracked *trackedMsg
+	msg     *mqX.Message
+}
+
+// consumeOrdered 单条模式下按 Key 哈希分发给 config.Workers 个协程并发处理，同一个 Key 的消息保持顺序
+//   - 没有 Key 的消息按 offset 轮流分发，不保证顺序
+//   - 任一消息处理失败时停止分发，在途消息不再处理，返回第一个错误
+func (a *consumerGroupHandlerAdapter) consumeOrdered(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := &offsetTracker{sess: sess}
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		err     error
+		failed  = make(chan struct{})
+	)
+	queues := make([]chan orderedJob, a.config.Workers)
+	for i := range queues {
+		queues[i] = make(chan orderedJob, workerQueueSize)
+		wg.Add(1)
+		go func(jobs <-chan orderedJob) {
+			defer wg.Done()
+			for job := range jobs {
+				select {
+				case <-failed:
+					continue
+				default:
+				}
+				if er := a.handle(sess.Context(), job.msg); er != nil {
+					errOnce.Do(func() {
+						err = er
+						close(failed)
+					})
+					continue
+				}
+				tracker.done(job.tracked)
+			}
+		}(queues[i])
+	}
+
+	msgs := claim.Messages()
+dispatch:
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				break dispatch
+			}
+			job := orderedJob{tracked: tracker.add(msg), msg: toMessage(msg)}
+			select {
+			case queues[a.worker(msg)] <- job:
+			case <-failed:
+				break dispatch
+			}
+		case <-failed:
+			break dispatch
+		}
+	}
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	return err
+}
+
+func (a *consumerGroupHandlerAdapter) worker(msg *sarama.ConsumerMessage) int {
+	n := a.config.Workers
+	if len(msg.Key) == 0 {
+		return int(msg.Offset % int64(n))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(msg.Key)
+	return int(h.Sum32() % uint32(n))
+}
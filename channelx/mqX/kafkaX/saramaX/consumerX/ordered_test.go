@@ -0,0 +1,131 @@
+package consumerX
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncSession 并发安全的 fakeSession
+type syncSession struct {
+	sarama.ConsumerGroupSession
+	mu     sync.Mutex
+	offset []int64
+}
+
+func (s *syncSession) Context() context.Context { return context.Background() }
+
+func (s *syncSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = append(s.offset, msg.Offset)
+}
+
+func (s *syncSession) marked() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.offset...)
+}
+
+// funcHandler 单条处理交给 fn
+type funcHandler struct {
+	MyHandler
+	fn func(msg *mqX.Message) error
+}
+
+func (h *funcHandler) Handle(ctx context.Context, msg *mqX.Message) error {
+	return h.fn(msg)
+}
+
+func TestConsumeOrdered_KeyOrder(t *testing.T) {
+	const keys, perKey = 5, 40
+	claim := &fakeClaim{ch: make(chan *sarama.ConsumerMessage, keys*perKey)}
+	for i := 0; i < keys*perKey; i++ {
+		claim.ch <- &sarama.ConsumerMessage{Offset: int64(i), Key: []byte("user-" + strconv.Itoa(i%keys))}
+	}
+	close(claim.ch)
+
+	var (
+		mu   sync.Mutex
+		seen = map[string][]int64{}
+	)
+	h := &funcHandler{fn: func(msg *mqX.Message) error {
+		time.Sleep(time.Duration(rand.IntN(200)) * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		seen[string(msg.Key)] = append(seen[string(msg.Key)], msg.Offset)
+		return nil
+	}}
+	sess := &syncSession{}
+	require.NoError(t, newConsumerGroupHandlerAdapter(h, &ConsumerConfig{Workers: 4}).ConsumeClaim(sess, claim))
+
+	assert.Len(t, seen, keys)
+	for key, offsets := range seen {
+		assert.Len(t, offsets, perKey, key)
+		assert.IsIncreasing(t, offsets, key)
+	}
+	marked := sess.marked()
+	assert.IsIncreasing(t, marked)
+	assert.Equal(t, int64(keys*perKey-1), marked[len(marked)-1])
+}
+
+func TestConsumeOrdered_ContiguousCommit(t *testing.T) {
+	claim := &fakeClaim{ch: make(chan *sarama.ConsumerMessage, 4)}
+	release := make(chan struct{})
+	handled := make(chan int64, 4)
+	h := &funcHandler{fn: func(msg *mqX.Message) error {
+		if string(msg.Key) == "slow" {
+			<-release
+		}
+		handled <- msg.Offset
+		return nil
+	}}
+	sess := &syncSession{}
+	res := make(chan error, 1)
+	go func() {
+		res <- newConsumerGroupHandlerAdapter(h, &ConsumerConfig{Workers: 8}).ConsumeClaim(sess, claim)
+	}()
+
+	// offset 10 被阻塞，11、12 处理完也不能提交
+	claim.ch <- &sarama.ConsumerMessage{Offset: 10, Key: []byte("slow")}
+	claim.ch <- &sarama.ConsumerMessage{Offset: 11, Key: []byte("a")}
+	claim.ch <- &sarama.ConsumerMessage{Offset: 12, Key: []byte("b")}
+	done := map[int64]bool{<-handled: true, <-handled: true}
+	assert.Equal(t, map[int64]bool{11: true, 12: true}, done)
+	assert.Empty(t, sess.marked())
+
+	close(release)
+	assert.Equal(t, int64(10), <-handled)
+	close(claim.ch)
+	require.NoError(t, <-res)
+	assert.Equal(t, []int64{12}, sess.marked())
+}
+
+func TestConsumeOrdered_Error(t *testing.T) {
+	claim := &fakeClaim{ch: make(chan *sarama.ConsumerMessage, 10)}
+	for i := 0; i < 10; i++ {
+		claim.ch <- &sarama.ConsumerMessage{Offset: int64(i), Key: []byte("same")}
+	}
+	// 不关闭 claim，失败后也要退出
+	h := &funcHandler{fn: func(msg *mqX.Message) error {
+		if msg.Offset == 3 {
+			return errors.New("db down")
+		}
+		return nil
+	}}
+	sess := &syncSession{}
+	err := newConsumerGroupHandlerAdapter(h, &ConsumerConfig{Workers: 2}).ConsumeClaim(sess, claim)
+	assert.EqualError(t, err, "db down")
+	for _, off := range sess.marked() {
+		assert.Less(t, off, int64(3))
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
 	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sync/errgroup"
@@ -81,3 +83,28 @@ func TestNewKafkaProducer(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+// 消息头、时间戳映射到 sarama，同步发送成功后回填分区和 offset
+func TestKafkaProducer_Metadata(t *testing.T) {
+	ts := time.UnixMilli(1700000000000)
+	sp := mocks.NewSyncProducer(t, nil)
+	sp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pm *sarama.ProducerMessage) error {
+		assert.Equal(t, []sarama.RecordHeader{
+			{Key: []byte("trace-id"), Value: []byte("abc")},
+			{Key: []byte("tenant"), Value: []byte("t1")},
+		}, pm.Headers)
+		assert.Equal(t, ts, pm.Timestamp)
+		return nil
+	})
+	sp.ExpectSendMessageAndSucceed()
+	kp := &KafkaProducer{config: &ProducerConfig{}, syncProducer: sp}
+	kp.ctx, kp.cancel = context.WithCancel(context.Background())
+
+	m1 := &mqX.Message{Topic: "t", Value: []byte("1"), Timestamp: ts,
+		Headers: []mqX.Header{{Key: "trace-id", Value: []byte("abc")}, {Key: "tenant", Value: []byte("t1")}}}
+	m2 := &mqX.Message{Topic: "t", Value: []byte("2")}
+	assert.NoError(t, kp.SendBatch(context.Background(), []*mqX.Message{m1, m2}))
+	assert.Equal(t, int64(1), m1.Offset)
+	assert.Equal(t, int64(2), m2.Offset)
+	assert.NoError(t, kp.Close())
+}
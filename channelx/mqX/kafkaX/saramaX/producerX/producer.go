@@ -6,8 +6,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
 )
 
 // KafkaProducer saramaProducerx/kafka_producer.go
@@ -91,14 +91,13 @@ func (kp *KafkaProducer) SendBatch(ctx context.Context, msgs []*mqX.Message) err
 		// === 同步模式：立即发送，不缓冲 ===
 		var lastErr error
 		for _, m := range msgs {
-			_, _, err := kp.syncProducer.SendMessage(&sarama.ProducerMessage{
-				Topic: m.Topic,
-				Key:   sarama.ByteEncoder(m.Key),
-				Value: sarama.ByteEncoder(m.Value),
-			})
+			partition, offset, err := kp.syncProducer.SendMessage(toProducerMessage(m))
 			if err != nil {
 				lastErr = err
+				continue
 			}
+			// 回填写入的位置
+			m.Partition, m.Offset = partition, offset
 		}
 		return lastErr
 	}
@@ -114,11 +113,7 @@ func (kp *KafkaProducer) SendBatch(ctx context.Context, msgs []*mqX.Message) err
 	// 添加到缓冲区
 	for _, m := range msgs {
 		kp.msgBuffer = append(kp.msgBuffer, m)
-		kp.saramaBuffer = append(kp.saramaBuffer, &sarama.ProducerMessage{
-			Topic: m.Topic,
-			Key:   sarama.ByteEncoder(m.Key),
-			Value: sarama.ByteEncoder(m.Value),
-		})
+		kp.saramaBuffer = append(kp.saramaBuffer, toProducerMessage(m))
 	}
 
 	// 首条消息：启动 timer（由后台 batchTimeoutLoop 监听并 flush）
@@ -135,6 +130,23 @@ func (kp *KafkaProducer) SendBatch(ctx context.Context, msgs []*mqX.Message) err
 	return nil
 }
 
+// toProducerMessage 映射 key、value、消息头和时间戳
+func toProducerMessage(m *mqX.Message) *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{
+		Topic:     m.Topic,
+		Key:       sarama.ByteEncoder(m.Key),
+		Value:     sarama.ByteEncoder(m.Value),
+		Timestamp: m.Timestamp,
+	}
+	if len(m.Headers) > 0 {
+		pm.Headers = make([]sarama.RecordHeader, 0, len(m.Headers))
+		for _, h := range m.Headers {
+			pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(h.Key), Value: h.Value})
+		}
+	}
+	return pm
+}
+
 // flushLocked 异步模式下 flush 缓冲区（必须持有锁）。
 // 不响应 kp.ctx.Done()，因为 Close 流程需要先 flush 剩余消息再关闭 producer。
 func (kp *KafkaProducer) flushLocked() error {
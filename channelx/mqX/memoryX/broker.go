@@ -0,0 +1,179 @@
+package memoryX
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+)
+
+var _ mqX.Producer = (*Broker)(nil)
+
+var ErrBrokerClosed = errors.New("内存 broker 已关闭")
+
+// Broker 进程内的消息队列，实现 mqX.Producer，Consumer 创建 mqX.Consumer，用于单元测试、本地开发
+//   - topic 分区，有 Key 时按 fnv-1a 哈希选择分区【与 sarama 默认的 HashPartitioner 一致】，没有 Key 时轮询
+//   - 消费者组按组记录提交的 offset，组内成员按分区分配，成员变化时重新分配
+//   - 新的消费者组从最早的消息开始消费
+type Broker struct {
+	mu         sync.Mutex
+	partitions int32
+	topics     map[string]*topic
+	groups     map[string]*group
+	closed     bool
+}
+
+type topic struct {
+	partitions []*partition
+	next       int32 // 没有 Key 时轮询的下一个分区
+}
+
+type partition struct {
+	msgs []*mqX.Message
+	// notify 有新消息时关闭并替换
+	notify chan struct{}
+}
+
+// NewBroker 创建内存 broker，partitions 为自动创建的 topic 的分区数，<=0 时为 1
+func NewBroker(partitions int32) *Broker {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	return &Broker{
+		partitions: partitions,
+		topics:     make(map[string]*topic),
+		groups:     make(map[string]*group),
+	}
+}
+
+// CreateTopic 创建指定分区数的 topic，已存在时不修改
+func (b *Broker) CreateTopic(name string, partitions int32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topicLocked(name, partitions)
+}
+
+func (b *Broker) topicLocked(name string, partitions int32) *topic {
+	t, ok := b.topics[name]
+	if ok {
+		return t
+	}
+	if partitions <= 0 {
+		partitions = b.partitions
+	}
+	t = &topic{partitions: make([]*partition, partitions)}
+	for i := range t.partitions {
+		t.partitions[i] = &partition{notify: make(chan struct{})}
+	}
+	b.topics[name] = t
+	return t
+}
+
+// Send 写入消息，成功后回填 msg.Partition、msg.Offset，与同步生产者一致
+func (b *Broker) Send(ctx context.Context, msg *mqX.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	t := b.topicLocked(msg.Topic, 0)
+	n := int32(len(t.partitions))
+	var pid int32
+	if msg.Key == nil {
+		pid = t.next % n
+		t.next++
+	} else {
+		h := fnv.New32a()
+		_, _ = h.Write(msg.Key)
+		pid = int32(h.Sum32()) % n
+		if pid < 0 {
+			pid = -pid
+		}
+	}
+	p := t.partitions[pid]
+
+	stored := clone(msg)
+	stored.Partition = pid
+	stored.Offset = int64(len(p.msgs))
+	if stored.Timestamp.IsZero() {
+		stored.Timestamp = time.Now()
+	}
+	p.msgs = append(p.msgs, stored)
+	close(p.notify)
+	p.notify = make(chan struct{})
+
+	msg.Partition, msg.Offset = stored.Partition, stored.Offset
+	return nil
+}
+
+// SendBatch 逐条写入，遇到错误时返回
+func (b *Broker) SendBatch(ctx context.Context, msgs []*mqX.Message) error {
+	for _, msg := range msgs {
+		if err := b.Send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 关闭后不再接收消息，已有的消息仍可消费
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+// Messages topic 全部分区的消息，按分区、offset 排序，用于测试断言
+func (b *Broker) Messages(topicName string) []*mqX.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[topicName]
+	if !ok {
+		return nil
+	}
+	var res []*mqX.Message
+	for _, p := range t.partitions {
+		for _, m := range p.msgs {
+			res = append(res, clone(m))
+		}
+	}
+	return res
+}
+
+// CommittedOffset 消费者组在分区上提交的 offset【下一条要消费的消息】，没有提交过时为 0
+func (b *Broker) CommittedOffset(groupID, topicName string, pid int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, ok := b.groups[groupID]
+	if !ok {
+		return 0
+	}
+	return g.offsets[topicPartition{topic: topicName, partition: pid}]
+}
+
+// fetch 读取分区 offset 开始的消息，没有新消息时返回等待的 channel
+func (b *Broker) fetch(topicName string, pid int32, offset int64) ([]*mqX.Message, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.topics[topicName].partitions[pid]
+	if offset < int64(len(p.msgs)) {
+		return p.msgs[offset:], nil
+	}
+	return nil, p.notify
+}
+
+func clone(m *mqX.Message) *mqX.Message {
+	res := *m
+	res.Key = bytes.Clone(m.Key)
+	res.Value = bytes.Clone(m.Value)
+	res.Headers = make([]mqX.Header, 0, len(m.Headers))
+	for _, h := range m.Headers {
+		res.Headers = append(res.Headers, mqX.Header{Key: h.Key, Value: bytes.Clone(h.Value)})
+	}
+	return &res
+}
@@ -0,0 +1,35 @@
+package memoryX
+
+import (
+	"context"
+
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX/kafkaX/saramaX/consumerX"
+)
+
+var _ mqX.Consumer = (*Consumer)(nil)
+
+// Consumer 内存 broker 的消费者，处理逻辑与 consumerX.KafkaConsumer 相同
+type Consumer struct {
+	b       *Broker
+	groupID string
+	config  *consumerX.ConsumerConfig
+}
+
+// Consumer 创建消费者组 groupID 的消费者，config 可为 nil，BatchSize、BatchTimeout、FailurePolicy、Workers 均生效
+func (b *Broker) Consumer(groupID string, config *consumerX.ConsumerConfig) *Consumer {
+	return &Consumer{b: b, groupID: groupID, config: config}
+}
+
+// Subscribe 加入消费者组并持续消费，直到 ctx 结束【返回 nil】或处理出错【返回错误】
+func (c *Consumer) Subscribe(ctx context.Context, topics []string, handler mqX.ConsumerHandlerType) error {
+	cg := c.b.ConsumerGroup(c.groupID)
+	defer cg.Close()
+	kc := consumerX.NewKafkaConsumer(cg, c.config)
+	for ctx.Err() == nil {
+		if err := kc.Subscribe(ctx, topics, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package memoryX
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/IBM/sarama"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// group 消费者组：成员、提交的 offset、分区归属
+type group struct {
+	members []*consumerGroup
+	gen     int32
+	offsets map[topicPartition]int64
+	owners  map[topicPartition]*consumerGroup
+	// notify 成员变化、分区释放时关闭并替换
+	notify chan struct{}
+}
+
+func (g *group) broadcast() {
+	close(g.notify)
+	g.notify = make(chan struct{})
+}
+
+// assignment 成员分到的分区：每个 topic 的分区按加入顺序轮流分给订阅了该 topic 的成员
+func (b *Broker) assignment(g *group, me *consumerGroup) []topicPartition {
+	var res []topicPartition
+	for _, name := range me.topics {
+		var subs []*consumerGroup
+		for _, m := range g.members {
+			if slices.Contains(m.topics, name) {
+				subs = append(subs, m)
+			}
+		}
+		for pid := range b.topics[name].partitions {
+			if subs[pid%len(subs)] == me {
+				res = append(res, topicPartition{topic: name, partition: int32(pid)})
+			}
+		}
+	}
+	return res
+}
+
+var memberSeq atomic.Int64
+
+// consumerGroup 消费者组的一个成员，实现 sarama.ConsumerGroup，可直接交给 consumerX.NewKafkaConsumer
+type consumerGroup struct {
+	b       *Broker
+	groupID string
+	id      string
+	topics  []string
+	joined  bool
+	closed  bool
+	errs    chan error
+}
+
+// ConsumerGroup 加入消费者组，第一次 Consume 时按订阅的 topic 分配分区，Close 时离开
+//   - 与 sarama 一致，成员变化时 Consume 结束本轮会话并返回 nil，需要循环调用
+//   - 与 sarama 不同，ConsumeClaim 返回错误时结束本轮会话并由 Consume 返回该错误
+//   - Pause、Resume 为空实现
+func (b *Broker) ConsumerGroup(groupID string) sarama.ConsumerGroup {
+	return &consumerGroup{
+		b:       b,
+		groupID: groupID,
+		id:      groupID + "-" + strconv.FormatInt(memberSeq.Add(1), 10),
+		errs:    make(chan error),
+	}
+}
+
+func (c *consumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	c.b.mu.Lock()
+	if c.closed {
+		c.b.mu.Unlock()
+		return sarama.ErrClosedConsumerGroup
+	}
+	g := c.groupLocked()
+	topics = slices.Sorted(slices.Values(topics))
+	topics = slices.Compact(topics)
+	if !c.joined || !slices.Equal(c.topics, topics) {
+		for _, name := range topics {
+			c.b.topicLocked(name, 0)
+		}
+		c.topics = topics
+		if !c.joined {
+			c.joined = true
+			g.members = append(g.members, c)
+		}
+		g.gen++
+		g.broadcast()
+	}
+	gen := g.gen
+	claims := c.b.assignment(g, c)
+	c.b.mu.Unlock()
+
+	// 等上一轮会话的成员释放分区
+	owned, ok := c.acquire(ctx, g, gen, claims)
+	defer c.release(g, owned)
+	if !ok {
+		return nil
+	}
+
+	sessCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sess := &session{c: c, g: g, ctx: sessCtx, gen: gen, claims: map[string][]int32{}}
+	for _, tp := range claims {
+		sess.claims[tp.topic] = append(sess.claims[tp.topic], tp.partition)
+	}
+	if err := handler.Setup(sess); err != nil {
+		return err
+	}
+	go c.watch(sessCtx, cancel, g, gen)
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		err     error
+	)
+	for _, tp := range claims {
+		cl := c.newClaim(sessCtx, g, tp)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 正常情况下 Messages 关闭后才返回，提前返回说明处理出错，结束本轮会话
+			if er := handler.ConsumeClaim(sess, cl); er != nil {
+				errOnce.Do(func() { err = er })
+			}
+			cancel()
+		}()
+	}
+	<-sessCtx.Done()
+	wg.Wait()
+	if er := handler.Cleanup(sess); er != nil && err == nil {
+		err = er
+	}
+	return err
+}
+
+func (c *consumerGroup) groupLocked() *group {
+	g, ok := c.b.groups[c.groupID]
+	if !ok {
+		g = &group{
+			offsets: make(map[topicPartition]int64),
+			owners:  make(map[topicPartition]*consumerGroup),
+			notify:  make(chan struct{}),
+		}
+		c.b.groups[c.groupID] = g
+	}
+	return g
+}
+
+// acquire 依次占有分区，ctx 结束或成员变化时返回 false
+func (c *consumerGroup) acquire(ctx context.Context, g *group, gen int32, claims []topicPartition) ([]topicPartition, bool) {
+	owned := make([]topicPartition, 0, len(claims))
+	for _, tp := range claims {
+		for {
+			c.b.mu.Lock()
+			if g.gen != gen {
+				c.b.mu.Unlock()
+				return owned, false
+			}
+			if g.owners[tp] == nil {
+				g.owners[tp] = c
+				owned = append(owned, tp)
+				c.b.mu.Unlock()
+				break
+			}
+			wait := g.notify
+			c.b.mu.Unlock()
+			select {
+			case <-wait:
+			case <-ctx.Done():
+				return owned, false
+			}
+		}
+	}
+	return owned, true
+}
+
+func (c *consumerGroup) release(g *group, owned []topicPartition) {
+	if len(owned) == 0 {
+		return
+	}
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	for _, tp := range owned {
+		delete(g.owners, tp)
+	}
+	g.broadcast()
+}
+
+// watch 成员变化时结束本轮会话
+func (c *consumerGroup) watch(ctx context.Context, cancel context.CancelFunc, g *group, gen int32) {
+	for {
+		c.b.mu.Lock()
+		changed := g.gen != gen
+		wait := g.notify
+		c.b.mu.Unlock()
+		if changed {
+			cancel()
+			return
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *consumerGroup) newClaim(ctx context.Context, g *group, tp topicPartition) *claim {
+	c.b.mu.Lock()
+	initial := g.offsets[tp]
+	hwm := int64(len(c.b.topics[tp.topic].partitions[tp.partition].msgs))
+	c.b.mu.Unlock()
+	cl := &claim{tp: tp, initial: initial, hwm: hwm, ch: make(chan *sarama.ConsumerMessage, 256)}
+	go func() {
+		// 会话结束时关闭 Messages
+		defer close(cl.ch)
+		offset := initial
+		for {
+			msgs, wait := c.b.fetch(tp.topic, tp.partition, offset)
+			for _, m := range msgs {
+				select {
+				case cl.ch <- toConsumerMessage(m):
+					offset++
+				case <-ctx.Done():
+					return
+				}
+			}
+			if wait == nil {
+				continue
+			}
+			select {
+			case <-wait:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cl
+}
+
+func (c *consumerGroup) Errors() <-chan error {
+	return c.errs
+}
+
+// Close 离开消费者组，其他成员重新分配分区
+func (c *consumerGroup) Close() error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.errs)
+	if !c.joined {
+		return nil
+	}
+	g := c.groupLocked()
+	g.members = slices.DeleteFunc(g.members, func(m *consumerGroup) bool { return m == c })
+	g.gen++
+	g.broadcast()
+	return nil
+}
+
+func (c *consumerGroup) Pause(partitions map[string][]int32)  {}
+func (c *consumerGroup) Resume(partitions map[string][]int32) {}
+func (c *consumerGroup) PauseAll()                            {}
+func (c *consumerGroup) ResumeAll()                           {}
+
+// session 实现 sarama.ConsumerGroupSession，MarkOffset 立即提交
+type session struct {
+	c      *consumerGroup
+	g      *group
+	ctx    context.Context
+	gen    int32
+	claims map[string][]int32
+}
+
+func (s *session) Claims() map[string][]int32 { return s.claims }
+func (s *session) MemberID() string           { return s.c.id }
+func (s *session) GenerationID() int32        { return s.gen }
+func (s *session) Context() context.Context   { return s.ctx }
+func (s *session) Commit()                    {}
+
+func (s *session) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.c.b.mu.Lock()
+	defer s.c.b.mu.Unlock()
+	tp := topicPartition{topic: topic, partition: partition}
+	if offset > s.g.offsets[tp] {
+		s.g.offsets[tp] = offset
+	}
+}
+
+func (s *session) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.c.b.mu.Lock()
+	defer s.c.b.mu.Unlock()
+	s.g.offsets[topicPartition{topic: topic, partition: partition}] = offset
+}
+
+func (s *session) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// claim 实现 sarama.ConsumerGroupClaim
+type claim struct {
+	tp      topicPartition
+	initial int64
+	hwm     int64
+	ch      chan *sarama.ConsumerMessage
+}
+
+func (c *claim) Topic() string                            { return c.tp.topic }
+func (c *claim) Partition() int32                         { return c.tp.partition }
+func (c *claim) InitialOffset() int64                     { return c.initial }
+func (c *claim) HighWaterMarkOffset() int64               { return c.hwm }
+func (c *claim) Messages() <-chan *sarama.ConsumerMessage { return c.ch }
+
+func toConsumerMessage(m *mqX.Message) *sarama.ConsumerMessage {
+	msg := &sarama.ConsumerMessage{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Value:     m.Value,
+		Timestamp: m.Timestamp,
+		Headers:   make([]*sarama.RecordHeader, 0, len(m.Headers)),
+	}
+	for _, h := range m.Headers {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(h.Key), Value: h.Value})
+	}
+	return msg
+}
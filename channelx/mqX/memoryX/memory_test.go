@@ -0,0 +1,237 @@
+package memoryX
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX/kafkaX/saramaX/consumerX"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder 记录收到的消息，单条、批量都支持
+type recorder struct {
+	batch   bool
+	fail    func(msg *mqX.Message) error
+	mu      sync.Mutex
+	msgs    []*mqX.Message
+	batches [][]*mqX.Message
+}
+
+func (r *recorder) IsBatch() bool { return r.batch }
+
+func (r *recorder) Handle(ctx context.Context, msg *mqX.Message) error {
+	if r.fail != nil {
+		if err := r.fail(msg); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+func (r *recorder) HandleBatch(ctx context.Context, msgs []*mqX.Message) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, msgs)
+	r.msgs = append(r.msgs, msgs...)
+	return true, nil
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.msgs)
+}
+
+func (r *recorder) snapshot() []*mqX.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*mqX.Message(nil), r.msgs...)
+}
+
+// subscribe 后台消费，返回停止函数
+func subscribe(t *testing.T, c mqX.Consumer, topics []string, h mqX.ConsumerHandlerType) (stop func() error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	res := make(chan error, 1)
+	go func() { res <- c.Subscribe(ctx, topics, h) }()
+	return func() error {
+		cancel()
+		return <-res
+	}
+}
+
+func send(t *testing.T, b *Broker, topic string, from, to int, key func(i int) []byte) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		require.NoError(t, b.Send(context.Background(), &mqX.Message{
+			Topic: topic, Key: key(i), Value: []byte(strconv.Itoa(i)),
+			Headers: []mqX.Header{{Key: "seq", Value: []byte(strconv.Itoa(i))}},
+		}))
+	}
+}
+
+func TestBroker_KeyPartition(t *testing.T) {
+	b := NewBroker(4)
+	byKey := map[string]int32{}
+	for i := 0; i < 40; i++ {
+		key := "user-" + strconv.Itoa(i%5)
+		msg := &mqX.Message{Topic: "user-events", Key: []byte(key), Value: []byte("v")}
+		require.NoError(t, b.Send(context.Background(), msg))
+		if p, ok := byKey[key]; ok {
+			assert.Equal(t, p, msg.Partition, key)
+		}
+		byKey[key] = msg.Partition
+	}
+	msgs := b.Messages("user-events")
+	assert.Len(t, msgs, 40)
+	next := map[int32]int64{}
+	for _, m := range msgs {
+		assert.Equal(t, next[m.Partition], m.Offset)
+		next[m.Partition]++
+		assert.False(t, m.Timestamp.IsZero())
+	}
+
+	// 没有 Key 时轮询
+	b.CreateTopic("logs", 3)
+	for i := 0; i < 6; i++ {
+		msg := &mqX.Message{Topic: "logs"}
+		require.NoError(t, b.Send(context.Background(), msg))
+		assert.Equal(t, int32(i%3), msg.Partition)
+	}
+
+	require.NoError(t, b.Close())
+	assert.ErrorIs(t, b.Send(context.Background(), &mqX.Message{Topic: "logs"}), ErrBrokerClosed)
+}
+
+func TestBroker_ConsumeAndResume(t *testing.T) {
+	b := NewBroker(3)
+	key := func(i int) []byte { return []byte("k" + strconv.Itoa(i%7)) }
+	send(t, b, "user-events", 0, 10, key)
+
+	r := &recorder{}
+	stop := subscribe(t, b.Consumer("g1", nil), []string{"user-events"}, r)
+	require.Eventually(t, func() bool { return r.count() == 10 }, time.Second, time.Millisecond)
+	// 订阅之后的消息
+	send(t, b, "user-events", 10, 15, key)
+	require.Eventually(t, func() bool { return r.count() == 15 }, time.Second, time.Millisecond)
+	require.NoError(t, stop())
+
+	seq, _ := r.snapshot()[0].GetHeader("seq")
+	assert.NotEmpty(t, seq)
+	var committed int64
+	for p := int32(0); p < 3; p++ {
+		committed += b.CommittedOffset("g1", "user-events", p)
+	}
+	assert.Equal(t, int64(15), committed)
+
+	// 同一个组从提交的 offset 继续，新的组从头消费
+	send(t, b, "user-events", 15, 18, key)
+	r1, r2 := &recorder{}, &recorder{}
+	stop1 := subscribe(t, b.Consumer("g1", nil), []string{"user-events"}, r1)
+	stop2 := subscribe(t, b.Consumer("g2", nil), []string{"user-events"}, r2)
+	require.Eventually(t, func() bool { return r1.count() == 3 && r2.count() == 18 }, time.Second, time.Millisecond)
+	require.NoError(t, stop1())
+	require.NoError(t, stop2())
+	for _, m := range r1.snapshot() {
+		n, _ := strconv.Atoi(string(m.Value))
+		assert.GreaterOrEqual(t, n, 15)
+	}
+}
+
+func TestBroker_Batch(t *testing.T) {
+	b := NewBroker(1)
+	send(t, b, "t", 0, 7, func(int) []byte { return nil })
+
+	r := &recorder{batch: true}
+	stop := subscribe(t, b.Consumer("g", &consumerX.ConsumerConfig{BatchSize: 3, BatchTimeout: 50 * time.Millisecond}), []string{"t"}, r)
+	require.Eventually(t, func() bool { return r.count() == 7 }, time.Second, time.Millisecond)
+	require.NoError(t, stop())
+
+	var sizes []int
+	for _, batch := range r.batches {
+		sizes = append(sizes, len(batch))
+	}
+	// 最后一条由 BatchTimeout 触发
+	assert.Equal(t, []int{3, 3, 1}, sizes)
+	assert.Equal(t, int64(7), b.CommittedOffset("g", "t", 0))
+}
+
+func TestBroker_GroupMembers(t *testing.T) {
+	b := NewBroker(4)
+	ra, rb := &recorder{}, &recorder{}
+	stopA := subscribe(t, b.Consumer("g", nil), []string{"t"}, ra)
+	stopB := subscribe(t, b.Consumer("g", nil), []string{"t"}, rb)
+	// 等两个成员都拿到分区
+	time.Sleep(50 * time.Millisecond)
+
+	send(t, b, "t", 0, 40, func(i int) []byte { return []byte(strconv.Itoa(i)) })
+	require.Eventually(t, func() bool { return ra.count()+rb.count() == 40 }, time.Second, time.Millisecond)
+	assert.NotZero(t, ra.count())
+	assert.NotZero(t, rb.count())
+	partitions := map[int32]bool{}
+	for _, m := range ra.snapshot() {
+		partitions[m.Partition] = true
+	}
+	for _, m := range rb.snapshot() {
+		assert.False(t, partitions[m.Partition], "分区只分给一个成员")
+	}
+
+	// 一个成员离开后另一个接管全部分区
+	require.NoError(t, stopA())
+	send(t, b, "t", 40, 60, func(i int) []byte { return []byte(strconv.Itoa(i)) })
+	require.Eventually(t, func() bool { return ra.count()+rb.count() == 60 }, time.Second, time.Millisecond)
+	require.NoError(t, stopB())
+
+	seen := map[string]bool{}
+	for _, m := range append(ra.snapshot(), rb.snapshot()...) {
+		assert.False(t, seen[string(m.Value)], "重复消费 %s", m.Value)
+		seen[string(m.Value)] = true
+	}
+}
+
+func TestBroker_HandlerError(t *testing.T) {
+	b := NewBroker(1)
+	send(t, b, "t", 0, 3, func(int) []byte { return nil })
+	r := &recorder{fail: func(msg *mqX.Message) error {
+		if msg.Offset == 1 {
+			return errors.New("db down")
+		}
+		return nil
+	}}
+	err := b.Consumer("g", nil).Subscribe(context.Background(), []string{"t"}, r)
+	assert.EqualError(t, err, "db down")
+	assert.Equal(t, int64(1), b.CommittedOffset("g", "t", 0))
+}
+
+func TestBroker_FailurePolicy(t *testing.T) {
+	b := NewBroker(2)
+	policy := &consumerX.FailurePolicy{Producer: b}
+	r := &recorder{fail: func(msg *mqX.Message) error {
+		if string(msg.Value) == "2" {
+			return errors.New("poison")
+		}
+		return nil
+	}}
+	stop := subscribe(t, b.Consumer("g", &consumerX.ConsumerConfig{FailurePolicy: policy}), []string{"t"}, r)
+	send(t, b, "t", 0, 5, func(i int) []byte { return []byte(strconv.Itoa(i)) })
+	require.Eventually(t, func() bool { return r.count() == 4 }, time.Second, time.Millisecond)
+	require.NoError(t, stop())
+
+	dlq := b.Messages("t.dlq")
+	require.Len(t, dlq, 1)
+	assert.Equal(t, "2", string(dlq[0].Value))
+	cause, _ := dlq[0].GetHeader(consumerX.HeaderError)
+	assert.Equal(t, "poison", string(cause))
+	replay := consumerX.ReplayMessage(dlq[0])
+	assert.Equal(t, "t", replay.Topic)
+	assert.Equal(t, []mqX.Header{{Key: "seq", Value: []byte("2")}}, replay.Headers)
+}
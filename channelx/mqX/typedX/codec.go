@@ -0,0 +1,71 @@
+package typedX
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// HeaderContentType 生产时记录编码格式的消息头，消费时按它选择 Codec
+const HeaderContentType = "content-type"
+
+var ErrUnknownContentType = errors.New("未注册的消息编码格式")
+
+// Codec 消息体编解码
+//   - Unmarshal 的 v 为指针
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encoding/json 编解码
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return "application/json" }
+
+func (JSONCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// ProtoCodec protobuf 编解码，T 需为 proto 消息的指针类型，如 *pb.User
+type ProtoCodec struct{}
+
+func (ProtoCodec) ContentType() string { return "application/x-protobuf" }
+
+func (ProtoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T 不是 proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T 不是 proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// GobCodec encoding/gob 编解码，适合生产、消费都是 Go 服务的场景
+type GobCodec struct{}
+
+func (GobCodec) ContentType() string { return "application/x-gob" }
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
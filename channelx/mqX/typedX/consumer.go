@@ -0,0 +1,132 @@
+package typedX
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/hgg-6/pkgTool/v2/logx"
+)
+
+// HandleFn 解码后的单条业务处理
+type HandleFn[T any] func(ctx context.Context, msg *mqX.Message, data T) error
+
+// HandleBatchFn 解码后的批量业务处理，msgs 与 data 一一对应，不含解码失败的消息
+type HandleBatchFn[T any] func(ctx context.Context, msgs []*mqX.Message, data []T) (success bool, err error)
+
+// DecodeErrorFn 解码失败的处理，返回 nil 时跳过该消息，返回错误时交给底层消费者【如 consumerX 的 FailurePolicy】
+type DecodeErrorFn func(ctx context.Context, msg *mqX.Message, err error) error
+
+// TypedConsumer 按消息头 content-type 选择 Codec 解码后再交给业务处理的消费者
+type TypedConsumer[T any] struct {
+	consumer      mqX.Consumer
+	codec         Codec
+	codecs        map[string]Codec
+	onDecodeError DecodeErrorFn
+	l             logx.Loggerx
+}
+
+// NewTypedConsumer 创建类型化消费者
+//   - codec 为没有 content-type 消息头时使用的编码格式，nil 时使用 JSONCodec
+//   - 默认解码失败时记录日志并跳过该消息，不会结束 claim
+func NewTypedConsumer[T any](consumer mqX.Consumer, codec Codec, l logx.Loggerx) *TypedConsumer[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	c := &TypedConsumer[T]{
+		consumer: consumer,
+		codec:    codec,
+		codecs:   map[string]Codec{codec.ContentType(): codec},
+		l:        l,
+	}
+	c.onDecodeError = c.skipDecodeError
+	return c
+}
+
+// Codecs 注册更多编码格式，兼容迁移期间不同编码的生产者
+func (c *TypedConsumer[T]) Codecs(codecs ...Codec) *TypedConsumer[T] {
+	for _, codec := range codecs {
+		c.codecs[codec.ContentType()] = codec
+	}
+	return c
+}
+
+// OnDecodeError 设置解码失败的处理
+func (c *TypedConsumer[T]) OnDecodeError(fn DecodeErrorFn) *TypedConsumer[T] {
+	c.onDecodeError = fn
+	return c
+}
+
+// Subscribe 单条消费
+func (c *TypedConsumer[T]) Subscribe(ctx context.Context, topics []string, fn HandleFn[T]) error {
+	return c.consumer.Subscribe(ctx, topics, &handlerAdapter[T]{c: c, fn: fn})
+}
+
+// SubscribeBatch 批量消费
+func (c *TypedConsumer[T]) SubscribeBatch(ctx context.Context, topics []string, fn HandleBatchFn[T]) error {
+	return c.consumer.Subscribe(ctx, topics, &handlerAdapter[T]{c: c, batchFn: fn})
+}
+
+// Decode 按消息头 content-type 解码，T 为指针类型时分配新的对象
+func (c *TypedConsumer[T]) Decode(msg *mqX.Message) (T, error) {
+	var data T
+	codec := c.codec
+	if ct, ok := msg.GetHeader(HeaderContentType); ok {
+		if codec, ok = c.codecs[string(ct)]; !ok {
+			return data, fmt.Errorf("%w: %s", ErrUnknownContentType, ct)
+		}
+	}
+	if typ := reflect.TypeFor[T](); typ.Kind() == reflect.Pointer {
+		data = reflect.New(typ.Elem()).Interface().(T)
+		return data, codec.Unmarshal(msg.Value, data)
+	}
+	return data, codec.Unmarshal(msg.Value, &data)
+}
+
+func (c *TypedConsumer[T]) skipDecodeError(ctx context.Context, msg *mqX.Message, err error) error {
+	if c.l != nil {
+		c.l.Error("消息解码失败，跳过", logx.String("topic", msg.Topic),
+			logx.Int32("partition", msg.Partition), logx.Int64("offset", msg.Offset), logx.Error(err))
+	}
+	return nil
+}
+
+// handlerAdapter 适配 mqX.ConsumerHandlerType
+type handlerAdapter[T any] struct {
+	c       *TypedConsumer[T]
+	fn      HandleFn[T]
+	batchFn HandleBatchFn[T]
+}
+
+func (h *handlerAdapter[T]) IsBatch() bool {
+	return h.batchFn != nil
+}
+
+func (h *handlerAdapter[T]) Handle(ctx context.Context, msg *mqX.Message) error {
+	data, err := h.c.Decode(msg)
+	if err != nil {
+		return h.c.onDecodeError(ctx, msg, err)
+	}
+	return h.fn(ctx, msg, data)
+}
+
+func (h *handlerAdapter[T]) HandleBatch(ctx context.Context, msgs []*mqX.Message) (bool, error) {
+	ok := make([]*mqX.Message, 0, len(msgs))
+	data := make([]T, 0, len(msgs))
+	for _, msg := range msgs {
+		d, err := h.c.Decode(msg)
+		if err != nil {
+			if err = h.c.onDecodeError(ctx, msg, err); err != nil {
+				return false, err
+			}
+			continue
+		}
+		ok = append(ok, msg)
+		data = append(data, d)
+	}
+	if len(ok) == 0 {
+		return true, nil
+	}
+	return h.batchFn(ctx, ok, data)
+}
@@ -0,0 +1,71 @@
+package typedX
+
+import (
+	"context"
+
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+)
+
+// Message 待发送的类型化消息，Headers 为业务消息头，content-type 由 TypedProducer 写入
+type Message[T any] struct {
+	Topic   string
+	Key     []byte
+	Headers []mqX.Header
+	Data    T
+}
+
+// TypedProducer 按 Codec 编码后发送的生产者
+type TypedProducer[T any] struct {
+	producer mqX.Producer
+	codec    Codec
+}
+
+// NewTypedProducer 创建类型化生产者，codec 为 nil 时使用 JSONCodec
+func NewTypedProducer[T any](producer mqX.Producer, codec Codec) *TypedProducer[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return &TypedProducer[T]{producer: producer, codec: codec}
+}
+
+// Send 编码 data 后发送到 topic
+func (p *TypedProducer[T]) Send(ctx context.Context, topic string, key []byte, data T) error {
+	return p.SendMessage(ctx, Message[T]{Topic: topic, Key: key, Data: data})
+}
+
+// SendMessage 发送带业务消息头的消息
+func (p *TypedProducer[T]) SendMessage(ctx context.Context, msg Message[T]) error {
+	m, err := p.Encode(msg)
+	if err != nil {
+		return err
+	}
+	return p.producer.Send(ctx, m)
+}
+
+// SendBatch 编码全部消息后批量发送，任一条编码失败时不发送
+func (p *TypedProducer[T]) SendBatch(ctx context.Context, msgs []Message[T]) error {
+	ms := make([]*mqX.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		m, err := p.Encode(msg)
+		if err != nil {
+			return err
+		}
+		ms = append(ms, m)
+	}
+	return p.producer.SendBatch(ctx, ms)
+}
+
+// Encode 编码为 mqX.Message，并在消息头记录编码格式
+func (p *TypedProducer[T]) Encode(msg Message[T]) (*mqX.Message, error) {
+	val, err := p.codec.Marshal(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	m := &mqX.Message{Topic: msg.Topic, Key: msg.Key, Value: val, Headers: append([]mqX.Header(nil), msg.Headers...)}
+	m.SetHeader(HeaderContentType, []byte(p.codec.ContentType()))
+	return m, nil
+}
+
+func (p *TypedProducer[T]) Close() error {
+	return p.producer.Close()
+}
@@ -0,0 +1,179 @@
+package typedX
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hgg-6/pkgTool/v2/channelx/mqX"
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeProducer 记录发送的消息
+type fakeProducer struct {
+	msgs []*mqX.Message
+}
+
+func (p *fakeProducer) Send(ctx context.Context, msg *mqX.Message) error {
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func (p *fakeProducer) SendBatch(ctx context.Context, msgs []*mqX.Message) error {
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *fakeProducer) Close() error { return nil }
+
+// fakeConsumer 把 msgs 交给 handler，批量模式一次交全部
+type fakeConsumer struct {
+	msgs []*mqX.Message
+}
+
+func (c *fakeConsumer) Subscribe(ctx context.Context, topics []string, handler mqX.ConsumerHandlerType) error {
+	if handler.IsBatch() {
+		_, err := handler.HandleBatch(ctx, c.msgs)
+		return err
+	}
+	for _, m := range c.msgs {
+		if err := handler.Handle(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type userEvent struct {
+	UserId int64
+	Name   string
+}
+
+func TestTyped_Codecs(t *testing.T) {
+	testCases := []struct {
+		name  string
+		codec Codec
+	}{
+		{name: "json", codec: JSONCodec{}},
+		{name: "gob", codec: GobCodec{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prod := &fakeProducer{}
+			p := NewTypedProducer[userEvent](prod, tc.codec)
+			require.NoError(t, p.SendMessage(context.Background(), Message[userEvent]{
+				Topic: "user-events", Key: []byte("1"),
+				Headers: []mqX.Header{{Key: "trace-id", Value: []byte("abc")}},
+				Data:    userEvent{UserId: 1, Name: "a"},
+			}))
+			require.Len(t, prod.msgs, 1)
+			ct, _ := prod.msgs[0].GetHeader(HeaderContentType)
+			assert.Equal(t, tc.codec.ContentType(), string(ct))
+			trace, _ := prod.msgs[0].GetHeader("trace-id")
+			assert.Equal(t, "abc", string(trace))
+
+			var got []userEvent
+			err := NewTypedConsumer[userEvent](&fakeConsumer{msgs: prod.msgs}, tc.codec, nil).
+				Subscribe(context.Background(), []string{"user-events"}, func(ctx context.Context, msg *mqX.Message, data userEvent) error {
+					got = append(got, data)
+					return nil
+				})
+			require.NoError(t, err)
+			assert.Equal(t, []userEvent{{UserId: 1, Name: "a"}}, got)
+		})
+	}
+}
+
+func TestTyped_Proto(t *testing.T) {
+	prod := &fakeProducer{}
+	p := NewTypedProducer[*wrapperspb.StringValue](prod, ProtoCodec{})
+	require.NoError(t, p.SendBatch(context.Background(), []Message[*wrapperspb.StringValue]{
+		{Topic: "t", Data: wrapperspb.String("a")},
+		{Topic: "t", Data: wrapperspb.String("b")},
+	}))
+
+	var got []string
+	err := NewTypedConsumer[*wrapperspb.StringValue](&fakeConsumer{msgs: prod.msgs}, ProtoCodec{}, nil).
+		SubscribeBatch(context.Background(), []string{"t"}, func(ctx context.Context, msgs []*mqX.Message, data []*wrapperspb.StringValue) (bool, error) {
+			for _, d := range data {
+				got = append(got, d.GetValue())
+			}
+			return true, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, got)
+
+	_, err = ProtoCodec{}.Marshal(userEvent{})
+	assert.Error(t, err)
+}
+
+func TestTyped_ContentTypeHeader(t *testing.T) {
+	prod := &fakeProducer{}
+	require.NoError(t, NewTypedProducer[userEvent](prod, GobCodec{}).Send(context.Background(), "t", nil, userEvent{UserId: 2}))
+	// 没有消息头的旧消息按默认 codec 解码
+	prod.msgs = append(prod.msgs, &mqX.Message{Topic: "t", Value: []byte(`{"UserId":3}`)})
+
+	var got []int64
+	fn := func(ctx context.Context, msg *mqX.Message, data userEvent) error {
+		got = append(got, data.UserId)
+		return nil
+	}
+	// 未注册 gob 时按 DecodeErrorFn 处理
+	var decodeErrs []error
+	err := NewTypedConsumer[userEvent](&fakeConsumer{msgs: prod.msgs}, JSONCodec{}, nil).
+		OnDecodeError(func(ctx context.Context, msg *mqX.Message, err error) error {
+			decodeErrs = append(decodeErrs, err)
+			return nil
+		}).
+		Subscribe(context.Background(), []string{"t"}, fn)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, got)
+	require.Len(t, decodeErrs, 1)
+	assert.ErrorIs(t, decodeErrs[0], ErrUnknownContentType)
+
+	got = nil
+	err = NewTypedConsumer[userEvent](&fakeConsumer{msgs: prod.msgs}, JSONCodec{}, nil).Codecs(GobCodec{}).
+		Subscribe(context.Background(), []string{"t"}, fn)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, got)
+}
+
+func TestTyped_DecodeError(t *testing.T) {
+	msgs := []*mqX.Message{
+		{Topic: "t", Offset: 1, Value: []byte(`{"UserId":1}`)},
+		{Topic: "t", Offset: 2, Value: []byte(`not json`)},
+		{Topic: "t", Offset: 3, Value: []byte(`{"UserId":3}`)},
+	}
+
+	// 默认记录日志并跳过
+	buf := &bytes.Buffer{}
+	var batch []*mqX.Message
+	err := NewTypedConsumer[*userEvent](&fakeConsumer{msgs: msgs}, nil, zerologx.NewZeroLogger(new(zerolog.New(buf)))).
+		SubscribeBatch(context.Background(), []string{"t"}, func(ctx context.Context, ms []*mqX.Message, data []*userEvent) (bool, error) {
+			batch = ms
+			assert.Equal(t, int64(3), data[1].UserId)
+			return true, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []*mqX.Message{msgs[0], msgs[2]}, batch)
+	assert.Contains(t, buf.String(), "消息解码失败")
+	assert.Contains(t, buf.String(), `"offset":2`)
+
+	// 返回错误时交给底层消费者
+	var handled int
+	err = NewTypedConsumer[userEvent](&fakeConsumer{msgs: msgs}, nil, nil).
+		OnDecodeError(func(ctx context.Context, msg *mqX.Message, err error) error {
+			return errors.Join(errors.New("poison"), err)
+		}).
+		Subscribe(context.Background(), []string{"t"}, func(ctx context.Context, msg *mqX.Message, data userEvent) error {
+			handled++
+			return nil
+		})
+	assert.ErrorContains(t, err, "poison")
+	assert.Equal(t, 1, handled)
+}
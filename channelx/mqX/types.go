@@ -2,7 +2,10 @@ package mqX
 
 // messageQueuex/mq.go
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Message 通用消息结构，如果需要在处理程序调用之后保留它们，【请复制】。
 //   - represents a Kafka message.
@@ -19,9 +22,43 @@ import "context"
 //
 // msg.Value[0] = 'X' // 破坏原始数据，且可能影响底层 buffer（见下文）
 type Message struct {
-	Topic string
-	Key   []byte // read-only in handlers; copy if retained, 在处理程序中只读;如果保留则复制
-	Value []byte // read-only in handlers; copy if retained, 在处理程序中只读;如果保留则复制
+	Topic   string
+	Key     []byte   // read-only in handlers; copy if retained, 在处理程序中只读;如果保留则复制
+	Value   []byte   // read-only in handlers; copy if retained, 在处理程序中只读;如果保留则复制
+	Headers []Header // 消息头，透传 trace id、租户 id、schema 版本等，生产、消费双向映射
+
+	// 以下字段由消费者填充；同步生产者发送成功后回填 Partition、Offset
+	Partition int32
+	Offset    int64
+	// Timestamp 消息时间，生产时为零值则由客户端取当前时间
+	Timestamp time.Time
+}
+
+// Header 消息头，同一个 key 可以出现多次，按顺序保留
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// GetHeader 第一个 key 匹配的消息头
+func (m *Message) GetHeader(key string) ([]byte, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetHeader 设置消息头，替换同 key 的全部已有值
+func (m *Message) SetHeader(key string, value []byte) {
+	headers := m.Headers[:0:0]
+	for _, h := range m.Headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+	m.Headers = append(headers, Header{Key: key, Value: value})
 }
 
 // Producer 生产者抽象接口
@@ -0,0 +1,275 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/systemLoad/gopsutilx"
+)
+
+// BBRConfig 自适应限流配置
+type BBRConfig struct {
+	// Window 统计窗口，默认 10s
+	Window time.Duration
+	// Buckets 窗口分桶数，默认 100，即每 100ms 一个桶
+	Buckets int
+	// CPUThreshold CPU 使用率阈值【0-100】，超过时开始按最大并发数丢弃请求，默认 80
+	CPUThreshold float64
+	// CoolDown 丢弃请求后的冷却时间，CPU 回落后冷却期内仍按最大并发数丢弃，避免抖动，默认 1s
+	CoolDown time.Duration
+	// CPUInterval CPU 采样间隔，默认 500ms，采样值做指数平滑
+	CPUInterval time.Duration
+}
+
+// BBRStat 自适应限流的实时状态
+type BBRStat struct {
+	CPU         float64       // 平滑后的 CPU 使用率【0-100】
+	InFlight    int64         // 正在处理的请求数
+	MaxInFlight int64         // 当前估算的最大并发数 = 最大通过量 * 最小RT
+	MaxPass     int64         // 窗口内单个桶的最大完成数
+	MinRT       time.Duration // 窗口内单个桶的最小平均RT
+	Passed      int64         // 累计放行数
+	Dropped     int64         // 累计丢弃数
+}
+
+// BBRLimiter BBR 自适应限流器，不需要配置阈值，按系统负载自动丢弃请求
+//   - CPU 超过阈值且正在处理的请求数超过 最大通过量 * 最小RT 时丢弃请求
+//   - CPU 使用率来自 gopsutilx.SystemLoad，后台定时采样
+//   - 实现了 ReserveLimiter，key 不参与计算，请求完成后需调用 Reservation.Done 统计 RT，
+//     gin 的 limitX.NewRedisBuilder 和 gRPC 的 limiterX.NewInterceptorBuilder 会自动调用
+//   - Allow/Limit 只判断是否丢弃，不统计并发和 RT
+type BBRLimiter struct {
+	cfg       BBRConfig
+	bucketDur time.Duration
+	cpuUsage  func() (float64, error)
+	now       func() time.Time
+
+	cpu      atomic.Uint64 // math.Float64bits
+	inFlight atomic.Int64
+	passed   atomic.Int64
+	dropped  atomic.Int64
+
+	mu       sync.Mutex
+	buckets  []bbrBucket
+	prevDrop time.Time // 最近一次丢弃的时间，冷却期判断用
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// bbrBucket 一个桶内完成的请求数和累计 RT
+type bbrBucket struct {
+	epoch int64 // 桶对应的时间片序号，用于判断桶是否过期
+	pass  int64
+	rt    time.Duration
+}
+
+// NewBBRLimiter 创建自适应限流器，load 为 nil 时使用 gopsutilx.NewSystemLoad()
+func NewBBRLimiter(load *gopsutilx.SystemLoad, cfg BBRConfig) *BBRLimiter {
+	if load == nil {
+		load = gopsutilx.NewSystemLoad()
+	}
+	// interval 为 0 时返回距上次调用的平均使用率，不阻塞
+	return newBBRLimiter(func() (float64, error) { return load.CpuAllUsage(0) }, cfg)
+}
+
+func newBBRLimiter(cpuUsage func() (float64, error), cfg BBRConfig) *BBRLimiter {
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.Buckets <= 0 {
+		cfg.Buckets = 100
+	}
+	if cfg.CPUThreshold <= 0 {
+		cfg.CPUThreshold = 80
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = time.Second
+	}
+	if cfg.CPUInterval <= 0 {
+		cfg.CPUInterval = 500 * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &BBRLimiter{
+		cfg:       cfg,
+		bucketDur: max(cfg.Window/time.Duration(cfg.Buckets), time.Millisecond),
+		cpuUsage:  cpuUsage,
+		now:       time.Now,
+		buckets:   make([]bbrBucket, cfg.Buckets),
+		cancel:    cancel,
+	}
+	l.sampleCPU()
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(cfg.CPUInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.sampleCPU()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return l
+}
+
+// sampleCPU 采样 CPU 使用率，指数平滑避免毛刺，采样失败时保留上一次的值
+func (l *BBRLimiter) sampleCPU() {
+	cur, err := l.cpuUsage()
+	if err != nil {
+		return
+	}
+	const decay = 0.95
+	prev := math.Float64frombits(l.cpu.Load())
+	if prev == 0 {
+		// 第一次采样直接使用，避免启动时长时间偏低
+		l.cpu.Store(math.Float64bits(cur))
+		return
+	}
+	l.cpu.Store(math.Float64bits(prev*decay + cur*(1-decay)))
+}
+
+// Close 停止 CPU 采样
+func (l *BBRLimiter) Close() error {
+	l.cancel()
+	l.wg.Wait()
+	return nil
+}
+
+// Limit 实现 Limiter，返回 true 表示丢弃请求
+func (l *BBRLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return !l.Allow(key), nil
+}
+
+// Allow 是否放行，不统计并发和 RT
+func (l *BBRLimiter) Allow(key string) bool {
+	if l.shouldDrop() {
+		l.dropped.Add(1)
+		return false
+	}
+	return true
+}
+
+// Reserve 放行时占用一个并发，请求完成后调用 Done 统计 RT，Cancel 只归还并发
+func (l *BBRLimiter) Reserve(key string) *Reservation {
+	if l.shouldDrop() {
+		l.dropped.Add(1)
+		return NewReservation(false, l.cfg.CoolDown, 0, 0)
+	}
+	l.inFlight.Add(1)
+	l.passed.Add(1)
+	start := l.now()
+	return &Reservation{ok: true, release: func(canceled bool) {
+		l.inFlight.Add(-1)
+		if !canceled {
+			l.record(l.now(), l.now().Sub(start))
+		}
+	}}
+}
+
+// Wait 阻塞直到放行，ctx 结束时返回 ctx.Err()
+func (l *BBRLimiter) Wait(ctx context.Context, key string) (*Reservation, error) {
+	for {
+		if r := l.Reserve(key); r.OK() {
+			return r, nil
+		}
+		timer := time.NewTimer(pollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Stat 当前状态
+func (l *BBRLimiter) Stat() BBRStat {
+	maxPass, minRT := l.windowStat(l.now())
+	return BBRStat{
+		CPU:         math.Float64frombits(l.cpu.Load()),
+		InFlight:    l.inFlight.Load(),
+		MaxInFlight: l.maxInFlight(maxPass, minRT),
+		MaxPass:     maxPass,
+		MinRT:       minRT,
+		Passed:      l.passed.Load(),
+		Dropped:     l.dropped.Load(),
+	}
+}
+
+// record 把一次完成的请求记到当前桶
+func (l *BBRLimiter) record(now time.Time, rt time.Duration) {
+	epoch := now.UnixNano() / int64(l.bucketDur)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := &l.buckets[epoch%int64(len(l.buckets))]
+	if b.epoch != epoch {
+		*b = bbrBucket{epoch: epoch}
+	}
+	b.pass++
+	b.rt += rt
+}
+
+// windowStat 窗口内（不含当前桶）单桶最大完成数和最小平均RT，没有数据时为 1 和 1ms
+func (l *BBRLimiter) windowStat(now time.Time) (int64, time.Duration) {
+	cur := now.UnixNano() / int64(l.bucketDur)
+	var (
+		maxPass int64 = 1
+		minRT         = time.Duration(math.MaxInt64)
+	)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, b := range l.buckets {
+		if b.epoch >= cur || b.epoch <= cur-int64(len(l.buckets)) || b.pass == 0 {
+			continue
+		}
+		maxPass = max(maxPass, b.pass)
+		minRT = min(minRT, b.rt/time.Duration(b.pass))
+	}
+	if minRT == time.Duration(math.MaxInt64) {
+		minRT = time.Millisecond
+	}
+	return maxPass, max(minRT, time.Microsecond)
+}
+
+// maxInFlight 最大并发数 = 每秒最大通过量 * 最小RT【秒】，四舍五入且至少为 1
+func (l *BBRLimiter) maxInFlight(maxPass int64, minRT time.Duration) int64 {
+	perSecond := float64(time.Second) / float64(l.bucketDur)
+	return max(int64(math.Floor(float64(maxPass)*perSecond*minRT.Seconds()+0.5)), 1)
+}
+
+// shouldDrop CPU 过载或处于冷却期，且并发超过估算的最大并发数时丢弃
+func (l *BBRLimiter) shouldDrop() bool {
+	now := l.now()
+	cpu := math.Float64frombits(l.cpu.Load())
+	l.mu.Lock()
+	prevDrop := l.prevDrop
+	l.mu.Unlock()
+	if cpu < l.cfg.CPUThreshold {
+		if prevDrop.IsZero() {
+			return false
+		}
+		if now.Sub(prevDrop) > l.cfg.CoolDown {
+			l.mu.Lock()
+			l.prevDrop = time.Time{}
+			l.mu.Unlock()
+			return false
+		}
+	}
+	inFlight := l.inFlight.Load()
+	if inFlight <= 1 || inFlight <= l.maxInFlight(l.windowStat(now)) {
+		return false
+	}
+	if cpu >= l.cfg.CPUThreshold {
+		l.mu.Lock()
+		l.prevDrop = now
+		l.mu.Unlock()
+	}
+	return true
+}
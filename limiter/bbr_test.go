@@ -0,0 +1,80 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBBR(t *testing.T) (*BBRLimiter, *fakeClock) {
+	l := newBBRLimiter(func() (float64, error) { return 0, nil }, BBRConfig{Window: time.Second, Buckets: 10, CoolDown: time.Second})
+	t.Cleanup(func() { _ = l.Close() })
+	c := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l.now = c.Now
+	// 上一个桶完成 100 个请求，平均 RT 10ms，估算最大并发 100 * 10/s * 0.01s = 10
+	for i := 0; i < 100; i++ {
+		l.record(c.now, 10*time.Millisecond)
+	}
+	c.Add(100 * time.Millisecond)
+	return l, c
+}
+
+func TestBBRLimiter_Stat(t *testing.T) {
+	l, _ := newTestBBR(t)
+	stat := l.Stat()
+	assert.Equal(t, int64(100), stat.MaxPass)
+	assert.Equal(t, 10*time.Millisecond, stat.MinRT)
+	assert.Equal(t, int64(10), stat.MaxInFlight)
+}
+
+func TestBBRLimiter_Drop(t *testing.T) {
+	l, c := newTestBBR(t)
+	var held []*Reservation
+	// CPU 未过载时不丢弃
+	for i := 0; i < 20; i++ {
+		r := l.Reserve("")
+		require.True(t, r.OK())
+		held = append(held, r)
+	}
+	for _, r := range held[10:] {
+		r.Cancel()
+	}
+	held = held[:10]
+
+	// CPU 过载且并发超过估算值时丢弃
+	l.cpu.Store(math.Float64bits(90))
+	r := l.Reserve("")
+	require.True(t, r.OK())
+	held = append(held, r)
+	assert.False(t, l.Reserve("").OK())
+	assert.False(t, l.Allow(""))
+	assert.Equal(t, int64(2), l.Stat().Dropped)
+
+	// CPU 回落，冷却期内仍按并发丢弃，冷却期后放行
+	l.cpu.Store(math.Float64bits(10))
+	c.Add(500 * time.Millisecond)
+	assert.False(t, l.Reserve("").OK())
+	c.Add(time.Second)
+	assert.True(t, l.Reserve("").OK())
+
+	// 完成的请求计入当前桶
+	for _, r := range held {
+		r.Done()
+	}
+	assert.Equal(t, int64(1), l.Stat().InFlight)
+}
+
+func TestBBRLimiter_Take(t *testing.T) {
+	l, _ := newTestBBR(t)
+	l.cpu.Store(math.Float64bits(90))
+	r, err := Take(context.Background(), l, "")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.Equal(t, int64(1), l.Stat().InFlight)
+	r.Done()
+	assert.Equal(t, int64(0), l.Stat().InFlight)
+}
@@ -0,0 +1,32 @@
+-- Redis GCRA（通用信元速率算法）限流Lua脚本
+-- 一个key只保存理论到达时间TAT，按固定间隔匀速放行并允许一定突发
+
+-- KEYS[1]: 限流key
+-- ARGV[1]: 放行间隔（微秒），即 周期 / 周期内允许的请求数
+-- ARGV[2]: 突发数，TAT 最多领先当前时间 突发数 * 放行间隔
+-- 返回 {是否放行 1/0, 剩余突发额度, 建议重试时间（微秒）}
+
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+-- 使用redis服务端时间，避免多实例时钟不一致
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call('GET', key))
+if tat == nil or tat < now then
+    tat = now
+end
+
+local newTat = tat + interval
+local allowAt = newTat - burst * interval
+if now < allowAt then
+    -- 触发限流，不更新TAT
+    return {0, 0, allowAt - now}
+end
+
+-- TAT 回落到当前时间后key自动过期
+redis.call('SET', key, string.format('%d', newTat), 'PX', math.ceil((newTat - now) / 1000) + 1)
+
+return {1, math.floor((now - allowAt) / interval), 0}
@@ -0,0 +1,87 @@
+package limiterPrometheusx
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hgg-6/pkgTool/v2/limiter"
+	"github.com/hgg-6/pkgTool/v2/observationX/prometheusX"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BBRSource 提供自适应限流的实时状态，*limiter.BBRLimiter 实现了该接口
+type BBRSource interface {
+	Stat() limiter.BBRStat
+}
+
+// Collector 自适应限流监控指标，采集时读取 BBRLimiter.Stat
+//   - 同一个 PrometheusStr 只需创建一个 Collector，多个限流器用 WatchBBR 的 name 区分
+type Collector struct {
+	requests    *prometheus.Desc
+	cpu         *prometheus.Desc
+	inFlight    *prometheus.Desc
+	maxInFlight *prometheus.Desc
+	maxPass     *prometheus.Desc
+	minRT       *prometheus.Desc
+
+	mu      sync.RWMutex
+	sources map[string]BBRSource
+}
+
+// NewCollector 创建并注册自适应限流监控指标
+func NewCollector(px *prometheusX.PrometheusStr) *Collector {
+	c := &Collector{
+		requests: px.NewDesc("limiter_bbr_requests_total", "自适应限流判定次数，result 为 pass/drop",
+			[]string{"name", "result"}),
+		cpu: px.NewDesc("limiter_bbr_cpu_usage", "平滑后的 CPU 使用率【0-100】",
+			[]string{"name"}),
+		inFlight: px.NewDesc("limiter_bbr_inflight", "正在处理的请求数",
+			[]string{"name"}),
+		maxInFlight: px.NewDesc("limiter_bbr_max_inflight", "估算的最大并发数",
+			[]string{"name"}),
+		maxPass: px.NewDesc("limiter_bbr_max_pass", "窗口内单个桶的最大完成数",
+			[]string{"name"}),
+		minRT: px.NewDesc("limiter_bbr_min_rt_seconds", "窗口内单个桶的最小平均RT",
+			[]string{"name"}),
+
+		sources: make(map[string]BBRSource),
+	}
+	if err := px.Register(c); err != nil && !errors.Is(err, prometheusX.ErrAlreadyRegistered) {
+		panic(err)
+	}
+	return c
+}
+
+// WatchBBR 采集自适应限流器的放行/丢弃次数和并发估算
+func (c *Collector) WatchBBR(name string, s BBRSource) *Collector {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources[name] = s
+	return c
+}
+
+// Describe 实现 prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.requests
+	ch <- c.cpu
+	ch <- c.inFlight
+	ch <- c.maxInFlight
+	ch <- c.maxPass
+	ch <- c.minRT
+}
+
+// Collect 实现 prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, s := range c.sources {
+		st := s.Stat()
+		ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(st.Passed), name, "pass")
+		ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(st.Dropped), name, "drop")
+		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.GaugeValue, st.CPU, name)
+		ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(st.InFlight), name)
+		ch <- prometheus.MustNewConstMetric(c.maxInFlight, prometheus.GaugeValue, float64(st.MaxInFlight), name)
+		ch <- prometheus.MustNewConstMetric(c.maxPass, prometheus.GaugeValue, float64(st.MaxPass), name)
+		ch <- prometheus.MustNewConstMetric(c.minRT, prometheus.GaugeValue, st.MinRT.Seconds(), name)
+	}
+}
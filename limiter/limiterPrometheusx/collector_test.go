@@ -0,0 +1,51 @@
+package limiterPrometheusx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/limiter"
+	"github.com/hgg-6/pkgTool/v2/observationX/prometheusX"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ BBRSource = (*limiter.BBRLimiter)(nil)
+
+// fakeBBR 仅测试用的限流状态
+type fakeBBR struct{}
+
+func (fakeBBR) Stat() limiter.BBRStat {
+	return limiter.BBRStat{CPU: 85.5, InFlight: 12, MaxInFlight: 10, MaxPass: 100, MinRT: 10 * time.Millisecond, Passed: 1000, Dropped: 3}
+}
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	px := prometheusX.New(prometheusX.WithNamespace("hgg"), prometheusX.WithRegisterer(reg), prometheusX.WithGatherer(reg))
+	NewCollector(px).WatchBBR("api", fakeBBR{})
+	// 重复创建不会 panic
+	NewCollector(px)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP hgg_limiter_bbr_requests_total 自适应限流判定次数，result 为 pass/drop
+# TYPE hgg_limiter_bbr_requests_total counter
+hgg_limiter_bbr_requests_total{name="api",result="drop"} 3
+hgg_limiter_bbr_requests_total{name="api",result="pass"} 1000
+# HELP hgg_limiter_bbr_cpu_usage 平滑后的 CPU 使用率【0-100】
+# TYPE hgg_limiter_bbr_cpu_usage gauge
+hgg_limiter_bbr_cpu_usage{name="api"} 85.5
+# HELP hgg_limiter_bbr_inflight 正在处理的请求数
+# TYPE hgg_limiter_bbr_inflight gauge
+hgg_limiter_bbr_inflight{name="api"} 12
+# HELP hgg_limiter_bbr_max_inflight 估算的最大并发数
+# TYPE hgg_limiter_bbr_max_inflight gauge
+hgg_limiter_bbr_max_inflight{name="api"} 10
+# HELP hgg_limiter_bbr_min_rt_seconds 窗口内单个桶的最小平均RT
+# TYPE hgg_limiter_bbr_min_rt_seconds gauge
+hgg_limiter_bbr_min_rt_seconds{name="api"} 0.01
+`), "hgg_limiter_bbr_requests_total", "hgg_limiter_bbr_cpu_usage", "hgg_limiter_bbr_inflight",
+		"hgg_limiter_bbr_max_inflight", "hgg_limiter_bbr_min_rt_seconds")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,284 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrLimited Wait 在 ctx 超时前无法获得额度
+var ErrLimited = errors.New("触发限流")
+
+// pollInterval 并发计数器无法预知何时归还额度，Wait 按此间隔轮询
+const pollInterval = 10 * time.Millisecond
+
+// LocalLimiter 进程内限流器，每个 key 独立计数，长时间未访问且已回到初始状态的 key 会被回收
+//   - 通过 NewCounterLimiter/NewFixedWindowLimiter/NewSlidingWindowLimiter/NewTokenBucketLimiter/NewLeakyBucketLimiter 创建
+//   - 实现了 Limiter 和 ReserveLimiter，gin 和 gRPC 的限流中间件共用同一个实例即可共享同一份限流策略
+type LocalLimiter struct {
+	algorithm string
+	limit     int
+	newState  func() state
+
+	mu        sync.Mutex
+	states    map[string]*entry
+	ttl       time.Duration
+	maxWait   time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	st       state
+	lastSeen time.Time
+}
+
+// state 单个 key 的限流状态，由 LocalLimiter 加锁后调用
+type state interface {
+	// reserve 在 now 预约一个额度，maxWait 内无法执行时 ok 为 false 且不占用额度
+	//   - delay 为预约成功时需等待的时间，retryAfter 为被拒绝时建议的重试时间，未知时为 0
+	reserve(now time.Time, maxWait time.Duration) (delay, retryAfter time.Duration, ok bool)
+	// cancel 归还一个预约在 at 执行的额度
+	cancel(now, at time.Time)
+	// done 请求处理完成，只有并发计数器需要归还额度
+	done()
+	// remaining 剩余额度
+	remaining(now time.Time) int
+	// idle 是否已回到初始状态，可以回收
+	idle(now time.Time) bool
+}
+
+func newLocalLimiter(algorithm string, limit int, newState func() state) *LocalLimiter {
+	return &LocalLimiter{
+		algorithm: algorithm,
+		limit:     limit,
+		newState:  newState,
+		states:    make(map[string]*entry),
+		ttl:       10 * time.Minute,
+		now:       time.Now,
+	}
+}
+
+// TTL 设置 key 的回收时间，超过 ttl 未访问且已回到初始状态的 key 会被回收，默认 10min
+func (l *LocalLimiter) TTL(ttl time.Duration) *LocalLimiter {
+	if ttl > 0 {
+		l.ttl = ttl
+	}
+	return l
+}
+
+// MaxWait 设置 Reserve 可接受的最长等待时间，默认 0 即只预约立即可执行的额度
+//   - 大于 0 时 Reserve 可能返回 Delay > 0 的预约，调用方需等待 Delay 后再执行
+func (l *LocalLimiter) MaxWait(maxWait time.Duration) *LocalLimiter {
+	l.maxWait = maxWait
+	return l
+}
+
+// Algorithm 限流算法名，用于日志和错误信息
+func (l *LocalLimiter) Algorithm() string {
+	return l.algorithm
+}
+
+// Limit 实现 Limiter，返回 true 表示触发限流
+//   - 并发计数器放行后需调用 Release 归还额度，建议使用 Reserve + Reservation.Done
+func (l *LocalLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return !l.Allow(key), nil
+}
+
+// Allow 是否立即放行，放行时占用一个额度
+func (l *LocalLimiter) Allow(key string) bool {
+	return l.reserve(key, 0).OK()
+}
+
+// Reserve 预约一个额度，最长等待时间见 MaxWait
+func (l *LocalLimiter) Reserve(key string) *Reservation {
+	return l.reserve(key, l.maxWait)
+}
+
+// Wait 阻塞直到获得额度，ctx 有截止时间且截止前无法获得时返回 ErrLimited
+func (l *LocalLimiter) Wait(ctx context.Context, key string) (*Reservation, error) {
+	for {
+		maxWait := time.Duration(math.MaxInt64)
+		deadline, hasDeadline := ctx.Deadline()
+		if hasDeadline {
+			maxWait = time.Until(deadline)
+		}
+		r := l.reserve(key, maxWait)
+		wait := r.delay
+		if !r.ok {
+			if hasDeadline && r.retryAfter > maxWait {
+				return nil, ErrLimited
+			}
+			wait = r.retryAfter
+			if wait <= 0 {
+				wait = pollInterval
+			}
+		}
+		if r.ok && wait <= 0 {
+			return r, nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			if r.ok {
+				return r, nil
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			if r.ok {
+				r.Cancel()
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Release 归还 key 的一个并发额度，只对并发计数器有效
+func (l *LocalLimiter) Release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.states[key]; ok {
+		e.st.done()
+	}
+}
+
+// Remaining key 当前的剩余额度，不占用额度
+func (l *LocalLimiter) Remaining(key string) int {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.states[key]
+	if !ok {
+		return l.limit
+	}
+	return e.st.remaining(now)
+}
+
+// Len 当前保存状态的 key 数量
+func (l *LocalLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.states)
+}
+
+func (l *LocalLimiter) reserve(key string, maxWait time.Duration) *Reservation {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	e, ok := l.states[key]
+	if !ok {
+		e = &entry{st: l.newState()}
+		l.states[key] = e
+	}
+	e.lastSeen = now
+	delay, retryAfter, ok := e.st.reserve(now, maxWait)
+	return &Reservation{
+		ok:         ok,
+		delay:      delay,
+		retryAfter: retryAfter,
+		limit:      l.limit,
+		remaining:  e.st.remaining(now),
+		at:         now.Add(delay),
+		key:        key,
+		l:          l,
+	}
+}
+
+// sweep 回收过期的 key，每个 ttl 最多扫描一次
+func (l *LocalLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.ttl {
+		return
+	}
+	l.lastSweep = now
+	for key, e := range l.states {
+		if now.Sub(e.lastSeen) >= l.ttl && e.st.idle(now) {
+			delete(l.states, key)
+		}
+	}
+}
+
+// Reservation 一次预约的结果
+type Reservation struct {
+	ok         bool
+	delay      time.Duration
+	retryAfter time.Duration
+	limit      int
+	remaining  int
+
+	at      time.Time
+	key     string
+	l       *LocalLimiter
+	release func(canceled bool) // 非 LocalLimiter 的限流器【如 BBRLimiter】归还额度
+	once    sync.Once
+}
+
+// NewReservation 创建预约结果，供不需要归还额度的限流器（如 Redis 限流器）使用
+func NewReservation(ok bool, retryAfter time.Duration, limit, remaining int) *Reservation {
+	return &Reservation{ok: ok, retryAfter: retryAfter, limit: limit, remaining: remaining}
+}
+
+// OK 是否获得额度
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay 获得额度后还需等待多久才能执行
+func (r *Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// RetryAfter 被拒绝时建议多久后重试，未知时为 0
+func (r *Reservation) RetryAfter() time.Duration {
+	return r.retryAfter
+}
+
+// Limit 限流阈值
+func (r *Reservation) Limit() int {
+	return r.limit
+}
+
+// Remaining 预约后的剩余额度
+func (r *Reservation) Remaining() int {
+	return r.remaining
+}
+
+// Cancel 放弃执行，归还额度，与 Done 只有第一次调用生效
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	if r.release != nil {
+		r.once.Do(func() { r.release(true) })
+		return
+	}
+	if r.l == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.l.mu.Lock()
+		defer r.l.mu.Unlock()
+		if e, ok := r.l.states[r.key]; ok {
+			e.st.cancel(r.l.now(), r.at)
+		}
+	})
+}
+
+// Done 请求处理完成，并发计数器归还额度、BBRLimiter 统计 RT，其它算法无操作，与 Cancel 只有第一次调用生效
+func (r *Reservation) Done() {
+	if !r.ok {
+		return
+	}
+	if r.release != nil {
+		r.once.Do(func() { r.release(false) })
+		return
+	}
+	if r.l == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.l.Release(r.key)
+	})
+}
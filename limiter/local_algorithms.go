@@ -0,0 +1,317 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// NewCounterLimiter 并发计数器限流，同时处理中的请求数不超过 threshold
+//   - 请求处理完成后需调用 Reservation.Done 或 LocalLimiter.Release 归还额度
+func NewCounterLimiter(threshold int) *LocalLimiter {
+	threshold = max(threshold, 0)
+	return newLocalLimiter("计数器限流", threshold, func() state {
+		return &counterState{threshold: threshold}
+	})
+}
+
+// NewFixedWindowLimiter 固定窗口限流，每个 window 内最多放行 threshold 个请求
+func NewFixedWindowLimiter(window time.Duration, threshold int) *LocalLimiter {
+	window, threshold = normalizeWindow(window), max(threshold, 0)
+	return newLocalLimiter("固定窗口限流", threshold, func() state {
+		return &fixedWindowState{window: window, threshold: threshold}
+	})
+}
+
+// NewSlidingWindowLimiter 滑动窗口限流，任意 window 时长内最多放行 threshold 个请求
+func NewSlidingWindowLimiter(window time.Duration, threshold int) *LocalLimiter {
+	window, threshold = normalizeWindow(window), max(threshold, 0)
+	return newLocalLimiter("滑动窗口限流", threshold, func() state {
+		return &slidingWindowState{window: window, threshold: threshold}
+	})
+}
+
+// NewTokenBucketLimiter 令牌桶限流，每 interval 产生一个令牌，桶容量 capacity，初始为满桶，允许 capacity 的突发
+func NewTokenBucketLimiter(interval time.Duration, capacity int) *LocalLimiter {
+	interval, capacity = normalizeInterval(interval), max(capacity, 1)
+	return newLocalLimiter("令牌桶限流", capacity, func() state {
+		return &tokenBucketState{interval: interval, capacity: capacity}
+	})
+}
+
+// NewLeakyBucketLimiter 漏桶限流，请求以每 interval 一个的速率匀速放行，最多 capacity 个请求排队
+//   - Allow 只放行无需排队的请求，需要排队时配合 MaxWait 或 Wait 使用
+func NewLeakyBucketLimiter(interval time.Duration, capacity int) *LocalLimiter {
+	interval, capacity = normalizeInterval(interval), max(capacity, 1)
+	return newLocalLimiter("漏桶限流", capacity, func() state {
+		return &leakyBucketState{interval: interval, capacity: capacity}
+	})
+}
+
+func normalizeWindow(window time.Duration) time.Duration {
+	if window <= 0 {
+		return time.Second
+	}
+	return window
+}
+
+func normalizeInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 100 * time.Millisecond
+	}
+	return interval
+}
+
+// counterState 并发计数器
+type counterState struct {
+	threshold int
+	cur       int
+}
+
+func (s *counterState) reserve(now time.Time, maxWait time.Duration) (time.Duration, time.Duration, bool) {
+	if s.cur >= s.threshold {
+		// 无法预知何时有请求处理完成
+		return 0, 0, false
+	}
+	s.cur++
+	return 0, 0, true
+}
+
+func (s *counterState) cancel(now, at time.Time) {
+	s.done()
+}
+
+func (s *counterState) done() {
+	if s.cur > 0 {
+		s.cur--
+	}
+}
+
+func (s *counterState) remaining(now time.Time) int {
+	return s.threshold - s.cur
+}
+
+func (s *counterState) idle(now time.Time) bool {
+	return s.cur == 0
+}
+
+// fixedWindowState 固定窗口，允许预约下一个窗口的额度
+type fixedWindowState struct {
+	window    time.Duration
+	threshold int
+	start     time.Time // 当前窗口开始时间
+	cur       int       // 当前窗口已放行数
+	next      int       // 下一个窗口已预约数
+}
+
+// advance 推进到 now 所在的窗口
+func (s *fixedWindowState) advance(now time.Time) {
+	if s.start.IsZero() {
+		s.start = now
+		return
+	}
+	elapsed := now.Sub(s.start)
+	if elapsed < s.window {
+		return
+	}
+	n := elapsed / s.window
+	s.start = s.start.Add(n * s.window)
+	if n == 1 {
+		s.cur, s.next = s.next, 0
+	} else {
+		s.cur, s.next = 0, 0
+	}
+}
+
+func (s *fixedWindowState) reserve(now time.Time, maxWait time.Duration) (time.Duration, time.Duration, bool) {
+	s.advance(now)
+	if s.cur < s.threshold {
+		s.cur++
+		return 0, 0, true
+	}
+	wait := s.start.Add(s.window).Sub(now)
+	if s.next >= s.threshold {
+		return 0, wait + s.window, false
+	}
+	if wait > maxWait {
+		return 0, wait, false
+	}
+	s.next++
+	return wait, 0, true
+}
+
+func (s *fixedWindowState) cancel(now, at time.Time) {
+	s.advance(now)
+	end := s.start.Add(s.window)
+	switch {
+	case at.Before(s.start):
+		// 所在窗口已过期，无需归还
+	case at.Before(end):
+		s.cur = max(s.cur-1, 0)
+	default:
+		s.next = max(s.next-1, 0)
+	}
+}
+
+func (s *fixedWindowState) done() {}
+
+func (s *fixedWindowState) remaining(now time.Time) int {
+	s.advance(now)
+	return max(s.threshold-s.cur, 0)
+}
+
+func (s *fixedWindowState) idle(now time.Time) bool {
+	s.advance(now)
+	return s.cur == 0 && s.next == 0
+}
+
+// slidingWindowState 滑动窗口，按时间顺序记录已放行（含预约在未来）的请求时间
+type slidingWindowState struct {
+	window    time.Duration
+	threshold int
+	queue     []time.Time
+}
+
+// evict 移除已滑出窗口的请求
+func (s *slidingWindowState) evict(now time.Time) {
+	windowStart := now.Add(-s.window)
+	i := 0
+	for i < len(s.queue) && !s.queue[i].After(windowStart) {
+		i++
+	}
+	if i > 0 {
+		s.queue = append(s.queue[:0], s.queue[i:]...)
+	}
+}
+
+func (s *slidingWindowState) reserve(now time.Time, maxWait time.Duration) (time.Duration, time.Duration, bool) {
+	if s.threshold == 0 {
+		return 0, 0, false
+	}
+	s.evict(now)
+	at := now
+	if len(s.queue) >= s.threshold {
+		// 往前数第 threshold 个请求滑出窗口后才有额度
+		at = s.queue[len(s.queue)-s.threshold].Add(s.window)
+	}
+	delay := max(at.Sub(now), 0)
+	if delay > maxWait {
+		return 0, delay, false
+	}
+	s.queue = append(s.queue, now.Add(delay))
+	return delay, 0, true
+}
+
+func (s *slidingWindowState) cancel(now, at time.Time) {
+	s.evict(now)
+	for i := len(s.queue) - 1; i >= 0; i-- {
+		if s.queue[i].Equal(at) {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *slidingWindowState) done() {}
+
+func (s *slidingWindowState) remaining(now time.Time) int {
+	s.evict(now)
+	return max(s.threshold-len(s.queue), 0)
+}
+
+func (s *slidingWindowState) idle(now time.Time) bool {
+	s.evict(now)
+	return len(s.queue) == 0
+}
+
+// tokenBucketState 令牌桶，按时间差惰性补充令牌，令牌可透支用于预约
+type tokenBucketState struct {
+	interval time.Duration
+	capacity int
+	tokens   float64
+	last     time.Time
+}
+
+func (s *tokenBucketState) refill(now time.Time) {
+	if s.last.IsZero() {
+		s.tokens, s.last = float64(s.capacity), now
+		return
+	}
+	if now.After(s.last) {
+		s.tokens = math.Min(float64(s.capacity), s.tokens+float64(now.Sub(s.last))/float64(s.interval))
+		s.last = now
+	}
+}
+
+func (s *tokenBucketState) reserve(now time.Time, maxWait time.Duration) (time.Duration, time.Duration, bool) {
+	s.refill(now)
+	if s.tokens >= 1 {
+		s.tokens--
+		return 0, 0, true
+	}
+	wait := time.Duration((1 - s.tokens) * float64(s.interval))
+	if wait > maxWait {
+		return 0, wait, false
+	}
+	s.tokens--
+	return wait, 0, true
+}
+
+func (s *tokenBucketState) cancel(now, at time.Time) {
+	s.refill(now)
+	s.tokens = math.Min(float64(s.capacity), s.tokens+1)
+}
+
+func (s *tokenBucketState) done() {}
+
+func (s *tokenBucketState) remaining(now time.Time) int {
+	s.refill(now)
+	return max(int(s.tokens), 0)
+}
+
+func (s *tokenBucketState) idle(now time.Time) bool {
+	s.refill(now)
+	return s.tokens >= float64(s.capacity)
+}
+
+// leakyBucketState 漏桶，每个请求占用一个 interval 的放行时间片
+type leakyBucketState struct {
+	interval time.Duration
+	capacity int
+	next     time.Time // 下一个可用的放行时间
+}
+
+func (s *leakyBucketState) reserve(now time.Time, maxWait time.Duration) (time.Duration, time.Duration, bool) {
+	if s.next.Before(now) {
+		s.next = now
+	}
+	delay := s.next.Sub(now)
+	if queued := int(delay / s.interval); queued >= s.capacity {
+		// 排队已满，等到队列里空出一个位置
+		return 0, delay - time.Duration(s.capacity-1)*s.interval, false
+	}
+	if delay > maxWait {
+		return 0, delay, false
+	}
+	s.next = s.next.Add(s.interval)
+	return delay, 0, true
+}
+
+func (s *leakyBucketState) cancel(now, at time.Time) {
+	if s.next.Sub(now) >= s.interval {
+		s.next = s.next.Add(-s.interval)
+	}
+}
+
+func (s *leakyBucketState) done() {}
+
+func (s *leakyBucketState) remaining(now time.Time) int {
+	queued := 0
+	if s.next.After(now) {
+		queued = int((s.next.Sub(now) + s.interval - 1) / s.interval)
+	}
+	return max(s.capacity-queued, 0)
+}
+
+func (s *leakyBucketState) idle(now time.Time) bool {
+	return !s.next.After(now)
+}
@@ -0,0 +1,196 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func withClock(l *LocalLimiter) (*LocalLimiter, *fakeClock) {
+	c := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l.now = c.Now
+	return l, c
+}
+
+func TestLocalLimiter_Counter(t *testing.T) {
+	l, _ := withClock(NewCounterLimiter(2))
+	r1 := l.Reserve("k")
+	r2 := l.Reserve("k")
+	assert.True(t, r1.OK())
+	assert.True(t, r2.OK())
+	assert.False(t, l.Allow("k"))
+	// 不同 key 互不影响
+	assert.True(t, l.Allow("other"))
+
+	r1.Done()
+	r1.Done() // 重复调用只归还一次
+	assert.Equal(t, 1, l.Remaining("k"))
+	assert.True(t, l.Allow("k"))
+	assert.False(t, l.Allow("k"))
+}
+
+func TestLocalLimiter_FixedWindow(t *testing.T) {
+	l, c := withClock(NewFixedWindowLimiter(time.Second, 2))
+	assert.True(t, l.Allow("k"))
+	assert.True(t, l.Allow("k"))
+	r := l.Reserve("k")
+	assert.False(t, r.OK())
+	assert.Equal(t, time.Second, r.RetryAfter())
+
+	// 预约下一个窗口
+	l.MaxWait(time.Second)
+	c.Add(400 * time.Millisecond)
+	r = l.Reserve("k")
+	require.True(t, r.OK())
+	assert.Equal(t, 600*time.Millisecond, r.Delay())
+
+	c.Add(600 * time.Millisecond)
+	// 新窗口已被预约占用一个
+	assert.Equal(t, 1, l.Remaining("k"))
+	assert.True(t, l.Allow("k"))
+	assert.False(t, l.Allow("k"))
+}
+
+func TestLocalLimiter_SlidingWindow(t *testing.T) {
+	l, c := withClock(NewSlidingWindowLimiter(time.Second, 2))
+	assert.True(t, l.Allow("k"))
+	c.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("k"))
+	r := l.Reserve("k")
+	assert.False(t, r.OK())
+	// 第一个请求滑出窗口后才有额度
+	assert.Equal(t, 500*time.Millisecond, r.RetryAfter())
+
+	c.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("k"))
+	assert.False(t, l.Allow("k"))
+	assert.Equal(t, 0, l.Remaining("k"))
+
+	assert.False(t, NewSlidingWindowLimiter(time.Second, 0).Allow("k"))
+}
+
+func TestLocalLimiter_TokenBucket(t *testing.T) {
+	l, c := withClock(NewTokenBucketLimiter(100*time.Millisecond, 3))
+	// 初始满桶，允许突发
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow("k"))
+	}
+	r := l.Reserve("k")
+	assert.False(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.RetryAfter())
+
+	c.Add(250 * time.Millisecond)
+	assert.Equal(t, 2, l.Remaining("k"))
+
+	l.MaxWait(200 * time.Millisecond)
+	assert.True(t, l.Reserve("k").OK())
+	assert.True(t, l.Reserve("k").OK())
+	r = l.Reserve("k")
+	require.True(t, r.OK())
+	assert.Equal(t, 50*time.Millisecond, r.Delay())
+	// 取消后额度归还
+	r.Cancel()
+	r = l.Reserve("k")
+	require.True(t, r.OK())
+	assert.Equal(t, 50*time.Millisecond, r.Delay())
+}
+
+func TestLocalLimiter_LeakyBucket(t *testing.T) {
+	l, c := withClock(NewLeakyBucketLimiter(100*time.Millisecond, 3))
+	assert.True(t, l.Allow("k"))
+	// 匀速放行，不允许突发
+	assert.False(t, l.Allow("k"))
+
+	l.MaxWait(time.Second)
+	r := l.Reserve("k")
+	require.True(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.Delay())
+	r = l.Reserve("k")
+	require.True(t, r.OK())
+	assert.Equal(t, 200*time.Millisecond, r.Delay())
+	// 排队已满
+	r = l.Reserve("k")
+	assert.False(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.RetryAfter())
+
+	c.Add(300 * time.Millisecond)
+	assert.True(t, l.Allow("k"))
+}
+
+func TestLocalLimiter_TTL(t *testing.T) {
+	l, c := withClock(NewCounterLimiter(1))
+	l.TTL(time.Minute)
+	r := l.Reserve("busy")
+	require.True(t, r.OK())
+	assert.True(t, l.Allow("idle"))
+	l.Release("idle")
+	assert.Equal(t, 2, l.Len())
+
+	c.Add(time.Minute)
+	assert.True(t, l.Allow("new"))
+	// 空闲的 key 被回收，仍占用额度的 key 保留
+	assert.Equal(t, 2, l.Len())
+	assert.False(t, l.Allow("busy"))
+}
+
+func TestLocalLimiter_Wait(t *testing.T) {
+	l := NewTokenBucketLimiter(20*time.Millisecond, 1)
+	require.True(t, l.Allow("k"))
+
+	start := time.Now()
+	r, err := l.Wait(context.Background(), "k")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// 截止时间前无法获得额度
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = l.Wait(ctx, "k")
+	assert.ErrorIs(t, err, ErrLimited)
+
+	// 并发计数器轮询等待归还
+	cl := NewCounterLimiter(1)
+	held := cl.Reserve("k")
+	require.True(t, held.OK())
+	time.AfterFunc(20*time.Millisecond, held.Done)
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	r, err = cl.Wait(ctx2, "k")
+	require.NoError(t, err)
+	r.Done()
+}
+
+func TestTake(t *testing.T) {
+	l := NewLeakyBucketLimiter(20*time.Millisecond, 2).MaxWait(time.Second)
+	r, err := Take(context.Background(), l, "k")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+
+	start := time.Now()
+	r, err = Take(context.Background(), l, "k")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Take(ctx, l, "k")
+	assert.ErrorIs(t, err, context.Canceled)
+}
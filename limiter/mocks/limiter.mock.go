@@ -1,9 +1,9 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: ./pkg/limiter/types.go
+// Source: ./limiter/types.go
 //
 // Generated by this command:
 //
-//	mockgen -source=./pkg/limiter/types.go -package=limitermocks -destination=./pkg/limiter/mocks/limiter.mock.go
+//	mockgen -source=./limiter/types.go -package=limitermocks -destination=./limiter/mocks/limiter.mock.go
 //
 
 // Package limitermocks is a generated GoMock package.
@@ -13,6 +13,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	limiter "github.com/hgg-6/pkgTool/v2/limiter"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -54,3 +55,139 @@ func (mr *MockLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockLimiter)(nil).Limit), ctx, key)
 }
+
+// MockReserveLimiter is a mock of ReserveLimiter interface.
+type MockReserveLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockReserveLimiterMockRecorder
+	isgomock struct{}
+}
+
+// MockReserveLimiterMockRecorder is the mock recorder for MockReserveLimiter.
+type MockReserveLimiterMockRecorder struct {
+	mock *MockReserveLimiter
+}
+
+// NewMockReserveLimiter creates a new mock instance.
+func NewMockReserveLimiter(ctrl *gomock.Controller) *MockReserveLimiter {
+	mock := &MockReserveLimiter{ctrl: ctrl}
+	mock.recorder = &MockReserveLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReserveLimiter) EXPECT() *MockReserveLimiterMockRecorder {
+	return m.recorder
+}
+
+// Allow mocks base method.
+func (m *MockReserveLimiter) Allow(key string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allow", key)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Allow indicates an expected call of Allow.
+func (mr *MockReserveLimiterMockRecorder) Allow(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allow", reflect.TypeOf((*MockReserveLimiter)(nil).Allow), key)
+}
+
+// Limit mocks base method.
+func (m *MockReserveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Limit", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Limit indicates an expected call of Limit.
+func (mr *MockReserveLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockReserveLimiter)(nil).Limit), ctx, key)
+}
+
+// Reserve mocks base method.
+func (m *MockReserveLimiter) Reserve(key string) *limiter.Reservation {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", key)
+	ret0, _ := ret[0].(*limiter.Reservation)
+	return ret0
+}
+
+// Reserve indicates an expected call of Reserve.
+func (mr *MockReserveLimiterMockRecorder) Reserve(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockReserveLimiter)(nil).Reserve), key)
+}
+
+// Wait mocks base method.
+func (m *MockReserveLimiter) Wait(ctx context.Context, key string) (*limiter.Reservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Wait", ctx, key)
+	ret0, _ := ret[0].(*limiter.Reservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Wait indicates an expected call of Wait.
+func (mr *MockReserveLimiterMockRecorder) Wait(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Wait", reflect.TypeOf((*MockReserveLimiter)(nil).Wait), ctx, key)
+}
+
+// MockQuotaLimiter is a mock of QuotaLimiter interface.
+type MockQuotaLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockQuotaLimiterMockRecorder
+	isgomock struct{}
+}
+
+// MockQuotaLimiterMockRecorder is the mock recorder for MockQuotaLimiter.
+type MockQuotaLimiterMockRecorder struct {
+	mock *MockQuotaLimiter
+}
+
+// NewMockQuotaLimiter creates a new mock instance.
+func NewMockQuotaLimiter(ctrl *gomock.Controller) *MockQuotaLimiter {
+	mock := &MockQuotaLimiter{ctrl: ctrl}
+	mock.recorder = &MockQuotaLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQuotaLimiter) EXPECT() *MockQuotaLimiterMockRecorder {
+	return m.recorder
+}
+
+// Acquire mocks base method.
+func (m *MockQuotaLimiter) Acquire(ctx context.Context, key string) (*limiter.Reservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Acquire", ctx, key)
+	ret0, _ := ret[0].(*limiter.Reservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Acquire indicates an expected call of Acquire.
+func (mr *MockQuotaLimiterMockRecorder) Acquire(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Acquire", reflect.TypeOf((*MockQuotaLimiter)(nil).Acquire), ctx, key)
+}
+
+// Limit mocks base method.
+func (m *MockQuotaLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Limit", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Limit indicates an expected call of Limit.
+func (mr *MockQuotaLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockQuotaLimiter)(nil).Limit), ctx, key)
+}
@@ -0,0 +1,121 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRedis miniredis 及其手动推进的服务端时间
+type testRedis struct {
+	*miniredis.Miniredis
+	now time.Time
+}
+
+func newMiniRedis(t *testing.T) (*testRedis, redis.Cmdable) {
+	mr := &testRedis{Miniredis: miniredis.RunT(t), now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mr.SetTime(mr.now)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
+
+// advance 推进 miniredis 的服务端时间和过期时间
+func advance(mr *testRedis, d time.Duration) {
+	mr.now = mr.now.Add(d)
+	mr.SetTime(mr.now)
+	mr.FastForward(d)
+}
+
+func TestRedisTokenBucketLimiter(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	l := NewRedisTokenBucketLimiter(client, 100*time.Millisecond, 3)
+	ctx := context.Background()
+
+	// 新 key 为满桶，允许突发
+	for i := 2; i >= 0; i-- {
+		r, err := l.Acquire(ctx, "user:1")
+		require.NoError(t, err)
+		assert.True(t, r.OK())
+		assert.Equal(t, i, r.Remaining())
+		assert.Equal(t, 3, r.Limit())
+	}
+	r, err := l.Acquire(ctx, "user:1")
+	require.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.RetryAfter())
+
+	// 不同 key 互不影响
+	limited, err := l.Limit(ctx, "user:2")
+	require.NoError(t, err)
+	assert.False(t, limited)
+
+	advance(mr, 150*time.Millisecond)
+	r, err = l.Acquire(ctx, "user:1")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	r, err = l.Acquire(ctx, "user:1")
+	require.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Equal(t, 50*time.Millisecond, r.RetryAfter())
+
+	// 桶补满后 key 过期
+	advance(mr, 2*time.Second)
+	assert.False(t, mr.Exists("limiter:token_bucket:user:1"))
+
+	_, err = l.Limit(ctx, "")
+	assert.Error(t, err)
+}
+
+func TestRedisGCRALimiter(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	// 每秒 10 个，突发 2 个
+	l := NewRedisGCRALimiter(client, time.Second, 10, 2).Prefix("gcra:")
+	ctx := context.Background()
+
+	r, err := l.Acquire(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.Equal(t, 1, r.Remaining())
+	r, err = l.Acquire(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.Equal(t, 0, r.Remaining())
+
+	r, err = l.Acquire(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.RetryAfter())
+
+	// 匀速放行
+	advance(mr, 100*time.Millisecond)
+	limited, err := l.Limit(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, limited)
+	limited, err = l.Limit(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, limited)
+
+	// 空闲后 key 过期
+	advance(mr, time.Second)
+	assert.False(t, mr.Exists("gcra:k"))
+}
+
+func TestTake_QuotaLimiter(t *testing.T) {
+	_, client := newMiniRedis(t)
+	l := NewRedisGCRALimiter(client, time.Second, 1, 1)
+	r, err := Take(context.Background(), l, "k")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	r, err = Take(context.Background(), l, "k")
+	require.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Equal(t, time.Second, r.RetryAfter())
+	// Redis 限流器没有需要归还的额度
+	r.Done()
+}
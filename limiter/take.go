@@ -0,0 +1,38 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// Take 获取一个额度，供 gin/gRPC 等中间件复用同一套逻辑
+//   - l 实现了 ReserveLimiter 时使用 Reserve，预约需要等待时在 ctx 内等待 Delay，ctx 结束时归还额度并返回 ctx.Err()
+//   - l 实现了 QuotaLimiter 时使用 Acquire，Reservation 带有剩余额度和建议重试时间
+//   - 只实现了 Limiter 时使用 Limit
+//   - error 为 nil 时 Reservation 一定非 nil，OK 为 false 表示触发限流；放行的请求处理完成后需调用 Reservation.Done
+func Take(ctx context.Context, l Limiter, key string) (*Reservation, error) {
+	if ql, ok := l.(QuotaLimiter); ok {
+		return ql.Acquire(ctx, key)
+	}
+	rl, ok := l.(ReserveLimiter)
+	if !ok {
+		limited, err := l.Limit(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return NewReservation(!limited, 0, 0, 0), nil
+	}
+	r := rl.Reserve(key)
+	if !r.OK() || r.Delay() <= 0 {
+		return r, nil
+	}
+	timer := time.NewTimer(r.Delay())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return r, nil
+	case <-ctx.Done():
+		r.Cancel()
+		return nil, ctx.Err()
+	}
+}
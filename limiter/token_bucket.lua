@@ -0,0 +1,46 @@
+-- Redis令牌桶限流Lua脚本
+-- 令牌按时间差惰性补充，一个key只保存令牌数和上次补充时间，内存与速率无关
+
+-- KEYS[1]: 限流key
+-- ARGV[1]: 产生一个令牌的间隔（微秒）
+-- ARGV[2]: 桶容量，即允许的突发请求数
+-- 返回 {是否放行 1/0, 剩余令牌数, 建议重试时间（微秒）}
+
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+
+-- 使用redis服务端时间，避免多实例时钟不一致
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local state = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+    -- 新key为满桶
+    tokens = capacity
+    ts = now
+end
+
+-- 1. 按时间差补充令牌
+if now > ts then
+    tokens = math.min(capacity, tokens + (now - ts) / interval)
+    ts = now
+end
+
+-- 2. 取令牌
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    retry = math.ceil((1 - tokens) * interval)
+end
+
+-- 3. 保存状态，桶补满后key自动过期
+redis.call('HSET', key, 'tokens', string.format('%.6f', tokens), 'ts', string.format('%d', ts))
+redis.call('PEXPIRE', key, math.ceil(capacity * interval / 1000) + 1000)
+
+return {allowed, math.floor(tokens), retry}
@@ -2,8 +2,30 @@ package limiter
 
 import "context"
 
+// GlobalKey 所有请求共用一个额度时使用的 key，gin 和 gRPC 的旧版限流器都用它，共用同一个限流器时两边共用额度
+const GlobalKey = "global"
+
 type Limiter interface {
 	// Limit 限制、限流，是否触发限流。
 	// 返回True就是触发限流。
 	Limit(ctx context.Context, key string) (bool, error)
 }
+
+// ReserveLimiter 支持预约的限流器，进程内限流器 LocalLimiter 实现了该接口
+//   - 中间件优先使用 Reserve，拿到剩余额度和重试时间，请求结束后调用 Reservation.Done
+type ReserveLimiter interface {
+	Limiter
+	// Allow 是否立即放行，放行时占用一个额度
+	Allow(key string) bool
+	// Reserve 预约一个额度，Reservation.OK 为 false 时未占用额度
+	Reserve(key string) *Reservation
+	// Wait 阻塞直到获得额度，ctx 超时前无法获得时返回 ErrLimited 或 ctx 的错误
+	Wait(ctx context.Context, key string) (*Reservation, error)
+}
+
+// QuotaLimiter 能返回剩余额度和建议重试时间的限流器，如 RedisTokenBucketLimiter、RedisGCRALimiter
+type QuotaLimiter interface {
+	Limiter
+	// Acquire 获取一个额度，Reservation.OK 为 false 表示触发限流，RetryAfter 为建议的重试时间
+	Acquire(ctx context.Context, key string) (*Reservation, error)
+}
@@ -0,0 +1,14 @@
+package logx
+
+// NopLogger 丢弃所有日志，没有配置日志时使用
+type NopLogger struct{}
+
+// NewNopLogger 创建丢弃所有日志的 Loggerx
+func NewNopLogger() Loggerx {
+	return NopLogger{}
+}
+
+func (NopLogger) Debug(msg string, fields ...Field) {}
+func (NopLogger) Info(msg string, fields ...Field)  {}
+func (NopLogger) Warn(msg string, fields ...Field)  {}
+func (NopLogger) Error(msg string, fields ...Field) {}
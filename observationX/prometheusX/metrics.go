@@ -105,3 +105,8 @@ func (p *PrometheusStr) NewSummaryVec(name, help string, labels []string, object
 	}
 	return s
 }
+
+// NewDesc 创建自定义 Collector 使用的 Desc，自动填充 namespace/subsystem/constLabels
+func (p *PrometheusStr) NewDesc(name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(p.namespace, p.subsystem, name), help, labels, p.constLabels)
+}
@@ -515,3 +515,10 @@ func TestMustStartServer_PanicOnInvalidAddr(t *testing.T) {
 		p.MustStartServer(":invalid_port_format")
 	})
 }
+
+func TestNewDesc_FQName(t *testing.T) {
+	p := newTestPrometheusStr(t, WithConstLabels(map[string]string{"env": "test"}))
+	desc := p.NewDesc("pattern", "Current pattern", []string{"name"})
+	assert.Contains(t, desc.String(), `fqName: "hgg_test_pattern"`)
+	assert.Contains(t, desc.String(), `env="test"`)
+}
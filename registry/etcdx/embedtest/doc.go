@@ -0,0 +1,4 @@
+// Package embedtest 用内嵌 etcd 测试 registry/etcdx，独立成模块，避免 etcd/server 的依赖进入主模块
+//
+//	cd registry/etcdx/embedtest && go test ./...
+package embedtest
@@ -0,0 +1,180 @@
+package embedtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/hgg-6/pkgTool/v2/registry"
+	"github.com/hgg-6/pkgTool/v2/registry/etcdx"
+	_ "github.com/hgg-6/pkgTool/v2/rpc/grpcx/balancer/wrr"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// freeURL 随机可用端口
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// startEtcd 启动内嵌 etcd，返回连接它的客户端
+func startEtcd(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	client, peer := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{client}, []url.URL{client}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peer}, []url.URL{peer}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd 启动超时")
+	}
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{client.Host}, DialTimeout: time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cli.Close() })
+	return cli
+}
+
+func newTestRegistry(cli *clientv3.Client) *etcdx.Registry {
+	l := zerologx.NewZeroLogger(new(zerolog.New(os.Stderr).Level(zerolog.Disabled)))
+	return etcdx.NewRegistry(cli, l).TTL(time.Second)
+}
+
+func sortByAddr(instances []registry.ServiceInstance) []registry.ServiceInstance {
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Addr < instances[j].Addr })
+	return instances
+}
+
+// leases 当前全部租约
+func leases(t *testing.T, cli *clientv3.Client) []clientv3.LeaseID {
+	resp, err := cli.Leases(context.Background())
+	require.NoError(t, err)
+	res := make([]clientv3.LeaseID, 0, len(resp.Leases))
+	for _, l := range resp.Leases {
+		res = append(res, l.ID)
+	}
+	return res
+}
+
+func TestRegistry(t *testing.T) {
+	cli := startEtcd(t)
+	reg := newTestRegistry(cli)
+	ctx := context.Background()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch, err := reg.Watch(watchCtx, "user")
+	require.NoError(t, err)
+	assert.Empty(t, <-ch)
+
+	a := registry.ServiceInstance{Name: "user", Addr: "127.0.0.1:8090", Weight: 10, Version: "v1", Zone: "bj",
+		Metadata: map[string]string{"env": "test"}}
+	b := registry.ServiceInstance{Name: "user", Addr: "127.0.0.1:8091", Weight: 20}
+	require.NoError(t, reg.Register(ctx, a))
+	assert.Equal(t, []registry.ServiceInstance{a}, <-ch)
+	require.NoError(t, reg.Register(ctx, b))
+	assert.Equal(t, []registry.ServiceInstance{a, b}, sortByAddr(<-ch))
+
+	instances, err := reg.ListInstances(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []registry.ServiceInstance{a, b}, sortByAddr(instances))
+
+	require.NoError(t, reg.Deregister(ctx, b))
+	assert.Equal(t, []registry.ServiceInstance{a}, <-ch)
+
+	// 关闭时注销全部实例，Watch 随之关闭
+	require.NoError(t, reg.Close())
+	instances, err = reg.ListInstances(ctx, "user")
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+	for range ch {
+	}
+	assert.ErrorIs(t, reg.Register(ctx, a), etcdx.ErrClosed)
+}
+
+func TestRegistry_SessionLoss(t *testing.T) {
+	cli := startEtcd(t)
+	reg := newTestRegistry(cli)
+	defer reg.Close()
+	ctx := context.Background()
+	si := registry.ServiceInstance{Name: "user", Addr: "127.0.0.1:8090"}
+	require.NoError(t, reg.Register(ctx, si))
+
+	// 模拟租约丢失：直接撤销租约，实例被删除
+	lost := leases(t, cli)
+	require.Len(t, lost, 1)
+	_, err := cli.Revoke(ctx, lost[0])
+	require.NoError(t, err)
+
+	// 续约中断后用新租约重新注册
+	require.Eventually(t, func() bool {
+		instances, err := reg.ListInstances(ctx, "user")
+		return err == nil && len(instances) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	current := leases(t, cli)
+	require.Len(t, current, 1)
+	assert.NotEqual(t, lost[0], current[0])
+}
+
+func TestResolver(t *testing.T) {
+	cli := startEtcd(t)
+	reg := newTestRegistry(cli)
+	ctx := context.Background()
+
+	servers := make([]*grpc.Server, 0, 2)
+	for i, weight := range []int{10, 20} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		server := grpc.NewServer()
+		etcdx.RegisterUserServiceServer(server, &etcdx.Service{Name: fmt.Sprint(i)})
+		go func() { _ = server.Serve(l) }()
+		servers = append(servers, server)
+		require.NoError(t, reg.Register(ctx, registry.ServiceInstance{Name: "user", Addr: l.Addr().String(), Weight: weight}))
+	}
+
+	cc, err := grpc.NewClient("registry:///user",
+		grpc.WithResolvers(registry.NewResolverBuilder(reg)),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"custom_weighted_round_robin": {}}]}`),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer cc.Close()
+	client := etcdx.NewUserServiceClient(cc)
+
+	// wrr 读取注册的权重，等两个节点都就绪后按 1:2 分配
+	require.Eventually(t, func() bool {
+		counts := make(map[string]int)
+		for i := 0; i < 30; i++ {
+			resp, err := client.GetById(ctx, &etcdx.GetByIdRequest{Id: 1})
+			if err != nil {
+				return false
+			}
+			counts[resp.User.Name]++
+		}
+		return counts["hgg+0"] == 10 && counts["hgg+1"] == 20
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// 优雅退出：先注销实例，客户端摘除节点后再停止服务
+	require.NoError(t, reg.Close())
+	for _, server := range servers {
+		server.GracefulStop()
+	}
+}
@@ -0,0 +1,319 @@
+package etcdx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"github.com/hgg-6/pkgTool/v2/registry"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ registry.Registry = (*Registry)(nil)
+
+// ErrClosed 注册中心已关闭
+var ErrClosed = errors.New("etcdx: registry closed")
+
+// Registry 基于 etcd 的服务注册与发现
+//   - key 为 prefix/服务名/地址，value 与 etcd 官方 endpoints 格式一致，官方的 naming/resolver 也能解析
+//   - 所有实例共用一个租约，续约中断【如网络分区导致租约过期】后重新申请租约并重新注册全部实例
+//   - 不负责关闭 etcd 客户端
+type Registry struct {
+	client *clientv3.Client
+	log    logx.Loggerx
+	prefix string
+	ttl    int64
+
+	mu        sync.Mutex
+	lease     clientv3.LeaseID
+	instances map[string]registry.ServiceInstance // key -> 实例
+	started   bool
+	closed    bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRegistry 创建 etcd 注册中心，默认前缀 service、租约 10s，log 为 nil 时不记录日志
+func NewRegistry(client *clientv3.Client, log logx.Loggerx) *Registry {
+	if log == nil {
+		log = logx.NewNopLogger()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{
+		client:    client,
+		log:       log,
+		prefix:    "service",
+		ttl:       10,
+		instances: make(map[string]registry.ServiceInstance),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Prefix key 前缀，默认 service，与 etcd:///service/user 的写法兼容
+func (r *Registry) Prefix(prefix string) *Registry {
+	r.prefix = strings.TrimSuffix(prefix, "/")
+	return r
+}
+
+// TTL 租约时长，最小 1s，进程异常退出后实例最多保留 ttl
+func (r *Registry) TTL(ttl time.Duration) *Registry {
+	r.ttl = max(int64(ttl/time.Second), 1)
+	return r
+}
+
+func (r *Registry) serviceKey(name string) string {
+	return r.prefix + "/" + name + "/"
+}
+
+func (r *Registry) instanceKey(si registry.ServiceInstance) string {
+	return r.serviceKey(si.Name) + si.Addr
+}
+
+// endpoint 与 etcd naming/endpoints 内部的存储格式一致
+type endpoint struct {
+	Op       uint8          `json:"Op"`
+	Addr     string         `json:"Addr"`
+	Metadata map[string]any `json:"Metadata"`
+}
+
+// Register 注册实例，第一次注册时申请租约并启动续约
+func (r *Registry) Register(ctx context.Context, si registry.ServiceInstance) error {
+	if si.Name == "" || si.Addr == "" {
+		return errors.New("etcdx: 服务名和地址不能为空")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	if r.lease == 0 {
+		lease, err := r.client.Grant(ctx, r.ttl)
+		if err != nil {
+			return err
+		}
+		r.lease = lease.ID
+	}
+	if err := r.put(ctx, r.lease, si); err != nil {
+		return err
+	}
+	r.instances[r.instanceKey(si)] = si
+	if !r.started {
+		r.started = true
+		r.wg.Add(1)
+		go r.keepAlive()
+	}
+	return nil
+}
+
+func (r *Registry) put(ctx context.Context, lease clientv3.LeaseID, si registry.ServiceInstance) error {
+	val, err := json.Marshal(endpoint{Addr: si.Addr, Metadata: si.ToMetadata()})
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Put(ctx, r.instanceKey(si), string(val), clientv3.WithLease(lease))
+	return err
+}
+
+// keepAlive 续约，续约中断后重新申请租约并重新注册，直到 Close
+func (r *Registry) keepAlive() {
+	defer r.wg.Done()
+	backoff := 100 * time.Millisecond
+	for {
+		r.mu.Lock()
+		lease := r.lease
+		r.mu.Unlock()
+		if lease != 0 {
+			ch, err := r.client.KeepAlive(r.ctx, lease)
+			if err == nil {
+				for range ch {
+					backoff = 100 * time.Millisecond
+				}
+			}
+			if r.ctx.Err() != nil {
+				return
+			}
+			r.log.Warn("etcd 租约续约中断，重新注册", logx.Int64("lease", int64(lease)), logx.Error(err))
+		}
+		for {
+			err := r.reRegister()
+			if err == nil {
+				break
+			}
+			r.log.Error("etcd 重新注册失败", logx.Error(err))
+			select {
+			case <-time.After(backoff):
+				backoff = min(backoff*2, time.Duration(r.ttl)*time.Second)
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// reRegister 申请新租约，重新写入全部实例
+func (r *Registry) reRegister() error {
+	ctx, cancel := context.WithTimeout(r.ctx, time.Duration(r.ttl)*time.Second)
+	defer cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lease = 0
+	lease, err := r.client.Grant(ctx, r.ttl)
+	if err != nil {
+		return err
+	}
+	for _, si := range r.instances {
+		if err = r.put(ctx, lease.ID, si); err != nil {
+			return err
+		}
+	}
+	r.lease = lease.ID
+	r.log.Info("etcd 重新注册成功", logx.Int64("lease", int64(lease.ID)), logx.Int("instances", len(r.instances)))
+	return nil
+}
+
+// Deregister 注销实例
+func (r *Registry) Deregister(ctx context.Context, si registry.ServiceInstance) error {
+	key := r.instanceKey(si)
+	r.mu.Lock()
+	delete(r.instances, key)
+	r.mu.Unlock()
+	_, err := r.client.Delete(ctx, key)
+	return err
+}
+
+// ListInstances 服务当前的全部实例
+func (r *Registry) ListInstances(ctx context.Context, name string) ([]registry.ServiceInstance, error) {
+	resp, err := r.client.Get(ctx, r.serviceKey(name), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]registry.ServiceInstance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if si, ok := r.decode(name, kv.Value); ok {
+			instances = append(instances, si)
+		}
+	}
+	return instances, nil
+}
+
+func (r *Registry) decode(name string, val []byte) (registry.ServiceInstance, bool) {
+	var ep endpoint
+	if err := json.Unmarshal(val, &ep); err != nil || ep.Addr == "" {
+		r.log.Warn("etcd 实例解析失败", logx.String("service", name), logx.String("value", string(val)), logx.Error(err))
+		return registry.ServiceInstance{}, false
+	}
+	return registry.FromMetadata(name, ep.Addr, ep.Metadata), true
+}
+
+// Watch 监听服务的实例变化，watch 中断【如 revision 被压缩】时重新全量拉取
+func (r *Registry) Watch(ctx context.Context, name string) (<-chan []registry.ServiceInstance, error) {
+	if r.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	resp, err := r.client.Get(ctx, r.serviceKey(name), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []registry.ServiceInstance, 1)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(ch)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-r.ctx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		for {
+			instances := make(map[string]registry.ServiceInstance, len(resp.Kvs))
+			for _, kv := range resp.Kvs {
+				if si, ok := r.decode(name, kv.Value); ok {
+					instances[string(kv.Key)] = si
+				}
+			}
+			if !send(ctx, ch, instances) {
+				return
+			}
+			wch := r.client.Watch(clientv3.WithRequireLeader(ctx), r.serviceKey(name),
+				clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+			for wresp := range wch {
+				if wresp.Err() != nil {
+					break
+				}
+				for _, ev := range wresp.Events {
+					if ev.Type == clientv3.EventTypeDelete {
+						delete(instances, string(ev.Kv.Key))
+					} else if si, ok := r.decode(name, ev.Kv.Value); ok {
+						instances[string(ev.Kv.Key)] = si
+					}
+				}
+				if !send(ctx, ch, instances) {
+					return
+				}
+			}
+			// watch 中断，重新全量拉取
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+				if resp, err = r.client.Get(ctx, r.serviceKey(name), clientv3.WithPrefix()); err == nil {
+					break
+				}
+				r.log.Warn("etcd 拉取实例失败", logx.String("service", name), logx.Error(err))
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// send 推送当前的全部实例
+func send(ctx context.Context, ch chan<- []registry.ServiceInstance, instances map[string]registry.ServiceInstance) bool {
+	list := make([]registry.ServiceInstance, 0, len(instances))
+	for _, si := range instances {
+		list = append(list, si)
+	}
+	select {
+	case ch <- list:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Close 停止续约并注销全部实例，服务退出时在 grpc.Server.GracefulStop 之前调用，让客户端先摘除流量
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	lease := r.lease
+	r.mu.Unlock()
+	r.cancel()
+	r.wg.Wait()
+	if lease == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	// 撤销租约会删除租约下的全部 key
+	_, err := r.client.Revoke(ctx, lease)
+	return err
+}
@@ -0,0 +1,16 @@
+package etcdx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 连接 etcd 的测试使用内嵌 etcd，见 embedtest 模块
+
+func TestNewRegistry_NilLogger(t *testing.T) {
+	reg := NewRegistry(nil, nil)
+	require.NotNil(t, reg.log)
+	// 没有配置日志时记录日志不会 panic
+	reg.log.Warn("test")
+}
@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"context"
+	"maps"
+	"strconv"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme gRPC 解析器的 scheme，target 为 registry:///服务名
+const Scheme = "registry"
+
+// NewResolverBuilder 基于 Registry 的 gRPC 解析器，实例变化时实时更新地址
+//
+//   - 实例信息放在 resolver.Address.BalancerAttributes 中，用 FromAddress 读取，wrr/dwrr 负载均衡从中读取权重
+//
+//   - 不使用 resolver.Address.Metadata：map 不可比较，round_robin、pick_first 比较地址时会 panic
+//
+//     grpc.NewClient("registry:///user", grpc.WithResolvers(registry.NewResolverBuilder(reg)))
+func NewResolverBuilder(r Registry) resolver.Builder {
+	return &resolverBuilder{r: r}
+}
+
+type resolverBuilder struct {
+	r Registry
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := b.r.Watch(ctx, target.Endpoint())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res := &registryResolver{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(res.done)
+		for instances := range ch {
+			if err := cc.UpdateState(resolver.State{Addresses: Addresses(instances)}); err != nil {
+				cc.ReportError(err)
+			}
+		}
+	}()
+	return res, nil
+}
+
+type registryResolver struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ResolveNow 实例变化由 Watch 推送，无需主动解析
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *registryResolver) Close() {
+	r.cancel()
+	<-r.done
+}
+
+// Addresses 实例转为 gRPC 地址
+func Addresses(instances []ServiceInstance) []resolver.Address {
+	addrs := make([]resolver.Address, 0, len(instances))
+	for _, si := range instances {
+		addrs = append(addrs, resolver.Address{
+			Addr:               si.Addr,
+			BalancerAttributes: attributes.New(instanceKey{}, instanceValue{si}),
+		})
+	}
+	return addrs
+}
+
+type instanceKey struct{}
+
+// instanceValue attributes 比较时要求值实现 Equal
+type instanceValue struct {
+	ServiceInstance
+}
+
+func (v instanceValue) Equal(o any) bool {
+	ov, ok := o.(instanceValue)
+	return ok && v.Name == ov.Name && v.Addr == ov.Addr && v.Weight == ov.Weight &&
+		v.Version == ov.Version && v.Zone == ov.Zone && maps.Equal(v.Metadata, ov.Metadata)
+}
+
+// FromAddress 读取 Addresses 放入地址中的实例信息，不是本解析器产生的地址返回 false
+func FromAddress(addr resolver.Address) (ServiceInstance, bool) {
+	v, ok := addr.BalancerAttributes.Value(instanceKey{}).(instanceValue)
+	return v.ServiceInstance, ok
+}
+
+// ToMetadata 实例信息转为 map，与注册中心中存储的格式一致
+func (si ServiceInstance) ToMetadata() map[string]any {
+	md := make(map[string]any, len(si.Metadata)+3)
+	for k, v := range si.Metadata {
+		md[k] = v
+	}
+	if si.Weight > 0 {
+		md["weight"] = float64(si.Weight)
+	}
+	if si.Version != "" {
+		md["version"] = si.Version
+	}
+	if si.Zone != "" {
+		md["zone"] = si.Zone
+	}
+	return md
+}
+
+// FromMetadata 从 map 还原实例信息，weight 兼容 JSON 解码后的 float64 和字符串
+func FromMetadata(name, addr string, md map[string]any) ServiceInstance {
+	si := ServiceInstance{Name: name, Addr: addr}
+	for k, v := range md {
+		switch k {
+		case "weight":
+			switch w := v.(type) {
+			case float64:
+				si.Weight = int(w)
+			case int:
+				si.Weight = w
+			case string:
+				si.Weight, _ = strconv.Atoi(w)
+			}
+		case "version":
+			si.Version, _ = v.(string)
+		case "zone":
+			si.Zone, _ = v.(string)
+		default:
+			if s, ok := v.(string); ok {
+				if si.Metadata == nil {
+					si.Metadata = make(map[string]string)
+				}
+				si.Metadata[k] = s
+			}
+		}
+	}
+	return si
+}
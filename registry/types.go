@@ -0,0 +1,30 @@
+package registry
+
+import (
+	"context"
+	"io"
+)
+
+// ServiceInstance 注册到注册中心的一个服务实例
+type ServiceInstance struct {
+	Name     string            // 服务名，如 user
+	Addr     string            // 客户端连接的地址，如 127.0.0.1:8090
+	Weight   int               // 权重，供 wrr/dwrr 负载均衡使用，0 时由负载均衡使用默认值
+	Version  string            // 版本
+	Zone     string            // 可用区
+	Metadata map[string]string // 其它自定义信息
+}
+
+// Registry 服务注册与发现
+type Registry interface {
+	// Register 注册实例，实例随注册中心的租约存活，租约丢失后自动重新注册
+	Register(ctx context.Context, si ServiceInstance) error
+	// Deregister 注销实例
+	Deregister(ctx context.Context, si ServiceInstance) error
+	// ListInstances 服务当前的全部实例
+	ListInstances(ctx context.Context, name string) ([]ServiceInstance, error)
+	// Watch 监听服务的实例变化，先推送一次当前的全部实例，之后每次变化推送变化后的全部实例，ctx 结束或注册中心关闭时关闭 channel
+	Watch(ctx context.Context, name string) (<-chan []ServiceInstance, error)
+	// Close 注销本注册中心注册的全部实例，用于优雅退出
+	io.Closer
+}
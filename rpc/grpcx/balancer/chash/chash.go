@@ -0,0 +1,210 @@
+package chash
+
+// 一致性哈希负载均衡，相同 hash key 的请求总是路由到同一个节点，适合按用户分片的缓存、排行榜等有状态服务
+import (
+	"context"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// RingHashName 哈希环
+	RingHashName = "custom_ring_hash"
+	// MaglevName Maglev 一致性哈希
+	MaglevName = "custom_maglev"
+
+	// MetadataKey 从 outgoing metadata 中读取 hash key 的键
+	MetadataKey = "x-hash-key"
+)
+
+func init() {
+	balancer.Register(NewBuilder(RingHashName, Config{}))
+	balancer.Register(NewBuilder(MaglevName, Config{Maglev: true}))
+}
+
+// Config 一致性哈希配置，零值使用默认值
+type Config struct {
+	// Maglev 为 true 时使用 Maglev 查找表，否则使用哈希环
+	Maglev bool
+	// Replicas 哈希环上每个节点的虚拟节点数，越大分布越均匀，默认 100
+	Replicas int
+	// TableSize Maglev 查找表大小，需为质数且远大于节点数，不是质数时取下一个质数，默认 65537
+	TableSize int
+}
+
+func (c Config) withDefaults() Config {
+	if c.Replicas <= 0 {
+		c.Replicas = 100
+	}
+	if c.TableSize <= 0 {
+		c.TableSize = 65537
+	}
+	c.TableSize = nextPrime(c.TableSize)
+	return c
+}
+
+type hashKey struct{}
+
+// WithHashKey 设置本次调用的 hash key，优先级高于 outgoing metadata 中的 MetadataKey
+//
+//	resp, err := client.GetRank(chash.WithHashKey(ctx, strconv.FormatInt(uid, 10)), req)
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// HashKey 读取 hash key：先取 WithHashKey 设置的值，再取 outgoing metadata 中的 MetadataKey
+func HashKey(ctx context.Context) (string, bool) {
+	if key, ok := ctx.Value(hashKey{}).(string); ok && key != "" {
+		return key, true
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if vals := md.Get(MetadataKey); len(vals) > 0 && vals[0] != "" {
+		return vals[0], true
+	}
+	return "", false
+}
+
+// NewBuilder 创建一致性哈希负载均衡，可用自定义名称和配置注册多个
+//
+//	balancer.Register(chash.NewBuilder("my_ring_hash", chash.Config{Replicas: 200}))
+func NewBuilder(name string, cfg Config) balancer.Builder {
+	return base.NewBalancerBuilder(name, &PickerBuilder{cfg: cfg.withDefaults()}, base.Config{HealthCheck: true})
+}
+
+// PickerBuilder 按就绪节点的地址构建哈希环或 Maglev 查找表，节点增减时只有少量 key 改变路由
+type PickerBuilder struct {
+	cfg Config
+}
+
+func (p *PickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	conns := make([]hashConn, 0, len(info.ReadySCs))
+	for sc, sci := range info.ReadySCs {
+		conns = append(conns, hashConn{SubConn: sc, addr: sci.Address.Addr})
+	}
+	// 按地址排序，保证相同节点集合构建出相同的查找结构
+	sort.Slice(conns, func(i, j int) bool { return conns[i].addr < conns[j].addr })
+	picker := &Picker{conns: conns}
+	if p.cfg.Maglev {
+		picker.lookup = newMaglev(conns, p.cfg.TableSize).lookup
+	} else {
+		picker.lookup = newRing(conns, p.cfg.Replicas).lookup
+	}
+	return picker
+}
+
+// Picker 按 hash key 选择节点，没有 hash key 时随机选择
+type Picker struct {
+	conns  []hashConn
+	lookup func(hash uint64) int
+}
+
+func (p *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	key, ok := HashKey(info.Ctx)
+	if !ok {
+		return balancer.PickResult{SubConn: p.conns[rand.IntN(len(p.conns))].SubConn}, nil
+	}
+	return balancer.PickResult{SubConn: p.conns[p.lookup(xxhash.Sum64String(key))].SubConn}, nil
+}
+
+type hashConn struct {
+	balancer.SubConn
+	addr string
+}
+
+// ring 哈希环，每个节点 replicas 个虚拟节点
+type ring struct {
+	hashes []uint64
+	conns  []int // 与 hashes 一一对应的节点下标
+}
+
+func newRing(conns []hashConn, replicas int) *ring {
+	type vnode struct {
+		hash uint64
+		conn int
+	}
+	vnodes := make([]vnode, 0, len(conns)*replicas)
+	for i, c := range conns {
+		for r := 0; r < replicas; r++ {
+			vnodes = append(vnodes, vnode{hash: xxhash.Sum64String(c.addr + "#" + strconv.Itoa(r)), conn: i})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool { return vnodes[i].hash < vnodes[j].hash })
+	r := &ring{hashes: make([]uint64, len(vnodes)), conns: make([]int, len(vnodes))}
+	for i, v := range vnodes {
+		r.hashes[i], r.conns[i] = v.hash, v.conn
+	}
+	return r
+}
+
+// lookup 顺时针找到第一个虚拟节点
+func (r *ring) lookup(hash uint64) int {
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.conns[i]
+}
+
+// maglev Maglev 查找表，每个节点按各自的排列轮流占位，节点间分布几乎完全均匀
+type maglev struct {
+	table []int
+}
+
+func newMaglev(conns []hashConn, size int) *maglev {
+	m := uint64(size)
+	offsets := make([]uint64, len(conns))
+	skips := make([]uint64, len(conns))
+	next := make([]uint64, len(conns))
+	for i, c := range conns {
+		offsets[i] = xxhash.Sum64String(c.addr) % m
+		skips[i] = xxhash.Sum64String(c.addr+"#skip")%(m-1) + 1
+	}
+	table := make([]int, size)
+	for i := range table {
+		table[i] = -1
+	}
+	for filled := 0; ; {
+		for i := range conns {
+			c := (offsets[i] + next[i]*skips[i]) % m
+			for table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m
+			}
+			table[c] = i
+			next[i]++
+			filled++
+			if filled == size {
+				return &maglev{table: table}
+			}
+		}
+	}
+}
+
+func (m *maglev) lookup(hash uint64) int {
+	return m.table[hash%uint64(len(m.table))]
+}
+
+// nextPrime 不小于 n 的最小质数
+func nextPrime(n int) int {
+	for n = max(n, 2); ; n++ {
+		prime := true
+		for i := 2; i*i <= n; i++ {
+			if n%i == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package chash
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+)
+
+// fakeSubConn 仅用于区分节点
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func build(cfg Config, addrs ...string) balancer.Picker {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for _, addr := range addrs {
+		info.ReadySCs[&fakeSubConn{addr: addr}] = base.SubConnInfo{Address: resolver.Address{Addr: addr}}
+	}
+	return (&PickerBuilder{cfg: cfg.withDefaults()}).Build(info)
+}
+
+func pick(t *testing.T, p balancer.Picker, ctx context.Context) string {
+	r, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	require.NoError(t, err)
+	return r.SubConn.(*fakeSubConn).addr
+}
+
+// route 10000 个 key 的路由结果
+func route(t *testing.T, p balancer.Picker) map[string]string {
+	res := make(map[string]string, 10000)
+	for i := 0; i < 10000; i++ {
+		key := "user:" + strconv.Itoa(i)
+		res[key] = pick(t, p, WithHashKey(context.Background(), key))
+	}
+	return res
+}
+
+func TestHashKey(t *testing.T) {
+	_, ok := HashKey(context.Background())
+	assert.False(t, ok)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), MetadataKey, "md")
+	key, ok := HashKey(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "md", key)
+
+	key, _ = HashKey(WithHashKey(ctx, "ctx"))
+	assert.Equal(t, "ctx", key)
+}
+
+func TestPicker(t *testing.T) {
+	addrs := []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080", "10.0.0.4:8080", "10.0.0.5:8080"}
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "哈希环", cfg: Config{}},
+		{name: "Maglev", cfg: Config{Maglev: true, TableSize: 5000}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := route(t, build(tc.cfg, addrs...))
+			// 相同节点集合重建后路由不变
+			assert.Equal(t, before, route(t, build(tc.cfg, addrs...)))
+
+			// 分布大致均匀
+			counts := make(map[string]int)
+			for _, addr := range before {
+				counts[addr]++
+			}
+			for _, addr := range addrs {
+				assert.InDelta(t, 2000, counts[addr], 600, addr)
+			}
+
+			// 下线一个节点，只有该节点上的 key 需要迁移
+			after := route(t, build(tc.cfg, addrs[:4]...))
+			moved := 0
+			for key, addr := range before {
+				if after[key] != addr {
+					moved++
+					if addr != addrs[4] && !tc.cfg.Maglev {
+						t.Fatalf("%s 从 %s 迁移到了 %s", key, addr, after[key])
+					}
+				}
+			}
+			assert.InDelta(t, counts[addrs[4]], moved, float64(counts[addrs[4]])*0.1)
+
+			// 新增一个节点，约 1/6 的 key 迁移
+			added := route(t, build(tc.cfg, append(addrs, "10.0.0.6:8080")...))
+			moved = 0
+			for key, addr := range before {
+				if added[key] != addr {
+					moved++
+				}
+			}
+			assert.InDelta(t, 10000/6, moved, 500, fmt.Sprintf("moved %d", moved))
+		})
+	}
+}
+
+func TestPicker_NoKey(t *testing.T) {
+	p := build(Config{}, "a", "b")
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		seen[pick(t, p, context.Background())] = true
+	}
+	// 没有 hash key 时随机选择
+	assert.Len(t, seen, 2)
+}
+
+func TestNextPrime(t *testing.T) {
+	assert.Equal(t, 65537, nextPrime(65537))
+	assert.Equal(t, 5003, nextPrime(5000))
+	assert.Equal(t, 2, nextPrime(0))
+}
+
+func TestBuilder_Registered(t *testing.T) {
+	assert.NotNil(t, balancer.Get(RingHashName))
+	assert.NotNil(t, balancer.Get(MaglevName))
+}
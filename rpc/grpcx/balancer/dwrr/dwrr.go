@@ -0,0 +1,361 @@
+package dwrr
+
+// 动态权重负载均衡，在 wrr 的基础上根据调用结果和耗时实时调整权重
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Name 动态权重的平滑加权轮询
+	Name = "dynamic_weighted_round_robin"
+	// P2CName 动态权重的 P2C 最小负载
+	P2CName = "p2c_least_loaded"
+)
+
+func init() {
+	balancer.Register(NewBuilder(Name, Config{}))
+	balancer.Register(NewBuilder(P2CName, Config{P2C: true}))
+}
+
+// Config 动态权重配置，零值使用默认值
+type Config struct {
+	// P2C 为 true 时随机选两个节点取负载低的，负载 = EWMA耗时 * (处理中请求数+1) / 有效权重；否则按有效权重平滑加权轮询
+	P2C bool
+	// DefaultWeight 地址 metadata 没有 weight 时的权重，默认 10
+	DefaultWeight float64
+	// Decay 耗时 EWMA 的平滑系数【0-1】，越大越看重最近的耗时，默认 0.2
+	Decay float64
+	// Penalty 每次失败健康度乘以 Penalty，默认 0.5
+	Penalty float64
+	// MinHealth 健康度下限，保证失败的节点仍有少量流量用于探测恢复，默认 0.01
+	MinHealth float64
+	// RecoverTime 健康度从 0 线性恢复到 1 的时间，默认 30s
+	RecoverTime time.Duration
+	// MinLatencyFactor 耗时因子下限，耗时因子 = 最快节点的 EWMA 耗时 / 本节点的 EWMA 耗时，默认 0.1
+	MinLatencyFactor float64
+	// IsFailure 判断调用错误是否计为节点失败，默认 Unavailable、ResourceExhausted、DeadlineExceeded、Internal、Unknown
+	IsFailure func(err error) bool
+}
+
+func (c Config) withDefaults() Config {
+	if c.DefaultWeight <= 0 {
+		c.DefaultWeight = 10
+	}
+	if c.Decay <= 0 || c.Decay > 1 {
+		c.Decay = 0.2
+	}
+	if c.Penalty <= 0 || c.Penalty >= 1 {
+		c.Penalty = 0.5
+	}
+	if c.MinHealth <= 0 {
+		c.MinHealth = 0.01
+	}
+	if c.RecoverTime <= 0 {
+		c.RecoverTime = 30 * time.Second
+	}
+	if c.MinLatencyFactor <= 0 {
+		c.MinLatencyFactor = 0.1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = isFailure
+	}
+	return c
+}
+
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewBuilder 创建动态权重负载均衡，可用自定义名称和配置注册多个
+//
+//	balancer.Register(dwrr.NewBuilder("my_dwrr", dwrr.Config{RecoverTime: time.Minute}))
+func NewBuilder(name string, cfg Config) balancer.Builder {
+	return &builder{name: name, cfg: cfg.withDefaults()}
+}
+
+type builder struct {
+	name string
+	cfg  Config
+}
+
+func (b *builder) Name() string {
+	return b.name
+}
+
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := newPickerBuilder(b.cfg)
+	return &weightBalancer{
+		Balancer: base.NewBalancerBuilder(b.name, pb, base.Config{HealthCheck: true}).Build(cc, opts),
+		pb:       pb,
+	}
+}
+
+// weightBalancer 复用 base 的连接管理，在地址更新时记录最新的 weight
+//   - base 按 Addr 复用 SubConn，只有 metadata 变化时 SubConnInfo 里还是旧地址，所以单独记录
+type weightBalancer struct {
+	balancer.Balancer
+	pb *PickerBuilder
+}
+
+func (b *weightBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.pb.updateWeights(s.ResolverState.Addresses)
+	// base 每次地址更新都会重建 picker，新的 weight 随之生效
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+// PickerBuilder 跨 picker 保存每个节点的耗时和健康度，SubConn 状态变化重建 picker 时不会丢失
+type PickerBuilder struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	weights map[string]float64 // Addr -> 最新的 weight
+	nodes   map[balancer.SubConn]*node
+}
+
+func newPickerBuilder(cfg Config) *PickerBuilder {
+	return &PickerBuilder{
+		cfg:     cfg,
+		now:     time.Now,
+		weights: make(map[string]float64),
+		nodes:   make(map[balancer.SubConn]*node),
+	}
+}
+
+// updateWeights 记录地址 metadata 中的 weight
+func (p *PickerBuilder) updateWeights(addrs []resolver.Address) {
+	weights := make(map[string]float64, len(addrs))
+	for _, addr := range addrs {
+		weights[addr.Addr] = p.weightOf(addr)
+	}
+	p.mu.Lock()
+	p.weights = weights
+	p.mu.Unlock()
+}
+
+// weightOf 读取 metadata 中的 weight，经过 etcd 后 JSON 数字为 float64，也兼容整数和字符串，
+// registry 解析器产生的地址读取实例的 Weight
+func (p *PickerBuilder) weightOf(addr resolver.Address) float64 {
+	if si, ok := registry.FromAddress(addr); ok {
+		if si.Weight <= 0 {
+			return p.cfg.DefaultWeight
+		}
+		return float64(si.Weight)
+	}
+	md, _ := addr.Metadata.(map[string]any)
+	var weight float64
+	switch v := md["weight"].(type) {
+	case float64:
+		weight = v
+	case int:
+		weight = float64(v)
+	case int64:
+		weight = float64(v)
+	case json.Number:
+		weight, _ = v.Float64()
+	case string:
+		weight, _ = strconv.ParseFloat(v, 64)
+	}
+	if weight <= 0 {
+		return p.cfg.DefaultWeight
+	}
+	return weight
+}
+
+func (p *PickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	nodes := make(map[balancer.SubConn]*node, len(info.ReadySCs))
+	conns := make([]*node, 0, len(info.ReadySCs))
+	for sc, sci := range info.ReadySCs {
+		weight, ok := p.weights[sci.Address.Addr]
+		if !ok {
+			weight = p.weightOf(sci.Address)
+		}
+		n, ok := p.nodes[sc]
+		if !ok {
+			n = &node{SubConn: sc, addr: sci.Address.Addr, health: 1}
+		}
+		n.setWeight(weight)
+		nodes[sc] = n
+		conns = append(conns, n)
+	}
+	// 不再就绪的节点丢弃统计，重新就绪后从头开始
+	p.nodes = nodes
+	return &Picker{cfg: p.cfg, now: p.now, conns: conns}
+}
+
+// Picker 按有效权重选择节点，有效权重 = weight * 健康度 * 耗时因子
+type Picker struct {
+	cfg   Config
+	now   func() time.Time
+	conns []*node
+	lock  sync.Mutex
+}
+
+func (p *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	now := p.now()
+	var picked *node
+	if p.cfg.P2C {
+		picked = p.pickP2C(now)
+	} else {
+		picked = p.pickWRR(now)
+	}
+	picked.start()
+	return balancer.PickResult{
+		SubConn: picked.SubConn,
+		Done: func(info balancer.DoneInfo) {
+			end := p.now()
+			picked.done(p.cfg, end, end.Sub(now), info.Err != nil && p.cfg.IsFailure(info.Err))
+		},
+	}, nil
+}
+
+// pickWRR 平滑加权轮询，和 wrr 一样，只是每次按有效权重计算
+func (p *Picker) pickWRR(now time.Time) *node {
+	weights := p.effectiveWeights(now)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var (
+		total  float64
+		picked *node
+	)
+	for i, c := range p.conns {
+		total += weights[i]
+		c.currentWeight += weights[i]
+		if picked == nil || picked.currentWeight < c.currentWeight {
+			picked = c
+		}
+	}
+	picked.currentWeight -= total
+	return picked
+}
+
+// pickP2C 随机选两个节点，取负载低的
+func (p *Picker) pickP2C(now time.Time) *node {
+	if len(p.conns) == 1 {
+		return p.conns[0]
+	}
+	weights := p.effectiveWeights(now)
+	i := rand.IntN(len(p.conns))
+	j := rand.IntN(len(p.conns) - 1)
+	if j >= i {
+		j++
+	}
+	if p.conns[j].load(weights[j]) < p.conns[i].load(weights[i]) {
+		i = j
+	}
+	return p.conns[i]
+}
+
+// effectiveWeights 每个节点的有效权重
+func (p *Picker) effectiveWeights(now time.Time) []float64 {
+	stats := make([]nodeStat, len(p.conns))
+	minLatency := math.MaxFloat64
+	for i, c := range p.conns {
+		stats[i] = c.stat(p.cfg, now)
+		if stats[i].latency > 0 {
+			minLatency = min(minLatency, stats[i].latency)
+		}
+	}
+	weights := make([]float64, len(p.conns))
+	for i, st := range stats {
+		factor := 1.0
+		if st.latency > 0 {
+			factor = max(minLatency/st.latency, p.cfg.MinLatencyFactor)
+		}
+		weights[i] = st.weight * st.health * factor
+	}
+	return weights
+}
+
+// node 一个节点的实时统计
+type node struct {
+	balancer.SubConn
+	addr          string
+	currentWeight float64 // 平滑加权轮询的当前权重，由 Picker.lock 保护
+
+	mu       sync.Mutex
+	weight   float64
+	latency  float64   // 耗时 EWMA【纳秒】，0 表示还没有数据
+	health   float64   // 最近一次失败后的健康度【0-1】
+	failedAt time.Time // 最近一次失败的时间
+	inFlight int64
+}
+
+type nodeStat struct {
+	weight  float64
+	latency float64
+	health  float64
+}
+
+func (n *node) setWeight(weight float64) {
+	n.mu.Lock()
+	n.weight = weight
+	n.mu.Unlock()
+}
+
+func (n *node) start() {
+	n.mu.Lock()
+	n.inFlight++
+	n.mu.Unlock()
+}
+
+// done 记录一次调用，失败时降低健康度
+//   - 失败的调用不计入耗时 EWMA，快速失败【如连接被拒】会让节点看起来很快，失败只通过健康度体现
+func (n *node) done(cfg Config, now time.Time, rt time.Duration, failed bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.inFlight--
+	if failed {
+		n.health = max(n.healthAt(cfg, now)*cfg.Penalty, cfg.MinHealth)
+		n.failedAt = now
+		return
+	}
+	if n.latency == 0 {
+		n.latency = float64(rt)
+	} else {
+		n.latency = n.latency*(1-cfg.Decay) + float64(rt)*cfg.Decay
+	}
+}
+
+// healthAt 失败后随时间线性恢复
+func (n *node) healthAt(cfg Config, now time.Time) float64 {
+	if n.failedAt.IsZero() {
+		return n.health
+	}
+	return min(n.health+float64(now.Sub(n.failedAt))/float64(cfg.RecoverTime), 1)
+}
+
+func (n *node) stat(cfg Config, now time.Time) nodeStat {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return nodeStat{weight: n.weight, latency: n.latency, health: n.healthAt(cfg, now)}
+}
+
+// load P2C 的负载，没有耗时数据时按 1ns 计算，优先探测新节点
+func (n *node) load(weight float64) float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return max(n.latency, 1) * float64(n.inFlight+1) / max(weight, 1e-9)
+}
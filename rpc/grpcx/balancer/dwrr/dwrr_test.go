@@ -0,0 +1,170 @@
+package dwrr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSubConn 仅用于区分节点
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+type testEnv struct {
+	pb    *PickerBuilder
+	now   time.Time
+	conns map[string]*fakeSubConn
+}
+
+func newTestEnv(cfg Config, weights map[string]any) *testEnv {
+	env := &testEnv{pb: newPickerBuilder(cfg.withDefaults()), now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		conns: make(map[string]*fakeSubConn)}
+	env.pb.now = func() time.Time { return env.now }
+	for addr := range weights {
+		env.conns[addr] = &fakeSubConn{addr: addr}
+	}
+	return env
+}
+
+// build 模拟 base 用最初的地址重建 picker
+func (e *testEnv) build(weights map[string]any) balancer.Picker {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for addr, sc := range e.conns {
+		info.ReadySCs[sc] = base.SubConnInfo{Address: resolver.Address{Addr: addr,
+			Metadata: map[string]any{"weight": weights[addr]}}}
+	}
+	return e.pb.Build(info)
+}
+
+// count 选 n 次，每次调用耗时 rt[addr]，fail 中的节点返回 Unavailable
+func (e *testEnv) count(t *testing.T, p balancer.Picker, n int, rt map[string]time.Duration, fail map[string]bool) map[string]int {
+	res := make(map[string]int)
+	for i := 0; i < n; i++ {
+		r, err := p.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		addr := r.SubConn.(*fakeSubConn).addr
+		res[addr]++
+		e.now = e.now.Add(rt[addr])
+		var err2 error
+		if fail[addr] {
+			err2 = status.Error(codes.Unavailable, "down")
+		}
+		r.Done(balancer.DoneInfo{Err: err2})
+	}
+	return res
+}
+
+func TestPicker_StaticWeight(t *testing.T) {
+	weights := map[string]any{"a": float64(10), "b": 20}
+	env := newTestEnv(Config{}, weights)
+	res := env.count(t, env.build(weights), 300, nil, nil)
+	assert.Equal(t, map[string]int{"a": 100, "b": 200}, res)
+}
+
+func TestPicker_FailureAndRecover(t *testing.T) {
+	weights := map[string]any{"a": 10, "b": 10}
+	env := newTestEnv(Config{RecoverTime: 10 * time.Second}, weights)
+	p := env.build(weights)
+
+	// b 连续失败，流量大部分转到 a
+	env.count(t, p, 20, nil, map[string]bool{"b": true})
+	res := env.count(t, p, 100, nil, nil)
+	assert.Greater(t, res["a"], 90)
+
+	// 随时间慢慢恢复
+	env.now = env.now.Add(5 * time.Second)
+	res = env.count(t, p, 100, nil, nil)
+	assert.Greater(t, res["b"], 20)
+	assert.Less(t, res["b"], 50)
+	env.now = env.now.Add(10 * time.Second)
+	res = env.count(t, p, 100, nil, nil)
+	assert.Equal(t, 50, res["b"])
+
+	// SubConn 状态变化重建 picker 不丢失统计
+	env.count(t, p, 20, nil, map[string]bool{"a": true})
+	res = env.count(t, env.build(weights), 100, nil, nil)
+	assert.Greater(t, res["b"], 90)
+}
+
+func TestPicker_Latency(t *testing.T) {
+	weights := map[string]any{"a": 10, "b": 10}
+	env := newTestEnv(Config{}, weights)
+	p := env.build(weights)
+	rt := map[string]time.Duration{"a": 10 * time.Millisecond, "b": 40 * time.Millisecond}
+	env.count(t, p, 50, rt, nil)
+	// 耗时因子 a=1、b=0.25
+	res := env.count(t, p, 100, rt, nil)
+	assert.InDelta(t, 80, res["a"], 2)
+}
+
+func TestPicker_FastFailure(t *testing.T) {
+	weights := map[string]any{"a": 10, "b": 10}
+	env := newTestEnv(Config{RecoverTime: 10 * time.Second}, weights)
+	p := env.build(weights)
+	// b 快速失败，耗时不计入 EWMA，恢复后不会因为"耗时短"抢走流量
+	env.count(t, p, 20, map[string]time.Duration{"a": 40 * time.Millisecond, "b": time.Millisecond}, map[string]bool{"b": true})
+	env.now = env.now.Add(20 * time.Second)
+	res := env.count(t, p, 100, nil, nil)
+	assert.InDelta(t, 50, res["b"], 2)
+}
+
+func TestPicker_BusinessError(t *testing.T) {
+	weights := map[string]any{"a": 10, "b": 10}
+	env := newTestEnv(Config{}, weights)
+	p := env.build(weights)
+	// 业务错误不降低健康度
+	for i := 0; i < 20; i++ {
+		r, err := p.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		r.Done(balancer.DoneInfo{Err: status.Error(codes.InvalidArgument, "bad")})
+	}
+	res := env.count(t, p, 100, nil, nil)
+	assert.Equal(t, map[string]int{"a": 50, "b": 50}, res)
+}
+
+func TestPicker_P2C(t *testing.T) {
+	weights := map[string]any{"a": 10, "b": 10}
+	env := newTestEnv(Config{P2C: true}, weights)
+	p := env.build(weights)
+	// 两个节点时总是选负载低的：a 处理中的请求多
+	for i := 0; i < 3; i++ {
+		_, err := p.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		r, err := p.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		r.Done(balancer.DoneInfo{})
+	}
+	res := env.count(t, p, 100, map[string]time.Duration{"a": 50 * time.Millisecond, "b": time.Millisecond}, nil)
+	assert.Greater(t, res["b"], 80)
+}
+
+func TestPickerBuilder_UpdateWeights(t *testing.T) {
+	initial := map[string]any{"a": 10, "b": 10}
+	env := newTestEnv(Config{}, initial)
+	// etcd 中 weight 变化，base 复用 SubConn，SubConnInfo 中还是旧的 metadata
+	env.pb.updateWeights([]resolver.Address{
+		{Addr: "a", Metadata: map[string]any{"weight": float64(30)}},
+		{Addr: "b", Metadata: map[string]any{"weight": "10"}},
+	})
+	res := env.count(t, env.build(initial), 400, nil, nil)
+	assert.Equal(t, map[string]int{"a": 300, "b": 100}, res)
+
+	// 没有 weight 时使用默认权重
+	assert.Equal(t, float64(10), env.pb.weightOf(resolver.Address{Addr: "c"}))
+}
+
+func TestBuilder_Registered(t *testing.T) {
+	assert.NotNil(t, balancer.Get(Name))
+	assert.NotNil(t, balancer.Get(P2CName))
+}
@@ -2,6 +2,7 @@ package wrr
 
 // 在gRPC中接入自己的负载均衡算法
 import (
+	"github.com/hgg-6/pkgTool/v2/registry"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 	"sync"
@@ -27,6 +28,9 @@ func (p *PickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 		md, _ := sci.Address.Metadata.(map[string]any)
 		weightVal, _ := md["weight"]
 		weight, _ := weightVal.(float64)
+		if si, ok := registry.FromAddress(sci.Address); ok {
+			weight = float64(si.Weight)
+		}
 		//if weight == 0 {
 		//
 		//}
@@ -0,0 +1,232 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/aegis/circuitbreaker"
+	"github.com/go-kratos/aegis/circuitbreaker/sre"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNotAllowed 熔断器打开时拒绝请求
+var ErrNotAllowed = circuitbreaker.ErrNotAllowed
+
+// Factory 按名称创建熔断器，name 为 gRPC 的 fullMethod 或 HTTP 的 host，每个 name 一个独立实例
+//   - 拦截器和 Transport 不会对被拒绝的请求调用 MarkFailed，需要统计拒绝数的算法在 Allow 内自行统计
+type Factory func(name string) circuitbreaker.CircuitBreaker
+
+// NewSREFactory Google SRE 自适应熔断【aegis】，按成功率概率性丢弃请求，默认 3s 窗口、至少 100 个请求、成功率 0.6
+func NewSREFactory(opts ...sre.Option) Factory {
+	return func(name string) circuitbreaker.CircuitBreaker {
+		return &sreBreaker{CircuitBreaker: sre.NewBreaker(opts...)}
+	}
+}
+
+// sreBreaker 被拒绝的请求也计入失败，提高丢弃概率，与 aegis 的用法一致
+type sreBreaker struct {
+	circuitbreaker.CircuitBreaker
+}
+
+func (b *sreBreaker) Allow() error {
+	if err := b.CircuitBreaker.Allow(); err != nil {
+		b.CircuitBreaker.MarkFailed()
+		return err
+	}
+	return nil
+}
+
+// State 熔断器状态
+type State int32
+
+const (
+	StateClosed   State = iota // 关闭，正常放行
+	StateOpen                  // 打开，拒绝所有请求
+	StateHalfOpen              // 半开，放行少量探测请求
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// StateMachineConfig 经典三态熔断配置
+type StateMachineConfig struct {
+	// FailureThreshold 连续失败多少次后打开，默认 5
+	FailureThreshold int
+	// OpenTimeout 打开后多久进入半开，默认 5s；半开的探测请求放出后超过这个时间仍没有全部返回结果时视为失败，重新打开
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开时最多同时放行的探测请求数，全部成功后关闭，任一失败重新打开，默认 1
+	HalfOpenRequests int
+}
+
+// StateMachineBreaker 经典的 关闭/打开/半开 三态熔断器
+type StateMachineBreaker struct {
+	cfg StateMachineConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	state     State
+	failures  int       // 关闭状态下的连续失败数
+	openedAt  time.Time // 最近一次打开的时间
+	probes    int       // 半开状态下已放行的探测请求数
+	successes int       // 半开状态下已成功的探测请求数
+	probedAt  time.Time // 半开状态下最近一次放行探测请求的时间
+}
+
+// NewStateMachineBreaker 创建三态熔断器，零值配置使用默认值
+func NewStateMachineBreaker(cfg StateMachineConfig) *StateMachineBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 5 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &StateMachineBreaker{cfg: cfg, now: time.Now}
+}
+
+// NewStateMachineFactory 每个 name 一个三态熔断器
+func NewStateMachineFactory(cfg StateMachineConfig) Factory {
+	return func(name string) circuitbreaker.CircuitBreaker {
+		return NewStateMachineBreaker(cfg)
+	}
+}
+
+// State 当前状态，打开超过 OpenTimeout 时返回半开
+func (b *StateMachineBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// advance 打开超过 OpenTimeout 后进入半开；半开的探测请求超过 OpenTimeout 没有结果时重新打开，
+// 避免调用方漏调 MarkSuccess/MarkFailed 时探测名额一直被占用
+func (b *StateMachineBreaker) advance() {
+	switch {
+	case b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout:
+		b.state, b.probes, b.successes = StateHalfOpen, 0, 0
+	case b.state == StateHalfOpen && b.probes > b.successes && b.now().Sub(b.probedAt) >= b.cfg.OpenTimeout:
+		b.open()
+	}
+}
+
+// Allow 实现 circuitbreaker.CircuitBreaker
+func (b *StateMachineBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case StateOpen:
+		return ErrNotAllowed
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return ErrNotAllowed
+		}
+		b.probes++
+		b.probedAt = b.now()
+	}
+	return nil
+}
+
+// MarkSuccess 实现 circuitbreaker.CircuitBreaker
+func (b *StateMachineBreaker) MarkSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed:
+		b.failures = 0
+	case StateHalfOpen:
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.state, b.failures = StateClosed, 0
+		}
+	}
+}
+
+// MarkFailed 实现 circuitbreaker.CircuitBreaker
+func (b *StateMachineBreaker) MarkFailed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	case StateHalfOpen:
+		b.open()
+	}
+}
+
+func (b *StateMachineBreaker) open() {
+	b.state, b.openedAt, b.failures = StateOpen, b.now(), 0
+}
+
+// Classifier 判断一次 gRPC 调用的错误是否计为失败，err 为 nil 时不会调用
+type Classifier func(err error) bool
+
+// DefaultClassifier 只有服务端异常计为失败：Unknown、DeadlineExceeded、ResourceExhausted、Internal、Unavailable、DataLoss
+//   - InvalidArgument、NotFound 等业务错误和调用方主动取消不会触发熔断
+var DefaultClassifier = CodeClassifier(codes.Unknown, codes.DeadlineExceeded, codes.ResourceExhausted,
+	codes.Internal, codes.Unavailable, codes.DataLoss)
+
+// CodeClassifier 指定的 gRPC code 计为失败，非 status 错误按 codes.Unknown 处理，ctx 错误按对应的 code 处理
+func CodeClassifier(cs ...codes.Code) Classifier {
+	set := make(map[codes.Code]struct{}, len(cs))
+	for _, c := range cs {
+		set[c] = struct{}{}
+	}
+	return func(err error) bool {
+		_, ok := set[code(err)]
+		return ok
+	}
+}
+
+func code(err error) codes.Code {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Code()
+	}
+	return status.Code(err)
+}
+
+// group 按名称懒创建熔断器
+type group struct {
+	factory Factory
+	mu      sync.RWMutex
+	m       map[string]circuitbreaker.CircuitBreaker
+}
+
+func newGroup(factory Factory) *group {
+	return &group{factory: factory, m: make(map[string]circuitbreaker.CircuitBreaker)}
+}
+
+func (g *group) get(name string) circuitbreaker.CircuitBreaker {
+	g.mu.RLock()
+	cb, ok := g.m[name]
+	g.mu.RUnlock()
+	if ok {
+		return cb
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if cb, ok = g.m[name]; !ok {
+		cb = g.factory(name)
+		g.m[name] = cb
+	}
+	return cb
+}
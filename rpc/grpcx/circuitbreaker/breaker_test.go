@@ -0,0 +1,105 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStateMachineBreaker(t *testing.T) {
+	b := NewStateMachineBreaker(StateMachineConfig{FailureThreshold: 2, OpenTimeout: time.Second, HalfOpenRequests: 2})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	// 成功会清零连续失败数
+	b.MarkFailed()
+	b.MarkSuccess()
+	b.MarkFailed()
+	assert.Equal(t, StateClosed, b.State())
+	b.MarkFailed()
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrNotAllowed)
+
+	// 超时后半开，最多放行 2 个探测请求
+	now = now.Add(time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.NoError(t, b.Allow())
+	assert.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrNotAllowed)
+	// 探测失败重新打开
+	b.MarkFailed()
+	assert.Equal(t, StateOpen, b.State())
+
+	now = now.Add(time.Second)
+	assert.NoError(t, b.Allow())
+	assert.NoError(t, b.Allow())
+	b.MarkSuccess()
+	assert.Equal(t, StateHalfOpen, b.State())
+	b.MarkSuccess()
+	assert.Equal(t, StateClosed, b.State())
+	assert.NoError(t, b.Allow())
+}
+
+func TestStateMachineBreaker_StuckProbe(t *testing.T) {
+	b := NewStateMachineBreaker(StateMachineConfig{FailureThreshold: 1, OpenTimeout: time.Second})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	b.MarkFailed()
+	now = now.Add(time.Second)
+	// 探测请求一直没有结果
+	assert.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrNotAllowed)
+	now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	// 超过 OpenTimeout 视为失败重新打开，再过 OpenTimeout 重新放行探测
+	now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrNotAllowed)
+	now = now.Add(time.Second)
+	assert.NoError(t, b.Allow())
+	b.MarkSuccess()
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestSREFactory(t *testing.T) {
+	cb := NewSREFactory()("a")
+	for i := 0; i < 200; i++ {
+		cb.MarkFailed()
+	}
+	// 全部失败后大概率被拒绝
+	rejected := 0
+	for i := 0; i < 100; i++ {
+		if cb.Allow() != nil {
+			rejected++
+		}
+	}
+	assert.Greater(t, rejected, 80)
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "参数错误", err: status.Error(codes.InvalidArgument, "bad"), want: false},
+		{name: "不存在", err: status.Error(codes.NotFound, "nf"), want: false},
+		{name: "不可用", err: status.Error(codes.Unavailable, "down"), want: true},
+		{name: "内部错误", err: status.Error(codes.Internal, "oops"), want: true},
+		{name: "非 status 错误", err: errors.New("x"), want: true},
+		{name: "超时", err: context.DeadlineExceeded, want: true},
+		{name: "调用方取消", err: context.Canceled, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, DefaultClassifier(tc.err))
+		})
+	}
+}
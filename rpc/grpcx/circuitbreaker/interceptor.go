@@ -2,29 +2,156 @@ package circuitbreaker
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sync"
+
 	"github.com/go-kratos/aegis/circuitbreaker"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// InterceptorBuilder 熔断拦截器，服务端和客户端通用
+//   - 默认使用 SRE 自适应熔断，每个方法一个独立的熔断器，只有 DefaultClassifier 中的 code 计为失败
+//   - 熔断时返回 codes.Unavailable
 type InterceptorBuilder struct {
-	breaker circuitbreaker.CircuitBreaker
+	breakers   *group
+	classifier Classifier
+	perMethod  bool
+}
+
+// NewInterceptorBuilder 创建熔断拦截器
+func NewInterceptorBuilder() *InterceptorBuilder {
+	return &InterceptorBuilder{
+		breakers:   newGroup(NewSREFactory()),
+		classifier: DefaultClassifier,
+		perMethod:  true,
+	}
+}
+
+// Breaker 熔断算法，如 NewSREFactory()、NewStateMachineFactory(cfg)
+func (b *InterceptorBuilder) Breaker(factory Factory) *InterceptorBuilder {
+	b.breakers = newGroup(factory)
+	return b
+}
+
+// Classifier 哪些错误计为失败，默认 DefaultClassifier
+func (b *InterceptorBuilder) Classifier(fn Classifier) *InterceptorBuilder {
+	b.classifier = fn
+	return b
+}
+
+// PerMethod 是否每个方法一个熔断器，默认 true，false 时所有方法共用一个
+func (b *InterceptorBuilder) PerMethod(perMethod bool) *InterceptorBuilder {
+	b.perMethod = perMethod
+	return b
+}
+
+func (b *InterceptorBuilder) breaker(fullMethod string) circuitbreaker.CircuitBreaker {
+	if !b.perMethod {
+		fullMethod = ""
+	}
+	return b.breakers.get(fullMethod)
+}
+
+// mark 按调用结果更新熔断器
+func (b *InterceptorBuilder) mark(cb circuitbreaker.CircuitBreaker, err error) {
+	if err != nil && b.classifier(err) {
+		cb.MarkFailed()
+		return
+	}
+	cb.MarkSuccess()
+}
+
+// done 在 defer 中按调用结果更新熔断器，handler panic 时计为失败后继续 panic，避免半开的探测名额一直被占用
+func (b *InterceptorBuilder) done(cb circuitbreaker.CircuitBreaker, err *error) {
+	if r := recover(); r != nil {
+		cb.MarkFailed()
+		panic(r)
+	}
+	b.mark(cb, *err)
+}
+
+func rejected(fullMethod string) error {
+	return status.Errorf(codes.Unavailable, "熔断: %s", fullMethod)
 }
 
+// BuildServerUnaryInterceptor 服务端一元熔断拦截器
 func (b *InterceptorBuilder) BuildServerUnaryInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
-		err = b.breaker.Allow()
-		if err == nil {
-			resp, err = handler(ctx, req)
-			if err == nil {
-				b.breaker.MarkSuccess()
-			} else {
-				b.breaker.MarkFailed()
+		cb := b.breaker(info.FullMethod)
+		if cb.Allow() != nil {
+			return nil, rejected(info.FullMethod)
+		}
+		defer b.done(cb, &err)
+		return handler(ctx, req)
+	}
+}
+
+// BuildServerStreamInterceptor 服务端流式熔断拦截器，按 handler 的返回值判断成功失败
+func (b *InterceptorBuilder) BuildServerStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		cb := b.breaker(info.FullMethod)
+		if cb.Allow() != nil {
+			return rejected(info.FullMethod)
+		}
+		defer b.done(cb, &err)
+		return handler(srv, ss)
+	}
+}
+
+// BuildClientUnaryInterceptor 客户端一元熔断拦截器，熔断时不发起调用
+func (b *InterceptorBuilder) BuildClientUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		cb := b.breaker(method)
+		if cb.Allow() != nil {
+			return rejected(method)
+		}
+		defer b.done(cb, &err)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// BuildClientStreamInterceptor 客户端流式熔断拦截器
+//   - 建立流失败时立即计为失败，否则在 RecvMsg 返回错误时按错误判断，io.EOF 计为成功
+//   - 没有读到流结束的调用不会更新熔断器，三态熔断器半开时的这类探测请求超过 OpenTimeout 后按失败处理
+func (b *InterceptorBuilder) BuildClientStreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cb := b.breaker(method)
+		if cb.Allow() != nil {
+			return nil, rejected(method)
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				cb.MarkFailed()
+				panic(r)
 			}
-			return
+		}()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			b.mark(cb, err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, done: func(err error) { b.mark(cb, err) }}, nil
+	}
+}
+
+// clientStream 流结束时更新熔断器，只更新一次
+type clientStream struct {
+	grpc.ClientStream
+	once sync.Once
+	done func(err error)
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			s.once.Do(func() { s.done(nil) })
+		} else {
+			s.once.Do(func() { s.done(err) })
 		}
-		b.breaker.MarkFailed()
-		return nil, status.Errorf(codes.Unavailable, "熔断")
 	}
+	return err
 }
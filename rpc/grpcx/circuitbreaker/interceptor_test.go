@@ -0,0 +1,123 @@
+package circuitbreaker
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestBuilder() *InterceptorBuilder {
+	return NewInterceptorBuilder().Breaker(NewStateMachineFactory(StateMachineConfig{FailureThreshold: 1, OpenTimeout: time.Hour}))
+}
+
+func TestInterceptorBuilder_ServerUnary(t *testing.T) {
+	interceptor := newTestBuilder().BuildServerUnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/a"}
+	fail := func(c codes.Code) grpc.UnaryHandler {
+		return func(ctx context.Context, req any) (any, error) { return nil, status.Error(c, "x") }
+	}
+
+	// 业务错误不触发熔断
+	_, err := interceptor(context.Background(), nil, info, fail(codes.InvalidArgument))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = interceptor(context.Background(), nil, info, fail(codes.Internal))
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	called := false
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		called = true
+		return nil, nil
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.False(t, called)
+
+	// 每个方法独立熔断
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/b"},
+		func(ctx context.Context, req any) (any, error) { return "ok", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+}
+
+func TestInterceptorBuilder_SharedBreaker(t *testing.T) {
+	interceptor := newTestBuilder().PerMethod(false).
+		Classifier(CodeClassifier(codes.NotFound)).
+		BuildClientUnaryInterceptor()
+	invoker := func(c codes.Code) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return status.Error(c, "x")
+		}
+	}
+	err := interceptor(context.Background(), "/a", nil, nil, nil, invoker(codes.Internal))
+	assert.Equal(t, codes.Internal, status.Code(err))
+	err = interceptor(context.Background(), "/a", nil, nil, nil, invoker(codes.NotFound))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// 所有方法共用一个熔断器
+	err = interceptor(context.Background(), "/b", nil, nil, nil, invoker(codes.OK))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// fakeClientStream 依次返回 errs 中的错误
+type fakeClientStream struct {
+	grpc.ClientStream
+	errs []error
+}
+
+func (s *fakeClientStream) RecvMsg(m any) error {
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestInterceptorBuilder_ClientStream(t *testing.T) {
+	interceptor := newTestBuilder().BuildClientStreamInterceptor()
+	streamer := func(errs ...error) grpc.Streamer {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{errs: errs}, nil
+		}
+	}
+
+	// 正常读到 EOF
+	cs, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/a", streamer(nil, io.EOF))
+	require.NoError(t, err)
+	assert.NoError(t, cs.RecvMsg(nil))
+	assert.ErrorIs(t, cs.RecvMsg(nil), io.EOF)
+
+	// 流中途失败
+	cs, err = interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/a", streamer(status.Error(codes.Unavailable, "down")))
+	require.NoError(t, err)
+	assert.Error(t, cs.RecvMsg(nil))
+
+	_, err = interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/a", streamer(io.EOF))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestInterceptorBuilder_ServerStream(t *testing.T) {
+	interceptor := newTestBuilder().BuildServerStreamInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/a"}
+	err := interceptor(nil, nil, info, func(srv any, stream grpc.ServerStream) error {
+		return status.Error(codes.DeadlineExceeded, "slow")
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	err = interceptor(nil, nil, info, func(srv any, stream grpc.ServerStream) error { return nil })
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestInterceptorBuilder_Panic(t *testing.T) {
+	b := NewInterceptorBuilder().Breaker(NewStateMachineFactory(StateMachineConfig{FailureThreshold: 1, OpenTimeout: time.Hour}))
+	interceptor := b.BuildServerUnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/a"}
+
+	// handler panic 计为失败，panic 继续向外传给 recovery
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) { panic("boom") })
+	})
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) { return nil, nil })
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
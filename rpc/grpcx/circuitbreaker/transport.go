@@ -0,0 +1,76 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Transport HTTP 熔断，实现 http.RoundTripper，用于 gin 等服务调用下游 HTTP 接口
+//   - 默认每个 host 一个 SRE 熔断器，网络错误和 5xx 计为失败
+//   - 熔断时不发起请求，返回包装了 ErrNotAllowed 的错误
+type Transport struct {
+	next       http.RoundTripper
+	breakers   *group
+	keyFunc    func(req *http.Request) string
+	classifier func(resp *http.Response, err error) bool
+}
+
+// NewTransport 创建 HTTP 熔断，next 为 nil 时使用 http.DefaultTransport
+//
+//	client := &http.Client{Transport: circuitbreaker.NewTransport(nil)}
+func NewTransport(next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{
+		next:     next,
+		breakers: newGroup(NewSREFactory()),
+		keyFunc: func(req *http.Request) string {
+			return req.URL.Host
+		},
+		classifier: func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= http.StatusInternalServerError
+		},
+	}
+}
+
+// Breaker 熔断算法，如 NewSREFactory()、NewStateMachineFactory(cfg)
+func (t *Transport) Breaker(factory Factory) *Transport {
+	t.breakers = newGroup(factory)
+	return t
+}
+
+// KeyFunc 熔断器的划分维度，默认按 host，可改为 host+path 等
+func (t *Transport) KeyFunc(fn func(req *http.Request) string) *Transport {
+	t.keyFunc = fn
+	return t
+}
+
+// Classifier 哪些结果计为失败，默认 err 不为 nil 或状态码 >= 500
+func (t *Transport) Classifier(fn func(resp *http.Response, err error) bool) *Transport {
+	t.classifier = fn
+	return t
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := t.keyFunc(req)
+	cb := t.breakers.get(key)
+	if err := cb.Allow(); err != nil {
+		return nil, fmt.Errorf("熔断: %s: %w", key, err)
+	}
+	// next panic 时计为失败后继续 panic，避免半开的探测名额一直被占用
+	defer func() {
+		if r := recover(); r != nil {
+			cb.MarkFailed()
+			panic(r)
+		}
+	}()
+	resp, err := t.next.RoundTrip(req)
+	if t.classifier(resp, err) {
+		cb.MarkFailed()
+	} else {
+		cb.MarkSuccess()
+	}
+	return resp, err
+}
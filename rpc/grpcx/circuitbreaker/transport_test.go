@@ -0,0 +1,46 @@
+package circuitbreaker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	code := http.StatusBadRequest
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(nil).
+		Breaker(NewStateMachineFactory(StateMachineConfig{FailureThreshold: 2, OpenTimeout: time.Hour}))}
+	get := func() (*http.Response, error) {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	// 4xx 不计为失败
+	for i := 0; i < 3; i++ {
+		resp, err := get()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+	code = http.StatusServiceUnavailable
+	for i := 0; i < 2; i++ {
+		_, err := get()
+		require.NoError(t, err)
+	}
+	_, err := get()
+	assert.ErrorIs(t, err, ErrNotAllowed)
+	assert.Equal(t, 5, calls)
+}
@@ -0,0 +1,168 @@
+package grpcx
+
+import (
+	"fmt"
+
+	"github.com/hgg-6/pkgTool/v2/registry"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/circuitbreaker"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/grpcLogX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/otleTraceX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/prometeusX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/retry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ClientOption Client 配置
+type ClientOption func(*Client)
+
+// WithClientTracing 链路追踪，把 trace 上下文传给服务端
+func WithClientTracing(b *otleTraceX.OTELInterceptorBuilder) ClientOption {
+	return func(c *Client) {
+		c.tracing = b
+	}
+}
+
+// WithClientMetrics prometheus 监控，从调用方看下游服务的耗时和错误
+func WithClientMetrics(b *prometeusX.InterceptorBuilder) ClientOption {
+	return func(c *Client) {
+		c.metrics = b
+	}
+}
+
+// WithClientLogger 调用日志，慢调用阈值通过 grpcLogX.InterceptorBuilder.SlowThreshold 设置
+func WithClientLogger(b *grpcLogX.InterceptorBuilder) ClientOption {
+	return func(c *Client) {
+		c.logger = b
+	}
+}
+
+// WithClientRetry 重试和 hedging，每次尝试都会经过熔断
+func WithClientRetry(b *retry.InterceptorBuilder) ClientOption {
+	return func(c *Client) {
+		c.retry = b
+	}
+}
+
+// WithClientBreaker 熔断，熔断时不发起调用
+func WithClientBreaker(b *circuitbreaker.InterceptorBuilder) ClientOption {
+	return func(c *Client) {
+		c.breaker = b
+	}
+}
+
+// WithDiscovery 通过注册中心发现服务，target 为服务名
+func WithDiscovery(reg registry.Registry) ClientOption {
+	return func(c *Client) {
+		c.registry = reg
+	}
+}
+
+// WithBalancer 负载均衡算法，如 round_robin、custom_weighted_round_robin、dynamic_weighted_round_robin、custom_ring_hash，
+// 自定义算法需匿名导入对应的包
+func WithBalancer(name string) ClientOption {
+	return func(c *Client) {
+		c.balancer = name
+	}
+}
+
+// WithClientUnaryInterceptor 追加自定义一元拦截器，位于内置拦截器之后
+func WithClientUnaryInterceptor(interceptors ...grpc.UnaryClientInterceptor) ClientOption {
+	return func(c *Client) {
+		c.unary = append(c.unary, interceptors...)
+	}
+}
+
+// WithClientStreamInterceptor 追加自定义流拦截器，位于内置拦截器之后
+func WithClientStreamInterceptor(interceptors ...grpc.StreamClientInterceptor) ClientOption {
+	return func(c *Client) {
+		c.stream = append(c.stream, interceptors...)
+	}
+}
+
+// WithDialOption 追加原生 grpc.DialOption，如 TLS，默认不加密
+func WithDialOption(opts ...grpc.DialOption) ClientOption {
+	return func(c *Client) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// Client 组装好拦截器的 gRPC 客户端
+//   - 一元、流拦截器顺序：链路追踪 -> 监控 -> 日志 -> 重试【只有一元】 -> 熔断 -> 自定义，被熔断的调用也会被记录，重试的多次尝试记为一次调用
+type Client struct {
+	target   string
+	tracing  *otleTraceX.OTELInterceptorBuilder
+	metrics  *prometeusX.InterceptorBuilder
+	logger   *grpcLogX.InterceptorBuilder
+	retry    *retry.InterceptorBuilder
+	breaker  *circuitbreaker.InterceptorBuilder
+	registry registry.Registry
+	balancer string
+	unary    []grpc.UnaryClientInterceptor
+	stream   []grpc.StreamClientInterceptor
+	dialOpts []grpc.DialOption
+}
+
+// NewClient 创建 gRPC 客户端，target 为 grpc.NewClient 的 target，使用 WithDiscovery 时为服务名
+func NewClient(target string, opts ...ClientOption) *Client {
+	c := &Client{target: target}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Build 创建连接，连接是惰性的，第一次调用时才会建立
+func (c *Client) Build() (*grpc.ClientConn, error) {
+	target := c.target
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(c.unaryInterceptors()...),
+		grpc.WithChainStreamInterceptor(c.streamInterceptors()...),
+	}
+	if c.registry != nil {
+		target = registry.Scheme + ":///" + c.target
+		opts = append(opts, grpc.WithResolvers(registry.NewResolverBuilder(c.registry)))
+	}
+	if c.balancer != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, c.balancer)))
+	}
+	return grpc.NewClient(target, append(opts, c.dialOpts...)...)
+}
+
+func (c *Client) unaryInterceptors() []grpc.UnaryClientInterceptor {
+	var res []grpc.UnaryClientInterceptor
+	if c.tracing != nil {
+		res = append(res, c.tracing.BuildUnaryClientInterceptor())
+	}
+	if c.metrics != nil {
+		res = append(res, c.metrics.BuildClientUnaryInterceptor())
+	}
+	if c.logger != nil {
+		res = append(res, c.logger.BuildClientUnaryInterceptor())
+	}
+	if c.retry != nil {
+		res = append(res, c.retry.BuildClientUnaryInterceptor())
+	}
+	if c.breaker != nil {
+		res = append(res, c.breaker.BuildClientUnaryInterceptor())
+	}
+	return append(res, c.unary...)
+}
+
+func (c *Client) streamInterceptors() []grpc.StreamClientInterceptor {
+	var res []grpc.StreamClientInterceptor
+	if c.tracing != nil {
+		res = append(res, c.tracing.BuildClientStreamInterceptor())
+	}
+	if c.metrics != nil {
+		res = append(res, c.metrics.BuildClientStreamInterceptor())
+	}
+	if c.logger != nil {
+		res = append(res, c.logger.BuildClientStreamInterceptor())
+	}
+	if c.breaker != nil {
+		res = append(res, c.breaker.BuildClientStreamInterceptor())
+	}
+	return append(res, c.stream...)
+}
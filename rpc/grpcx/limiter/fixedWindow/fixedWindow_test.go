@@ -0,0 +1,43 @@
+package fixedWindow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hgg-6/pkgTool/v2/webx/ginx/middleware/limitX"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFixedWindowLimiter_SharedBudget(t *testing.T) {
+	l := NewFixedWindowLimiter(time.Minute, 3)
+	interceptor := l.BuildServerInterceptor()
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	call := func(method string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(limitX.NewRedisBuilder(l.Limiter(), nil).Global().Build())
+	server.GET("/ping", func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") })
+	get := func() int {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		return recorder.Code
+	}
+
+	// 不同方法、gin 和 gRPC 共用一个额度
+	assert.NoError(t, call("/a"))
+	assert.NoError(t, call("/b"))
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("/c")))
+	assert.Equal(t, http.StatusTooManyRequests, get())
+}
@@ -0,0 +1,71 @@
+package limiterX
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/limiter"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInterceptorBuilder_Unary(t *testing.T) {
+	l := limiter.NewFixedWindowLimiter(time.Minute, 1)
+	interceptor := NewInterceptorBuilder(l).
+		KeyFunc(func(ctx context.Context, fullMethod string) string { return fullMethod }).
+		Message("限流了").
+		BuildServerInterceptor()
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/a"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/a"}, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, "限流了", status.Convert(err).Message())
+
+	// 按方法限流，其它方法不受影响
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/b"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestInterceptorBuilder_CounterRelease(t *testing.T) {
+	l := limiter.NewCounterLimiter(1)
+	interceptor := NewInterceptorBuilder(l).BuildServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/a"}
+
+	// 处理中占用额度，嵌套请求被拒绝
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) { return nil, nil })
+		return nil, err
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// 处理完成后归还额度
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) { return nil, nil })
+	assert.NoError(t, err)
+}
+
+// keyLimiter 记录收到的 key
+type keyLimiter struct {
+	keys []string
+}
+
+func (l *keyLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	l.keys = append(l.keys, key)
+	return false, nil
+}
+
+func TestInterceptorBuilder_DefaultKey(t *testing.T) {
+	l := &keyLimiter{}
+	interceptor := NewInterceptorBuilder(l).BuildServerInterceptor()
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/user.UserService/Get"},
+		func(ctx context.Context, req any) (any, error) { return nil, nil })
+	assert.NoError(t, err)
+	// Redis 限流器拒绝空 key，默认按方法限流
+	assert.Equal(t, []string{"/user.UserService/Get"}, l.keys)
+}
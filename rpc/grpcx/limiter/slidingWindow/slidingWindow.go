@@ -1,21 +1,18 @@
 package slidingWindow
 
 import (
-	"context"
-	"github.com/hgg-6/pkgTool/v2/sliceX/queueX"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-	"sync"
+	"fmt"
 	"time"
+
+	"github.com/hgg-6/pkgTool/v2/limiter"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/limiter/limiterX"
+	"google.golang.org/grpc"
 )
 
 // SlidingWindowLimiter 滑动窗口限流器
 type SlidingWindowLimiter struct {
-	window    time.Duration                    // 统计窗口大小（如1分钟）
-	threshold int                              // 窗口内允许的最大请求数（阈值）
-	queue     *queueX.PriorityQueue[time.Time] // 存储请求时间戳的最小堆（队首是最早请求）
-	lock      sync.Mutex                       // 限流器全局锁（保护队列操作）
+	threshold int // 窗口内允许的最大请求数（阈值）
+	l         *limiter.LocalLimiter
 }
 
 // NewSlidingWindowLimiter 构造函数
@@ -24,81 +21,32 @@ type SlidingWindowLimiter struct {
 //
 // 每1秒最多有100个请求/秒，即1秒内最多100个请求
 func NewSlidingWindowLimiter(window time.Duration, threshold int) *SlidingWindowLimiter {
-	// 初始化最小堆：比较函数用time.Time.Before（早的时间戳更小，队首是最旧请求）
-	return &SlidingWindowLimiter{
-		window:    window,
-		threshold: threshold,
-		queue:     queueX.NewPriorityQueue[time.Time](func(a, b time.Time) bool { return a.Before(b) }, 0),
-	}
+	return &SlidingWindowLimiter{threshold: threshold, l: limiter.NewSlidingWindowLimiter(window, threshold)}
+}
+
+// Limiter 底层限流器，可与 gin 中间件共用
+func (c *SlidingWindowLimiter) Limiter() *limiter.LocalLimiter {
+	return c.l
 }
 
 // BuildServerInterceptor
 //   - 构建gRPC服务端拦截器
 //   - 构建gRPC UnaryServerInterceptor
 func (c *SlidingWindowLimiter) BuildServerInterceptor() grpc.UnaryServerInterceptor {
-	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
-		if !c.Allow() {
-			// 限流：返回资源耗尽错误【返回使用status.Errorf方便日志捕捉】
-			return nil, status.Errorf(codes.ResourceExhausted, "【hgg: rpc触发限流】超出窗口最大请求数量%d", c.threshold)
-		}
-		// 允许请求：调用后续处理逻辑
-		return handler(ctx, req)
-	}
+	// 限流：返回资源耗尽错误【返回使用status.Errorf方便日志捕捉】
+	return limiterX.NewInterceptorBuilder(c.l).Global().
+		Message(fmt.Sprintf("【hgg: rpc触发限流】滑动窗口限流，超出窗口最大请求数量%d", c.threshold)).
+		BuildServerInterceptor()
 }
 
 // Allow
 //   - 检查是否允许通过请求
 //   - 判断是否允许当前请求（核心逻辑）
 func (c *SlidingWindowLimiter) Allow() bool {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-c.window) // 窗口左边界（当前时间往前推window）
-
-	// 1. 清理过期请求：删除队列中所有早于windowStart的时间戳
-	c.removeExpired(windowStart)
-	//for {
-	//	peekTime, ok := c.queue.Peek()
-	//	if !ok || !peekTime.Before(windowStart) {
-	//		break // 队首已处于窗口内，无需继续清理
-	//	}
-	//	c.queue.Pop() // 移除过期请求
-	//}
-
-	// 2. 检查是否超过阈值
-	if c.queue.Size() >= c.threshold {
-		return false // 超过阈值，不允许
-	}
-
-	// 3. 记录当前请求时间戳
-	//c.queue.Push(now)
-	c.queue.Enqueue(now)
-	return true // 允许请求
-}
-
-// removeExpired 移除过期的请求时间戳
-func (c *SlidingWindowLimiter) removeExpired(windowStart time.Time) {
-	// 持续移除窗口开始时间之前的请求
-	// 清理过期请求：删除队列中所有早于windowStart的时间戳
-	for {
-		peekTime, ok := c.queue.Peek()
-		if !ok || !peekTime.Before(windowStart) {
-			break // 队首已处于窗口内，无需继续清理
-		}
-		//c.queue.Pop() // 移除过期请求
-		c.queue.Dequeue() // 移除过期请求
-	}
+	return c.l.Allow(limiter.GlobalKey)
 }
 
-// GetCurrentCount 获取当前队列长度（主要用于测试）
+// GetCurrentCount 获取当前窗口内的请求数（主要用于测试）
 func (c *SlidingWindowLimiter) GetCurrentCount() int {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-c.window)
-	c.removeExpired(windowStart)
-
-	return c.queue.Size()
+	return c.threshold - c.l.Remaining(limiter.GlobalKey)
 }
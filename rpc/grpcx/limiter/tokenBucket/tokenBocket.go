@@ -1,98 +1,41 @@
 package tokenBucket
 
 import (
-	"context"
-	"sync"
+	"fmt"
 	"time"
 
+	"github.com/hgg-6/pkgTool/v2/limiter"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/limiter/limiterX"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 // TokenBucketLimiter 令牌桶限流算法
 type TokenBucketLimiter struct {
-	// 隔多久产生一个令牌
-	interval  time.Duration // 令牌产生的时间间隔
-	buckets   chan struct{} // 令牌桶
-	closeCh   chan struct{} // 关闭信号
-	closeOnce sync.Once     // 关闭信号只关闭一次
-	started   bool          // 标记是否已启动goroutine
-	mu        sync.Mutex    // 保护started字段
+	interval time.Duration // 令牌产生的时间间隔
+	capacity int           // 令牌桶容量
+	l        *limiter.LocalLimiter
 }
 
 // NewTokenBucketLimiter 创建令牌桶限流算法
-//   - interval 令牌产生时间间隔（<=0 时取默认 100ms，避免 time.NewTicker(0) panic）
-//   - capacity 令牌桶容量（<=0 时取默认 1，避免无缓冲 channel 导致令牌永远发不进）
+//   - interval 令牌产生时间间隔
+//   - capacity 令牌桶容量，初始为满桶
 func NewTokenBucketLimiter(interval time.Duration, capacity int) *TokenBucketLimiter {
-	if interval <= 0 {
-		interval = 100 * time.Millisecond
-	}
-	if capacity <= 0 {
-		capacity = 1
-	}
-	bucket := make(chan struct{}, capacity)
-	closec := make(chan struct{})
-	limiter := &TokenBucketLimiter{
-		interval: interval,
-		buckets:  bucket,
-		closeCh:  closec,
-		started:  false,
-	}
-	limiter.startTokenGenerator()
-	return limiter
+	return &TokenBucketLimiter{interval: interval, capacity: capacity, l: limiter.NewTokenBucketLimiter(interval, capacity)}
 }
 
-// startTokenGenerator 启动令牌生成goroutine（只启动一次）
-func (c *TokenBucketLimiter) startTokenGenerator() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.started {
-		return // 已启动，避免重复
-	}
-	c.started = true
-
-	// 发令牌
-	ticker := time.NewTicker(c.interval)
-	go func() {
-		defer ticker.Stop() // 确保 ticker 被正确停止，防止资源泄漏
-		for {
-			select {
-			case <-ticker.C:
-				select {
-				case c.buckets <- struct{}{}:
-				default:
-					// bucket 满了
-				}
-			case <-c.closeCh:
-				return
-			}
-		}
-	}()
+// Limiter 底层限流器，可与 gin 中间件共用
+func (c *TokenBucketLimiter) Limiter() *limiter.LocalLimiter {
+	return c.l
 }
 
 // BuildServerInterceptor 令牌桶限流算法
 func (c *TokenBucketLimiter) BuildServerInterceptor() grpc.UnaryServerInterceptor {
-	// 取令牌
-	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
-		select {
-		case <-c.buckets: // 从桶中取一个令牌
-			return handler(ctx, req) // 处理请求，可以执行业务代码
-		//做法1
-		default:
-			return nil, status.Errorf(codes.ResourceExhausted, "限流")
-			// 做法2，等待超时了再退出【根据context】
-			//case <-ctx.Done():
-			//	return nil, ctx.Err()
-		}
-	}
+	return limiterX.NewInterceptorBuilder(c.l).Global().
+		Message(fmt.Sprintf("令牌桶限流：桶容量 %d，令牌间隔 %v", c.capacity, c.interval)).
+		BuildServerInterceptor()
 }
 
-// Close 关闭限流器，释放资源
+// Close 令牌按时间差惰性补充，没有后台 goroutine，保留以兼容旧代码
 func (c *TokenBucketLimiter) Close() error {
-	c.closeOnce.Do(func() {
-		close(c.closeCh)
-	})
 	return nil
 }
@@ -40,6 +40,23 @@ func (b *Builder) PeerIP(ctx context.Context) string {
 	return ""
 }
 
+// PeerTarget 客户端调用的对端服务，target 去掉 scheme，如 registry:///user 为 user、127.0.0.1:8090 不变
+func (b *Builder) PeerTarget(target string) string {
+	if i := strings.Index(target, ":///"); i >= 0 {
+		return target[i+len(":///"):]
+	}
+	return target
+}
+
+// ClientPeerIP 客户端调用实际连接的对端 ip，p 由 grpc.Peer 调用选项或客户端流的 Context 取得
+//   - 不读取 incoming metadata，客户端在服务端的 handler 中发起调用时也不会取到上游的 ip
+func (b *Builder) ClientPeerIP(p *peer.Peer) string {
+	if p == nil {
+		return ""
+	}
+	return b.PeerIP(peer.NewContext(context.Background(), p))
+}
+
 func (b *Builder) grpcHeaderValue(ctx context.Context, key string) string {
 	if key == "" {
 		return ""
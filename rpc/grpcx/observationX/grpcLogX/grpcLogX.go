@@ -7,13 +7,15 @@ import (
 	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"runtime"
 	"time"
 )
 
 type InterceptorBuilder struct {
-	l logx.Loggerx
+	l    logx.Loggerx
+	slow time.Duration
 	observationX.Builder
 }
 
@@ -21,6 +23,12 @@ func NewInterceptorBuilder(l logx.Loggerx) *InterceptorBuilder {
 	return &InterceptorBuilder{l: l}
 }
 
+// SlowThreshold 客户端调用耗时超过 d 时按 Warn 级别记录，event 为 slow，默认不区分慢调用
+func (b *InterceptorBuilder) SlowThreshold(d time.Duration) *InterceptorBuilder {
+	b.slow = d
+	return b
+}
+
 func (b *InterceptorBuilder) BuildServerUnaryInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
 		start := time.Now()
@@ -67,3 +75,104 @@ func (b *InterceptorBuilder) BuildServerUnaryInterceptor() grpc.UnaryServerInter
 		return
 	}
 }
+
+// BuildServerStreamInterceptor 流结束时记录一条日志，包含收发消息数、耗时和最终状态
+func (b *InterceptorBuilder) BuildServerStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
+		event := "normal"
+		ctx := ss.Context()
+		ws := observationX.NewServerStream(ctx, ss, nil)
+		defer func() {
+			var stack []byte
+			if rec := recover(); rec != nil {
+				event = "recover"
+				stack = make([]byte, 4096)
+				stack = stack[:runtime.Stack(stack, true)]
+				err = status.New(codes.Internal, fmt.Sprintf("panic, err %v", rec)).Err()
+			}
+			fields := []logx.Field{
+				logx.String("type", "stream"),
+				logx.Int64("cost", time.Since(start).Milliseconds()),
+				logx.String("event", event),
+				logx.String("method", info.FullMethod),
+				logx.String("peer", b.PeerName(ctx)),
+				logx.String("peer_ip", b.PeerIP(ctx)),
+				logx.Int64("sent", ws.Sent()),
+				logx.Int64("received", ws.Received()),
+			}
+			if stack != nil {
+				fields = append(fields, logx.String("stack", string(stack)))
+			}
+			b.log("RPC调用", err, fields)
+		}()
+		return handler(srv, ws)
+	}
+}
+
+// BuildClientUnaryInterceptor 调用方记录每次调用，peer 为调用的服务【target 去掉 scheme】，peer_ip 为实际连接的地址
+func (b *InterceptorBuilder) BuildClientUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		p := &peer.Peer{}
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(p))...)
+		b.clientLog(err, time.Since(start), []logx.Field{
+			logx.String("type", "unary"),
+			logx.String("method", method),
+			logx.String("peer", b.PeerTarget(cc.Target())),
+			logx.String("peer_ip", b.ClientPeerIP(p)),
+		})
+		return err
+	}
+}
+
+// BuildClientStreamInterceptor 流结束时记录一条日志，包含收发消息数、耗时和最终状态
+func (b *InterceptorBuilder) BuildClientStreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		fields := func(peerIP string, sent, received int64) []logx.Field {
+			return []logx.Field{
+				logx.String("type", "stream"),
+				logx.String("method", method),
+				logx.String("peer", b.PeerTarget(cc.Target())),
+				logx.String("peer_ip", peerIP),
+				logx.Int64("sent", sent),
+				logx.Int64("received", received),
+			}
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			b.clientLog(err, time.Since(start), fields("", 0, 0))
+			return nil, err
+		}
+		return observationX.NewClientStream(cs, desc, nil, func(err error, sent, received int64) {
+			p, _ := peer.FromContext(cs.Context())
+			b.clientLog(err, time.Since(start), fields(b.ClientPeerIP(p), sent, received))
+		}), nil
+	}
+}
+
+// clientLog 出错按 Error、超过慢调用阈值按 Warn、其余按 Info 记录
+func (b *InterceptorBuilder) clientLog(err error, cost time.Duration, fields []logx.Field) {
+	event := "normal"
+	if b.slow > 0 && cost >= b.slow {
+		event = "slow"
+	}
+	fields = append(fields, logx.Int64("cost", cost.Milliseconds()), logx.String("event", event))
+	if err == nil && event == "slow" {
+		b.l.Warn("RPC客户端调用", fields...)
+		return
+	}
+	b.log("RPC客户端调用", err, fields)
+}
+
+// log 有错误时按 Error 级别记录错误码
+func (b *InterceptorBuilder) log(msg string, err error, fields []logx.Field) {
+	if err == nil {
+		b.l.Info(msg, fields...)
+		return
+	}
+	st, _ := status.FromError(err)
+	fields = append(fields, logx.String("code", st.Code().String()), logx.String("code_msg", st.Message()))
+	b.l.Error(msg, fields...)
+}
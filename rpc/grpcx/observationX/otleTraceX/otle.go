@@ -10,8 +10,8 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	grpcstatus "google.golang.org/grpc/status"
 	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
 )
 
 type OTELInterceptorBuilder struct {
@@ -113,6 +113,106 @@ func (b *OTELInterceptorBuilder) BuildUnaryClientInterceptor() grpc.UnaryClientI
 	}
 }
 
+// BuildServerStreamInterceptor 从 GrpcHeaderCarrier 中取出客户端的 trace 上下文，整个流为一个 span，
+// 每条消息记录一个 message 事件，结束时记录收发消息数和最终状态
+func (b *OTELInterceptorBuilder) BuildServerStreamInterceptor() grpc.StreamServerInterceptor {
+	tracer := b.tracer
+	if tracer == nil {
+		tracer = otel.Tracer("gitee.com/hgg_test/jksj-study/webook/pkg/grpcx")
+	}
+	propagator := b.propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	attrs := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("grpc"),
+		attribute.Key("rpc.grpc.kind").String("stream"),
+		attribute.Key("rpc.component").String("server"),
+	}
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := extract(ss.Context(), propagator)
+		ctx, span := tracer.Start(ctx, info.FullMethod,
+			trace.WithAttributes(attrs...),
+			trace.WithSpanKind(trace.SpanKindServer))
+		span.SetAttributes(
+			semconv.RPCMethodKey.String(info.FullMethod),
+			semconv.NetPeerNameKey.String(b.PeerName(ctx)),
+			attribute.Key("net.peer.ip").String(b.PeerIP(ctx)),
+		)
+		ws := observationX.NewServerStream(ctx, ss, messageEvent(span))
+		defer func() {
+			endStream(span, err, ws.Sent(), ws.Received())
+		}()
+		return handler(srv, ws)
+	}
+}
+
+// BuildClientStreamInterceptor 通过 GrpcHeaderCarrier 把 trace 上下文传给服务端，span 在流结束时结束
+func (b *OTELInterceptorBuilder) BuildClientStreamInterceptor() grpc.StreamClientInterceptor {
+	tracer := b.tracer
+	if tracer == nil {
+		tracer = otel.GetTracerProvider().
+			Tracer("gitee.com/hgg_test/jksj-study/webook/pkg/grpcx")
+	}
+	propagator := b.propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	attrs := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("grpc"),
+		attribute.Key("rpc.grpc.kind").String("stream"),
+		attribute.Key("rpc.component").String("client"),
+		semconv.NetPeerNameKey.String(b.serviceName),
+	}
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := tracer.Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...),
+			trace.WithAttributes(semconv.RPCMethodKey.String(method)))
+		ctx = inject(ctx, propagator)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			endStream(span, err, 0, 0)
+			return nil, err
+		}
+		return observationX.NewClientStream(cs, desc, messageEvent(span), func(err error, sent, received int64) {
+			endStream(span, err, sent, received)
+		}), nil
+	}
+}
+
+// messageEvent 每条消息记录一个事件，与 otelgrpc 的事件格式一致
+func messageEvent(span trace.Span) func(sent bool, seq int64) {
+	return func(sent bool, seq int64) {
+		typ := "RECEIVED"
+		if sent {
+			typ = "SENT"
+		}
+		span.AddEvent("message", trace.WithAttributes(
+			attribute.Key("message.type").String(typ),
+			attribute.Key("message.id").Int64(seq),
+		))
+	}
+}
+
+// endStream 记录收发消息数和最终状态并结束 span
+func endStream(span trace.Span, err error, sent, received int64) {
+	span.SetAttributes(
+		attribute.Key("rpc.grpc.sent_messages").Int64(sent),
+		attribute.Key("rpc.grpc.received_messages").Int64(received),
+	)
+	if err != nil {
+		span.RecordError(err)
+		st, _ := grpcstatus.FromError(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int64(int64(st.Code())))
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int64(int64(0)))
+		span.SetStatus(codes.Ok, "OK")
+	}
+	span.End()
+}
+
 func extract(ctx context.Context, propagators propagation.TextMapPropagator) context.Context {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
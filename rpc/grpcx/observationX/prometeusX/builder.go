@@ -2,6 +2,7 @@ package prometeusX
 
 import (
 	"context"
+	"errors"
 	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX"
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
@@ -16,6 +17,8 @@ type InterceptorBuilder struct {
 	Name       string
 	InstanceId string
 	Help       string
+	// Buckets 客户端耗时直方图的桶，毫秒，默认 1ms ~ 10s
+	Buckets []float64
 	observationX.Builder
 }
 
@@ -62,6 +65,149 @@ func (b *InterceptorBuilder) BuildServerUnaryInterceptor() grpc.UnaryServerInter
 	}
 }
 
+// BuildServerStreamInterceptor 流结束时记录耗时【<name>_stream_resp_time，毫秒】和收发消息数【<name>_stream_msg_total】，
+// 收发消息数与 BuildClientStreamInterceptor 共用，用 type 区分
+func (b *InterceptorBuilder) BuildServerStreamInterceptor() grpc.StreamServerInterceptor {
+	duration, messages := b.streamDuration(), b.streamMessages()
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
+		ctx := ss.Context()
+		ws := observationX.NewServerStream(ctx, ss, nil)
+		defer func() {
+			sn, method := b.splitMethodName(info.FullMethod)
+			cost := float64(time.Since(start).Milliseconds())
+			duration.WithLabelValues("server_stream", sn, method, b.PeerName(ctx), b.code(err)).Observe(cost)
+			messages.WithLabelValues("server_stream", sn, method, "sent").Add(float64(ws.Sent()))
+			messages.WithLabelValues("server_stream", sn, method, "received").Add(float64(ws.Received()))
+		}()
+		return handler(srv, ws)
+	}
+}
+
+// BuildClientUnaryInterceptor 客户端调用耗时直方图【<name>_client_resp_time，毫秒】和错误数【<name>_client_errors_total】，
+// peer 为调用的服务【target 去掉 scheme】，从调用方看每个下游服务的耗时和错误
+func (b *InterceptorBuilder) BuildClientUnaryInterceptor() grpc.UnaryClientInterceptor {
+	duration, errs := b.clientDuration(), b.clientErrors()
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.observeClient(duration, errs, "unary", method, cc.Target(), start, err)
+		return err
+	}
+}
+
+// BuildClientStreamInterceptor 流结束时记录耗时和错误数【与 BuildClientUnaryInterceptor 共用指标，type=stream】和收发消息数
+func (b *InterceptorBuilder) BuildClientStreamInterceptor() grpc.StreamClientInterceptor {
+	duration, errs, messages := b.clientDuration(), b.clientErrors(), b.streamMessages()
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		sn, m := b.splitMethodName(method)
+		observe := func(err error, sent, received int64) {
+			b.observeClient(duration, errs, "stream", method, cc.Target(), start, err)
+			messages.WithLabelValues("client_stream", sn, m, "sent").Add(float64(sent))
+			messages.WithLabelValues("client_stream", sn, m, "received").Add(float64(received))
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			observe(err, 0, 0)
+			return nil, err
+		}
+		return observationX.NewClientStream(cs, desc, nil, observe), nil
+	}
+}
+
+func (b *InterceptorBuilder) observeClient(duration *prometheus.HistogramVec, errs *prometheus.CounterVec,
+	typ, fullMethod, target string, start time.Time, err error) {
+	sn, method := b.splitMethodName(fullMethod)
+	code, peer := b.code(err), b.PeerTarget(target)
+	duration.WithLabelValues(typ, sn, method, peer, code).Observe(float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		errs.WithLabelValues(typ, sn, method, peer, code).Inc()
+	}
+}
+
+// clientDuration 客户端一元、流拦截器共用，重复创建时复用已注册的
+func (b *InterceptorBuilder) clientDuration() *prometheus.HistogramVec {
+	buckets := b.Buckets
+	if len(buckets) == 0 {
+		buckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+	}
+	return register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Help:      b.Help,
+		Name:      b.Name + "_client_resp_time",
+		ConstLabels: map[string]string{
+			"instance_id": b.InstanceId,
+		},
+		Buckets: buckets,
+	}, []string{"type", "service", "method", "peer", "code"}))
+}
+
+func (b *InterceptorBuilder) clientErrors() *prometheus.CounterVec {
+	return register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Help:      b.Help,
+		Name:      b.Name + "_client_errors_total",
+		ConstLabels: map[string]string{
+			"instance_id": b.InstanceId,
+		},
+	}, []string{"type", "service", "method", "peer", "code"}))
+}
+
+func (b *InterceptorBuilder) streamDuration() *prometheus.SummaryVec {
+	return register(prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Help:      b.Help,
+		Name:      b.Name + "_stream_resp_time",
+		ConstLabels: map[string]string{
+			"instance_id": b.InstanceId,
+		},
+		Objectives: map[float64]float64{
+			0.5:   0.01,
+			0.75:  0.01,
+			0.9:   0.01,
+			0.99:  0.001,
+			0.999: 0.0001,
+		},
+	}, []string{"type", "service", "method", "peer", "code"}))
+}
+
+// streamMessages 服务端、客户端流拦截器共用
+func (b *InterceptorBuilder) streamMessages() *prometheus.CounterVec {
+	return register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Help:      b.Help,
+		Name:      b.Name + "_stream_msg_total",
+		ConstLabels: map[string]string{
+			"instance_id": b.InstanceId,
+		},
+	}, []string{"type", "service", "method", "direction"}))
+}
+
+// register 注册指标，已注册时复用已有的
+func register[T prometheus.Collector](c T) T {
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector.(T)
+		}
+		panic(err)
+	}
+	return c
+}
+
+func (b *InterceptorBuilder) code(err error) string {
+	if err == nil {
+		return "OK"
+	}
+	st, _ := status.FromError(err)
+	return st.Code().String()
+}
+
 func (b *InterceptorBuilder) splitMethodName(fullMethodName string) (string, string) {
 	fullMethodName = strings.TrimPrefix(fullMethodName, "/") // remove leading slash
 	if i := strings.Index(fullMethodName, "/"); i >= 0 {
@@ -0,0 +1,143 @@
+package observationX
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ServerStream 统计收发消息数的服务端流，供日志、监控、链路追踪的流拦截器使用
+type ServerStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	onMessage func(sent bool, seq int64)
+	sent      atomic.Int64
+	received  atomic.Int64
+}
+
+// NewServerStream 包装服务端流，ctx 替换 Context()【如带上链路追踪的 span】，onMessage 每收发一条消息调用一次，可以为 nil
+func NewServerStream(ctx context.Context, ss grpc.ServerStream, onMessage func(sent bool, seq int64)) *ServerStream {
+	return &ServerStream{ServerStream: ss, ctx: ctx, onMessage: onMessage}
+}
+
+func (s *ServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *ServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		seq := s.sent.Add(1)
+		if s.onMessage != nil {
+			s.onMessage(true, seq)
+		}
+	}
+	return err
+}
+
+func (s *ServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		seq := s.received.Add(1)
+		if s.onMessage != nil {
+			s.onMessage(false, seq)
+		}
+	}
+	return err
+}
+
+// Sent 已发送的消息数
+func (s *ServerStream) Sent() int64 {
+	return s.sent.Load()
+}
+
+// Received 已收到的消息数
+func (s *ServerStream) Received() int64 {
+	return s.received.Load()
+}
+
+// ClientStream 统计收发消息数的客户端流，流结束时回调一次 onFinish
+//   - 流结束：RecvMsg 返回错误【io.EOF 视为成功】、非服务端流收到响应、SendMsg/Header 出错、流的 ctx 结束
+type ClientStream struct {
+	grpc.ClientStream
+	desc      *grpc.StreamDesc
+	onMessage func(sent bool, seq int64)
+	onFinish  func(err error, sent, received int64)
+	sent      atomic.Int64
+	received  atomic.Int64
+	once      sync.Once
+	done      chan struct{}
+}
+
+// NewClientStream 包装客户端流，onMessage 可以为 nil，onFinish 收到流的最终错误，成功时为 nil
+func NewClientStream(cs grpc.ClientStream, desc *grpc.StreamDesc,
+	onMessage func(sent bool, seq int64), onFinish func(err error, sent, received int64)) *ClientStream {
+	s := &ClientStream{ClientStream: cs, desc: desc, onMessage: onMessage, onFinish: onFinish, done: make(chan struct{})}
+	go func() {
+		// 调用方没有读完流就放弃时，以流的 ctx 结束作为流结束；流的 ctx 在 RPC 结束时一定会结束，
+		// 调用方传入不会取消的 ctx 时也不会泄漏 goroutine
+		ctx := cs.Context()
+		select {
+		case <-ctx.Done():
+			s.finish(ctx.Err())
+		case <-s.done:
+		}
+	}()
+	return s
+}
+
+func (s *ClientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	switch {
+	case err == nil:
+		seq := s.sent.Add(1)
+		if s.onMessage != nil {
+			s.onMessage(true, seq)
+		}
+	case !errors.Is(err, io.EOF):
+		// io.EOF 表示流已结束，真正的状态由 RecvMsg 返回
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *ClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			s.finish(nil)
+		} else {
+			s.finish(err)
+		}
+		return err
+	}
+	seq := s.received.Add(1)
+	if s.onMessage != nil {
+		s.onMessage(false, seq)
+	}
+	if !s.desc.ServerStreams {
+		// 非服务端流只有一个响应
+		s.finish(nil)
+	}
+	return nil
+}
+
+func (s *ClientStream) Header() (md metadata.MD, err error) {
+	md, err = s.ClientStream.Header()
+	if err != nil {
+		s.finish(err)
+	}
+	return md, err
+}
+
+func (s *ClientStream) finish(err error) {
+	s.once.Do(func() {
+		close(s.done)
+		s.onFinish(err, s.sent.Load(), s.received.Load())
+	})
+}
@@ -0,0 +1,331 @@
+package observationX_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/logx/zerologx"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/grpcLogX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/otleTraceX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/prometeusX"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+// echoService 双向流原样返回，payload 为 err 时返回 InvalidArgument；客户端流返回收到的总字节数
+type echoService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (echoService) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if string(req.GetPayload().GetBody()) == "err" {
+			return status.Error(codes.InvalidArgument, "bad payload")
+		}
+		if err = stream.Send(&testpb.StreamingOutputCallResponse{Payload: req.GetPayload()}); err != nil {
+			return err
+		}
+	}
+}
+
+func (echoService) StreamingInputCall(stream testpb.TestService_StreamingInputCallServer) error {
+	var size int32
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		}
+		if err != nil {
+			return err
+		}
+		size += int32(len(req.GetPayload().GetBody()))
+	}
+}
+
+// syncBuffer 日志在服务端和客户端 goroutine 中并发写入
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+var runs atomic.Int64
+
+func TestStreamInterceptors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := otleTraceX.NewOTELInterceptorBuilder("echo", tp.Tracer("test"), propagation.TraceContext{})
+	// 指标注册在全局，-count 多次运行时用不同的 subsystem
+	subsystem := fmt.Sprintf("test%d", runs.Add(1))
+	metrics := prometeusX.NewInterceptorBuilder("hgg", subsystem, "stream", "1", "stream test")
+	logs := &syncBuffer{}
+	logger := grpcLogX.NewInterceptorBuilder(zerologx.NewZeroLogger(new(zerolog.New(logs))))
+
+	gs := grpc.NewServer(grpc.ChainStreamInterceptor(
+		tracer.BuildServerStreamInterceptor(),
+		metrics.BuildServerStreamInterceptor(),
+		logger.BuildServerStreamInterceptor(),
+	))
+	testpb.RegisterTestServiceServer(gs, echoService{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = gs.Serve(l)
+	}()
+	defer gs.Stop()
+
+	cc, err := grpc.NewClient(l.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainStreamInterceptor(
+			tracer.BuildClientStreamInterceptor(),
+			metrics.BuildClientStreamInterceptor(),
+			logger.BuildClientStreamInterceptor(),
+		))
+	require.NoError(t, err)
+	defer cc.Close()
+	client := testpb.NewTestServiceClient(cc)
+	ctx := context.Background()
+
+	// 双向流：发 3 收 3
+	duplex, err := client.FullDuplexCall(ctx)
+	require.NoError(t, err)
+	for _, body := range []string{"a", "b", "c"} {
+		require.NoError(t, duplex.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}))
+		_, err = duplex.Recv()
+		require.NoError(t, err)
+	}
+	require.NoError(t, duplex.CloseSend())
+	_, err = duplex.Recv()
+	require.ErrorIs(t, err, io.EOF)
+
+	// 客户端流：收到唯一的响应即结束
+	input, err := client.StreamingInputCall(ctx)
+	require.NoError(t, err)
+	for _, body := range []string{"ab", "cd"} {
+		require.NoError(t, input.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}))
+	}
+	resp, err := input.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), resp.GetAggregatedPayloadSize())
+
+	// 服务端返回错误
+	duplex, err = client.FullDuplexCall(ctx)
+	require.NoError(t, err)
+	require.NoError(t, duplex.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: []byte("err")}}))
+	_, err = duplex.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// 链路：服务端 span 是客户端 span 的子 span，记录收发消息数和状态码
+	spans := recorder.Ended()
+	require.Len(t, spans, 6)
+	servers := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range spans {
+		if s.SpanKind().String() == "server" {
+			servers[s.Parent().SpanID().String()] = s
+		}
+	}
+	for _, s := range spans {
+		if s.SpanKind().String() != "client" {
+			continue
+		}
+		srv, ok := servers[s.SpanContext().SpanID().String()]
+		require.True(t, ok, "找不到 %s 的服务端 span", s.Name())
+		assert.Equal(t, s.SpanContext().TraceID(), srv.SpanContext().TraceID())
+		assert.Equal(t, attr(s, "rpc.grpc.sent_messages"), attr(srv, "rpc.grpc.received_messages"))
+		assert.Equal(t, attr(s, "rpc.grpc.status_code"), attr(srv, "rpc.grpc.status_code"))
+	}
+	assert.Equal(t, int64(3), attr(spans[1], "rpc.grpc.sent_messages").AsInt64())
+	assert.Len(t, spans[1].Events(), 6)
+	assert.Equal(t, int64(codes.InvalidArgument), attr(spans[5], "rpc.grpc.status_code").AsInt64())
+
+	// 监控：服务端流耗时、收发消息数，客户端耗时与错误数和一元调用共用
+	peer := l.Addr().String()
+	messages := gather(t, "hgg_"+subsystem+"_stream_stream_msg_total", "type", "method", "direction")
+	assert.Equal(t, 4.0, messages["server_stream/FullDuplexCall/received"])
+	assert.Equal(t, 3.0, messages["server_stream/FullDuplexCall/sent"])
+	assert.Equal(t, 4.0, messages["client_stream/FullDuplexCall/sent"])
+	assert.Equal(t, 1.0, messages["client_stream/StreamingInputCall/received"])
+	durations := gather(t, "hgg_"+subsystem+"_stream_stream_resp_time", "type", "method", "code")
+	assert.Equal(t, 1.0, durations["server_stream/FullDuplexCall/OK"])
+	assert.Equal(t, 1.0, durations["server_stream/FullDuplexCall/InvalidArgument"])
+	callers := gather(t, "hgg_"+subsystem+"_stream_client_resp_time", "type", "method", "peer", "code")
+	assert.Equal(t, 1.0, callers["stream/FullDuplexCall/"+peer+"/InvalidArgument"])
+	assert.Equal(t, 1.0, callers["stream/StreamingInputCall/"+peer+"/OK"])
+	errs := gather(t, "hgg_"+subsystem+"_stream_client_errors_total", "type", "method", "code")
+	assert.Equal(t, map[string]float64{"stream/FullDuplexCall/InvalidArgument": 1}, errs)
+
+	// 日志：每个流服务端、客户端各一条
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Len(t, lines, 6)
+	assert.Contains(t, logs.String(), `"code":"InvalidArgument"`)
+	assert.Contains(t, logs.String(), `"sent":3`)
+	assert.Contains(t, logs.String(), `"peer_ip":"127.0.0.1"`)
+}
+
+func (echoService) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	switch string(req.GetPayload().GetBody()) {
+	case "err":
+		return nil, status.Error(codes.NotFound, "not found")
+	case "slow":
+		time.Sleep(50 * time.Millisecond)
+	}
+	return &testpb.SimpleResponse{Payload: req.GetPayload()}, nil
+}
+
+func TestClientUnaryInterceptors(t *testing.T) {
+	subsystem := fmt.Sprintf("test%d", runs.Add(1))
+	metrics := prometeusX.NewInterceptorBuilder("hgg", subsystem, "unary", "1", "client test")
+	logs := &syncBuffer{}
+	logger := grpcLogX.NewInterceptorBuilder(zerologx.NewZeroLogger(new(zerolog.New(logs)))).
+		SlowThreshold(30 * time.Millisecond)
+
+	gs := grpc.NewServer()
+	testpb.RegisterTestServiceServer(gs, echoService{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = gs.Serve(l)
+	}()
+	defer gs.Stop()
+
+	cc, err := grpc.NewClient("passthrough:///"+l.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(metrics.BuildClientUnaryInterceptor(), logger.BuildClientUnaryInterceptor()))
+	require.NoError(t, err)
+	defer cc.Close()
+	client := testpb.NewTestServiceClient(cc)
+
+	for _, body := range []string{"ok", "ok", "err", "slow"} {
+		_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte(body)}})
+		if body == "err" {
+			assert.Equal(t, codes.NotFound, status.Code(err))
+		} else {
+			require.NoError(t, err)
+		}
+	}
+
+	// peer 为去掉 scheme 的 target
+	peer := l.Addr().String()
+	durations := gather(t, "hgg_"+subsystem+"_unary_client_resp_time", "type", "service", "method", "peer", "code")
+	assert.Equal(t, map[string]float64{
+		"unary/grpc.testing.TestService/UnaryCall/" + peer + "/OK":       3,
+		"unary/grpc.testing.TestService/UnaryCall/" + peer + "/NotFound": 1,
+	}, durations)
+	errs := gather(t, "hgg_"+subsystem+"_unary_client_errors_total", "type", "method", "peer", "code")
+	assert.Equal(t, map[string]float64{"unary/UnaryCall/" + peer + "/NotFound": 1}, errs)
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], `"level":"info"`)
+	assert.Contains(t, lines[0], `"peer_ip":"127.0.0.1"`)
+	assert.Contains(t, lines[0], `"peer":"`+peer+`"`)
+	assert.Contains(t, lines[2], `"level":"error"`)
+	assert.Contains(t, lines[2], `"code":"NotFound"`)
+	assert.Contains(t, lines[3], `"level":"warn"`)
+	assert.Contains(t, lines[3], `"event":"slow"`)
+}
+
+// gather 读取全局注册的指标，key 为 label 的值用 / 连接，counter 取值，histogram、summary 取次数
+func gather(t *testing.T, name string, labels ...string) map[string]float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	res := map[string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			values := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				values[lp.GetName()] = lp.GetValue()
+			}
+			key := make([]string, 0, len(labels))
+			for _, l := range labels {
+				key = append(key, values[l])
+			}
+			switch {
+			case m.GetHistogram() != nil:
+				res[strings.Join(key, "/")] = float64(m.GetHistogram().GetSampleCount())
+			case m.GetSummary() != nil:
+				res[strings.Join(key, "/")] = float64(m.GetSummary().GetSampleCount())
+			default:
+				res[strings.Join(key, "/")] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return res
+}
+
+func attr(s sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// ctxClientStream 只实现 Context 的客户端流
+type ctxClientStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s *ctxClientStream) Context() context.Context {
+	return s.ctx
+}
+
+// TestClientStreamFinishOnStreamCtx 调用方没有读完流，以流的 ctx 结束作为流结束，与调用方的 ctx 无关
+func TestClientStreamFinishOnStreamCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error, 1)
+	observationX.NewClientStream(&ctxClientStream{ctx: ctx}, &grpc.StreamDesc{ServerStreams: true}, nil,
+		func(err error, sent, received int64) { finished <- err })
+
+	cancel()
+	select {
+	case err := <-finished:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("流的 ctx 结束后没有回调 onFinish")
+	}
+}
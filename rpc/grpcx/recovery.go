@@ -0,0 +1,48 @@
+package grpcx
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RecoveryHandler 把 panic 转为返回给客户端的错误
+type RecoveryHandler func(ctx context.Context, fullMethod string, p any) error
+
+// defaultRecoveryHandler 记录 panic 堆栈，返回 codes.Internal
+func defaultRecoveryHandler(l logx.Loggerx) RecoveryHandler {
+	return func(ctx context.Context, fullMethod string, p any) error {
+		stack := make([]byte, 4096)
+		stack = stack[:runtime.Stack(stack, false)]
+		l.Error("RPC panic", logx.String("method", fullMethod),
+			logx.String("panic", fmt.Sprintf("%v", p)), logx.String("stack", string(stack)))
+		return status.Errorf(codes.Internal, "panic: %v", p)
+	}
+}
+
+func recoveryUnaryInterceptor(h RecoveryHandler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				resp, err = nil, h(ctx, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func recoveryStreamInterceptor(h RecoveryHandler) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = h(ss.Context(), info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,289 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// PreviousAttemptsKey 重试、hedging 请求带上之前的尝试次数，与 gRPC 内置重试的 header 一致
+const PreviousAttemptsKey = "grpc-previous-rpc-attempts"
+
+// Policy 重试策略，零值字段使用默认值
+type Policy struct {
+	// MaxAttempts 最多尝试次数，包含第一次，默认 3
+	MaxAttempts int
+	// InitialBackoff 第一次重试前的等待时间，默认 10ms
+	InitialBackoff time.Duration
+	// MaxBackoff 等待时间上限，默认 1s
+	MaxBackoff time.Duration
+	// Multiplier 等待时间的增长系数，默认 2
+	Multiplier float64
+	// Jitter 等待时间的随机抖动比例【0~1】，默认 0.2，即 ±20%
+	Jitter float64
+	// RetryableCodes 可以重试的错误码，默认 Unavailable
+	RetryableCodes []codes.Code
+	// PerAttemptTimeout 单次尝试的超时，不超过 ctx 剩余的时间，0 表示不限制；单次超时的 DeadlineExceeded 可以重试
+	PerAttemptTimeout time.Duration
+}
+
+func (p Policy) withDefault() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 10 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = 0.2
+	}
+	if len(p.RetryableCodes) == 0 {
+		p.RetryableCodes = []codes.Code{codes.Unavailable}
+	}
+	return p
+}
+
+// backoff 第 retry 次重试前的等待时间，指数增长并加上随机抖动
+func (p Policy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	d = math.Min(d, float64(p.MaxBackoff))
+	d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+// HedgingPolicy hedging 策略：第一个请求 Delay 内没有返回就再发一个，最先成功的结果生效，其余取消
+//   - 只用于幂等的方法，同一个请求可能被服务端处理多次
+type HedgingPolicy struct {
+	// MaxAttempts 最多同时发出的请求数，包含第一次，默认 2
+	MaxAttempts int
+	// Delay 发出下一个请求前的等待时间，默认 50ms，一般设为接口的 P95 耗时
+	Delay time.Duration
+	// NonFatalCodes 这些错误码不结束 hedging，继续等其它请求或立即发出下一个请求，默认 Unavailable
+	NonFatalCodes []codes.Code
+}
+
+func (p HedgingPolicy) withDefault() HedgingPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 2
+	}
+	if p.Delay <= 0 {
+		p.Delay = 50 * time.Millisecond
+	}
+	if len(p.NonFatalCodes) == 0 {
+		p.NonFatalCodes = []codes.Code{codes.Unavailable}
+	}
+	return p
+}
+
+// Budget 重试预算，与 gRPC 的 retryThrottling 一致：令牌从 maxTokens 开始，
+// 每次失败减 1，每次成功加 ratio，令牌不超过 maxTokens 的一半时不再重试和 hedging，避免重试放大故障
+type Budget struct {
+	mu        sync.Mutex
+	tokens    float64
+	maxTokens float64
+	ratio     float64
+}
+
+// NewBudget 创建重试预算，如 NewBudget(10, 0.1)：持续失败 5 次后停止重试，之后每 10 次成功恢复 1 次失败的额度
+func NewBudget(maxTokens int, ratio float64) *Budget {
+	return &Budget{tokens: float64(maxTokens), maxTokens: float64(maxTokens), ratio: ratio}
+}
+
+// Allow 是否还有重试的预算
+func (b *Budget) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+func (b *Budget) onSuccess() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.maxTokens, b.tokens+b.ratio)
+	b.mu.Unlock()
+}
+
+func (b *Budget) onFailure() {
+	b.mu.Lock()
+	b.tokens = math.Max(0, b.tokens-1)
+	b.mu.Unlock()
+}
+
+// InterceptorBuilder 客户端重试、hedging 拦截器，只支持一元调用
+type InterceptorBuilder struct {
+	retry      Policy
+	hedging    HedgingPolicy
+	idempotent []string
+	budget     *Budget
+}
+
+// NewInterceptorBuilder 创建重试拦截器，默认重试预算 NewBudget(10, 0.1)
+func NewInterceptorBuilder(policy Policy) *InterceptorBuilder {
+	return &InterceptorBuilder{retry: policy.withDefault(), budget: NewBudget(10, 0.1)}
+}
+
+// Budget 重试预算，多个客户端可以共用一个预算
+func (b *InterceptorBuilder) Budget(budget *Budget) *InterceptorBuilder {
+	b.budget = budget
+	return b
+}
+
+// Hedging 对幂等的方法使用 hedging 代替重试，方法为完整方法名如 /UserService/GetById，或 /UserService/* 表示整个服务
+func (b *InterceptorBuilder) Hedging(policy HedgingPolicy, idempotentMethods ...string) *InterceptorBuilder {
+	b.hedging = policy.withDefault()
+	b.idempotent = idempotentMethods
+	return b
+}
+
+func (b *InterceptorBuilder) isIdempotent(method string) bool {
+	for _, m := range b.idempotent {
+		if m == method || (strings.HasSuffix(m, "/*") && strings.HasPrefix(method, strings.TrimSuffix(m, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildClientUnaryInterceptor 幂等方法 hedging，其余方法按策略重试
+func (b *InterceptorBuilder) BuildClientUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if m, ok := reply.(proto.Message); ok && b.isIdempotent(method) {
+			return b.hedge(ctx, method, req, m, cc, invoker, opts)
+		}
+		return b.doRetry(ctx, method, req, reply, cc, invoker, opts)
+	}
+}
+
+func (b *InterceptorBuilder) doRetry(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) error {
+	var err error
+	for attempt := 0; attempt < b.retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if !b.budget.Allow() || !sleep(ctx, b.retry.backoff(attempt)) {
+				return err
+			}
+		}
+		err = b.invokeAttempt(ctx, attempt, method, req, reply, cc, invoker, opts)
+		if err == nil {
+			b.budget.onSuccess()
+			return nil
+		}
+		if ctx.Err() != nil || !b.retryable(err) {
+			return err
+		}
+		b.budget.onFailure()
+	}
+	return err
+}
+
+func (b *InterceptorBuilder) retryable(err error) bool {
+	code := status.Code(err)
+	// ctx 没有结束时的 DeadlineExceeded 是单次超时
+	return slices.Contains(b.retry.RetryableCodes, code) ||
+		(code == codes.DeadlineExceeded && b.retry.PerAttemptTimeout > 0)
+}
+
+// invokeAttempt 单次尝试，带上之前的尝试次数和单次超时
+func (b *InterceptorBuilder) invokeAttempt(ctx context.Context, attempt int, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) error {
+	if attempt > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, PreviousAttemptsKey, strconv.Itoa(attempt))
+	}
+	if b.retry.PerAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.retry.PerAttemptTimeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// sleep 等待 d，ctx 剩余的时间不够 d 时不再等待，直接放弃重试
+func sleep(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type hedgeResult struct {
+	reply proto.Message
+	err   error
+}
+
+// hedge 每个请求使用独立的 reply，最先成功【或出现致命错误】的结果写回 reply
+//   - 请求并发发出，共用 opts，不要同时使用 grpc.Header、grpc.Trailer 这类写回结果的 CallOption
+func (b *InterceptorBuilder) hedge(ctx context.Context, method string, req any, reply proto.Message,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	// 返回时取消还在进行的请求
+	defer cancel()
+	results := make(chan hedgeResult, b.hedging.MaxAttempts)
+	sent, pending := 0, 0
+	timer := time.NewTimer(b.hedging.Delay)
+	defer timer.Stop()
+	next := func() {
+		if sent > 0 && (sent >= b.hedging.MaxAttempts || !b.budget.Allow()) {
+			return
+		}
+		r := reply.ProtoReflect().New().Interface()
+		attemptCtx := ctx
+		if sent > 0 {
+			attemptCtx = metadata.AppendToOutgoingContext(ctx, PreviousAttemptsKey, strconv.Itoa(sent))
+		}
+		go func() {
+			results <- hedgeResult{reply: r, err: invoker(attemptCtx, method, req, r, cc, opts...)}
+		}()
+		sent, pending = sent+1, pending+1
+		timer.Reset(b.hedging.Delay)
+	}
+
+	next()
+	var err error
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				b.budget.onSuccess()
+				proto.Reset(reply)
+				proto.Merge(reply, res.reply)
+				return nil
+			}
+			err = res.err
+			if ctx.Err() != nil || !slices.Contains(b.hedging.NonFatalCodes, status.Code(err)) {
+				return err
+			}
+			b.budget.onFailure()
+			// 可以继续的错误立即发出下一个请求
+			next()
+		case <-timer.C:
+			next()
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return err
+}
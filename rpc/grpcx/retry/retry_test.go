@@ -0,0 +1,221 @@
+package retry
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// flakyService 第 n 次调用【从 1 开始】的行为由 fn 决定
+type flakyService struct {
+	testpb.UnimplementedTestServiceServer
+	calls    atomic.Int64
+	attempts atomic.Value // 最后一次调用的 grpc-previous-rpc-attempts
+	fn       func(ctx context.Context, n int64) error
+}
+
+func (s *flakyService) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	n := s.calls.Add(1)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		s.attempts.Store(md.Get(PreviousAttemptsKey))
+	}
+	if err := s.fn(ctx, n); err != nil {
+		return nil, err
+	}
+	return &testpb.SimpleResponse{Payload: &testpb.Payload{Body: []byte(strconv.FormatInt(n, 10))}}, nil
+}
+
+func newRetryClient(t *testing.T, svc testpb.TestServiceServer, b *InterceptorBuilder) testpb.TestServiceClient {
+	server := grpc.NewServer()
+	testpb.RegisterTestServiceServer(server, svc)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(l)
+	}()
+	t.Cleanup(server.Stop)
+	cc, err := grpc.NewClient(l.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(b.BuildClientUnaryInterceptor()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = cc.Close()
+	})
+	return testpb.NewTestServiceClient(cc)
+}
+
+func TestRetry(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	testCases := []struct {
+		name    string
+		policy  Policy
+		fn      func(ctx context.Context, n int64) error
+		timeout time.Duration
+
+		wantCode  codes.Code
+		wantCalls int64
+	}{
+		{
+			name:      "重试后成功",
+			policy:    Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			fn:        func(ctx context.Context, n int64) error { return map[bool]error{true: unavailable}[n < 3] },
+			wantCode:  codes.OK,
+			wantCalls: 3,
+		},
+		{
+			name:      "超过最大次数",
+			policy:    Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			fn:        func(ctx context.Context, n int64) error { return unavailable },
+			wantCode:  codes.Unavailable,
+			wantCalls: 3,
+		},
+		{
+			name:      "不可重试的错误码",
+			policy:    Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			fn:        func(ctx context.Context, n int64) error { return status.Error(codes.InvalidArgument, "bad") },
+			wantCode:  codes.InvalidArgument,
+			wantCalls: 1,
+		},
+		{
+			name:   "自定义可重试的错误码",
+			policy: Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryableCodes: []codes.Code{codes.Aborted}},
+			fn: func(ctx context.Context, n int64) error {
+				return map[bool]error{true: status.Error(codes.Aborted, "aborted")}[n < 2]
+			},
+			wantCode:  codes.OK,
+			wantCalls: 2,
+		},
+		{
+			name:      "剩余时间不够退避，不再重试",
+			policy:    Policy{MaxAttempts: 5, InitialBackoff: 200 * time.Millisecond, Jitter: 0.01},
+			fn:        func(ctx context.Context, n int64) error { return unavailable },
+			timeout:   100 * time.Millisecond,
+			wantCode:  codes.Unavailable,
+			wantCalls: 1,
+		},
+		{
+			name:   "单次超时后重试",
+			policy: Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, PerAttemptTimeout: 50 * time.Millisecond},
+			fn: func(ctx context.Context, n int64) error {
+				if n == 1 {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return nil
+			},
+			wantCode:  codes.OK,
+			wantCalls: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &flakyService{fn: tc.fn}
+			client := newRetryClient(t, svc, NewInterceptorBuilder(tc.policy))
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			_, err := client.UnaryCall(ctx, &testpb.SimpleRequest{})
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.wantCalls, svc.calls.Load())
+			if tc.timeout > 0 {
+				// 放弃重试后立即返回，不等到 deadline
+				assert.Less(t, time.Since(start), tc.timeout)
+			}
+			if tc.wantCalls > 1 {
+				assert.Equal(t, []string{strconv.FormatInt(tc.wantCalls-1, 10)}, svc.attempts.Load())
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var healthy atomic.Bool
+	svc := &flakyService{fn: func(ctx context.Context, n int64) error {
+		if !healthy.Load() || n == 7 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	}}
+	// 令牌 4，不超过 2 时不再重试
+	client := newRetryClient(t, svc, NewInterceptorBuilder(Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}).
+		Budget(NewBudget(4, 1)))
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, int64(2), svc.calls.Load())
+
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, int64(3), svc.calls.Load(), "预算耗尽后不再重试")
+
+	// 成功恢复预算，第 7 次调用失败后可以再次重试
+	healthy.Store(true)
+	for range 3 {
+		_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		require.NoError(t, err)
+	}
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), svc.calls.Load())
+}
+
+func TestHedging(t *testing.T) {
+	slowFirst := func(ctx context.Context, n int64) error {
+		if n == 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+		return nil
+	}
+
+	t.Run("慢请求被 hedging 请求超越", func(t *testing.T) {
+		svc := &flakyService{fn: slowFirst}
+		client := newRetryClient(t, svc, NewInterceptorBuilder(Policy{}).
+			Hedging(HedgingPolicy{MaxAttempts: 3, Delay: 20 * time.Millisecond}, "/grpc.testing.TestService/*"))
+		start := time.Now()
+		resp, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, "2", string(resp.GetPayload().GetBody()))
+		assert.Equal(t, []string{"1"}, svc.attempts.Load())
+	})
+
+	t.Run("不可继续的错误立即返回", func(t *testing.T) {
+		svc := &flakyService{fn: func(ctx context.Context, n int64) error {
+			return status.Error(codes.NotFound, "not found")
+		}}
+		client := newRetryClient(t, svc, NewInterceptorBuilder(Policy{}).
+			Hedging(HedgingPolicy{MaxAttempts: 3, Delay: 20 * time.Millisecond}, "/grpc.testing.TestService/UnaryCall"))
+		_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.Equal(t, int64(1), svc.calls.Load())
+	})
+
+	t.Run("非幂等的方法不 hedging", func(t *testing.T) {
+		svc := &flakyService{fn: slowFirst}
+		client := newRetryClient(t, svc, NewInterceptorBuilder(Policy{}).
+			Hedging(HedgingPolicy{MaxAttempts: 3, Delay: 20 * time.Millisecond}, "/grpc.testing.TestService/EmptyCall"))
+		resp, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "1", string(resp.GetPayload().GetBody()))
+		assert.Equal(t, int64(1), svc.calls.Load())
+	})
+}
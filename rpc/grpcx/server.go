@@ -0,0 +1,344 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"github.com/hgg-6/pkgTool/v2/registry"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/circuitbreaker"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/limiter/limiterX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/grpcLogX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/otleTraceX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/prometeusX"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// ServerOption Server 配置
+type ServerOption func(*Server)
+
+// WithLogger 访问日志，同时用于启动、注册、退出等日志
+func WithLogger(l logx.Loggerx) ServerOption {
+	return func(s *Server) {
+		s.log = l
+		s.logger = grpcLogX.NewInterceptorBuilder(l)
+	}
+}
+
+// WithTracing 链路追踪
+func WithTracing(b *otleTraceX.OTELInterceptorBuilder) ServerOption {
+	return func(s *Server) {
+		s.tracing = b
+	}
+}
+
+// WithMetrics prometheus 监控
+func WithMetrics(b *prometeusX.InterceptorBuilder) ServerOption {
+	return func(s *Server) {
+		s.metrics = b
+	}
+}
+
+// WithLimiter 限流
+func WithLimiter(b *limiterX.InterceptorBuilder) ServerOption {
+	return func(s *Server) {
+		s.limiter = b
+	}
+}
+
+// WithBreaker 熔断
+func WithBreaker(b *circuitbreaker.InterceptorBuilder) ServerOption {
+	return func(s *Server) {
+		s.breaker = b
+	}
+}
+
+// WithRecovery 自定义 panic 的处理，默认记录堆栈并返回 codes.Internal
+func WithRecovery(h RecoveryHandler) ServerOption {
+	return func(s *Server) {
+		s.recovery = h
+	}
+}
+
+// WithRegistry 启动后注册到注册中心，退出时注销
+//   - si.Name 为空时使用服务名，si.Addr 为空时使用监听地址，监听地址没有 ip 时使用本机 ip
+func WithRegistry(reg registry.Registry, si registry.ServiceInstance) ServerOption {
+	return func(s *Server) {
+		s.registry, s.instance = reg, si
+	}
+}
+
+// WithUnaryInterceptor 追加自定义一元拦截器，位于内置拦截器之后
+func WithUnaryInterceptor(interceptors ...grpc.UnaryServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.unary = append(s.unary, interceptors...)
+	}
+}
+
+// WithStreamInterceptor 追加自定义流拦截器，位于内置拦截器之后
+func WithStreamInterceptor(interceptors ...grpc.StreamServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.stream = append(s.stream, interceptors...)
+	}
+}
+
+// WithServerOption 追加原生 grpc.ServerOption，如 TLS、消息大小
+func WithServerOption(opts ...grpc.ServerOption) ServerOption {
+	return func(s *Server) {
+		s.grpcOpts = append(s.grpcOpts, opts...)
+	}
+}
+
+// WithShutdownTimeout 优雅退出的最长等待时间，超时后强制关闭，默认 10s
+func WithShutdownTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.shutdownTimeout = d
+	}
+}
+
+// Server 组装好拦截器的 gRPC 服务
+//   - 一元、流拦截器顺序：链路追踪 -> 监控 -> 日志 -> recovery -> 限流 -> 熔断 -> 自定义，被限流、熔断的请求和 panic 也会被记录
+//   - 内置标准健康检查【grpc.health.v1】和反射服务
+//   - 嵌入了 *grpc.Server，直接用于 RegisterXxxServer
+type Server struct {
+	*grpc.Server
+	name   string
+	addr   string
+	health *health.Server
+
+	log             logx.Loggerx
+	logger          *grpcLogX.InterceptorBuilder
+	tracing         *otleTraceX.OTELInterceptorBuilder
+	metrics         *prometeusX.InterceptorBuilder
+	limiter         *limiterX.InterceptorBuilder
+	breaker         *circuitbreaker.InterceptorBuilder
+	recovery        RecoveryHandler
+	registry        registry.Registry
+	instance        registry.ServiceInstance
+	unary           []grpc.UnaryServerInterceptor
+	stream          []grpc.StreamServerInterceptor
+	grpcOpts        []grpc.ServerOption
+	shutdownTimeout time.Duration
+
+	mu         sync.Mutex
+	listener   net.Listener
+	registered bool
+	closed     bool
+}
+
+// NewServer 创建 gRPC 服务，name 为服务名，addr 为监听地址，如 :8090
+func NewServer(name, addr string, opts ...ServerOption) *Server {
+	s := &Server{name: name, addr: addr, log: logx.NewNopLogger(), shutdownTimeout: 10 * time.Second}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.recovery == nil {
+		s.recovery = defaultRecoveryHandler(s.log)
+	}
+	grpcOpts := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryInterceptors()...),
+		grpc.ChainStreamInterceptor(s.streamInterceptors()...),
+	}, s.grpcOpts...)
+	s.Server = grpc.NewServer(grpcOpts...)
+	s.health = health.NewServer()
+	healthpb.RegisterHealthServer(s.Server, s.health)
+	reflection.Register(s.Server)
+	return s
+}
+
+func (s *Server) unaryInterceptors() []grpc.UnaryServerInterceptor {
+	var res []grpc.UnaryServerInterceptor
+	if s.tracing != nil {
+		res = append(res, s.tracing.BuildUnaryServerInterceptor())
+	}
+	if s.metrics != nil {
+		res = append(res, s.metrics.BuildServerUnaryInterceptor())
+	}
+	if s.logger != nil {
+		res = append(res, s.logger.BuildServerUnaryInterceptor())
+	}
+	// recovery 在观测拦截器之内，panic 转成的 Internal 能被链路、监控、日志记录
+	res = append(res, recoveryUnaryInterceptor(s.recovery))
+	if s.limiter != nil {
+		res = append(res, s.limiter.BuildServerInterceptor())
+	}
+	if s.breaker != nil {
+		res = append(res, s.breaker.BuildServerUnaryInterceptor())
+	}
+	return append(res, s.unary...)
+}
+
+func (s *Server) streamInterceptors() []grpc.StreamServerInterceptor {
+	var res []grpc.StreamServerInterceptor
+	if s.tracing != nil {
+		res = append(res, s.tracing.BuildServerStreamInterceptor())
+	}
+	if s.metrics != nil {
+		res = append(res, s.metrics.BuildServerStreamInterceptor())
+	}
+	if s.logger != nil {
+		res = append(res, s.logger.BuildServerStreamInterceptor())
+	}
+	// recovery 在观测拦截器之内，panic 转成的 Internal 能被链路、监控、日志记录
+	res = append(res, recoveryStreamInterceptor(s.recovery))
+	if s.limiter != nil {
+		res = append(res, s.limiter.BuildServerStreamInterceptor())
+	}
+	if s.breaker != nil {
+		res = append(res, s.breaker.BuildServerStreamInterceptor())
+	}
+	return append(res, s.stream...)
+}
+
+// Addr 实际监听的地址，Serve 之前为空
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Health 健康检查服务，可按服务设置状态
+func (s *Server) Health() *health.Server {
+	return s.health
+}
+
+// Serve 监听、注册到注册中心并阻塞处理请求，Shutdown 后返回 nil
+func (s *Server) Serve() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	if s.registry != nil {
+		si := s.serviceInstance(l.Addr())
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err = s.registry.Register(ctx, si); err != nil {
+			_ = l.Close()
+			return err
+		}
+		s.mu.Lock()
+		s.instance, s.registered = si, true
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			// 注册期间已经 Shutdown
+			_ = s.registry.Deregister(ctx, si)
+			_ = l.Close()
+			return nil
+		}
+		s.log.Info("gRPC 服务已注册", logx.String("name", si.Name), logx.String("addr", si.Addr))
+	}
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.log.Info("gRPC 服务启动", logx.String("name", s.name), logx.String("addr", l.Addr().String()))
+	err = s.Server.Serve(l)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// serviceInstance 补全注册信息
+func (s *Server) serviceInstance(addr net.Addr) registry.ServiceInstance {
+	si := s.instance
+	if si.Name == "" {
+		si.Name = s.name
+	}
+	if si.Addr == "" {
+		si.Addr = advertiseAddr(addr)
+	}
+	return si
+}
+
+// Run 启动服务，收到 SIGINT/SIGTERM 或 ctx 结束时优雅退出
+func (s *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		s.log.Info("gRPC 服务收到退出信号", logx.String("name", s.name))
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+// Shutdown 优雅退出：健康检查置为 NOT_SERVING，从注册中心注销，等待处理中的请求完成，ctx 结束时强制关闭
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	registered, si := s.registered, s.instance
+	s.mu.Unlock()
+
+	s.health.Shutdown()
+	var err error
+	if registered {
+		if err = s.registry.Deregister(ctx, si); err != nil {
+			s.log.Error("gRPC 服务注销失败", logx.String("name", si.Name), logx.Error(err))
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.Server.Stop()
+		<-done
+	}
+	s.log.Info("gRPC 服务已退出", logx.String("name", s.name))
+	return err
+}
+
+// advertiseAddr 监听地址没有 ip【如 :8090】时使用本机的第一个非回环 ipv4
+func advertiseAddr(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
+	}
+	ip := "127.0.0.1"
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && n.IP.To4() != nil {
+				ip = n.IP.String()
+				break
+			}
+		}
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(tcp.Port))
+}
@@ -0,0 +1,190 @@
+package grpcx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hgg-6/pkgTool/v2/limiter"
+	"github.com/hgg-6/pkgTool/v2/registry"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/circuitbreaker"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/etcdx"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/limiter/limiterX"
+	"github.com/hgg-6/pkgTool/v2/rpc/grpcx/observationX/prometeusX"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// fakeRegistry 进程内的注册中心
+type fakeRegistry struct {
+	mu        sync.Mutex
+	instances map[string]registry.ServiceInstance
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{instances: make(map[string]registry.ServiceInstance)}
+}
+
+func (r *fakeRegistry) Register(ctx context.Context, si registry.ServiceInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.instances[si.Addr] = si
+	return nil
+}
+
+func (r *fakeRegistry) Deregister(ctx context.Context, si registry.ServiceInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.instances, si.Addr)
+	return nil
+}
+
+func (r *fakeRegistry) ListInstances(ctx context.Context, name string) ([]registry.ServiceInstance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []registry.ServiceInstance
+	for _, si := range r.instances {
+		if si.Name == name {
+			res = append(res, si)
+		}
+	}
+	return res, nil
+}
+
+// Watch 只推送一次当前的实例
+func (r *fakeRegistry) Watch(ctx context.Context, name string) (<-chan []registry.ServiceInstance, error) {
+	instances, _ := r.ListInstances(ctx, name)
+	ch := make(chan []registry.ServiceInstance, 1)
+	ch <- instances
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (r *fakeRegistry) Close() error {
+	return nil
+}
+
+// panicService GetById1 panic
+type panicService struct {
+	etcdx.Service
+}
+
+func (s *panicService) GetById1(ctx context.Context, req *etcdx.GetByIdRequest) (*etcdx.GetByIdResponse, error) {
+	panic("boom")
+}
+
+func startServer(t *testing.T, opts ...ServerOption) (*Server, chan error) {
+	s := NewServer("user", "127.0.0.1:0", opts...)
+	etcdx.RegisterUserServiceServer(s, &panicService{Service: etcdx.Service{Name: "a"}})
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Serve() }()
+	require.Eventually(t, func() bool { return s.Addr() != "" }, time.Second, 10*time.Millisecond)
+	return s, errCh
+}
+
+func TestServer(t *testing.T) {
+	reg := newFakeRegistry()
+	s, errCh := startServer(t,
+		WithRegistry(reg, registry.ServiceInstance{Weight: 10}),
+		WithLimiter(limiterX.NewInterceptorBuilder(limiter.NewCounterLimiter(1))),
+		WithBreaker(circuitbreaker.NewInterceptorBuilder()))
+
+	// 注册时补全服务名和地址
+	require.Eventually(t, func() bool {
+		instances, _ := reg.ListInstances(context.Background(), "user")
+		return len(instances) == 1
+	}, time.Second, 10*time.Millisecond)
+	instances, _ := reg.ListInstances(context.Background(), "user")
+	assert.Equal(t, registry.ServiceInstance{Name: "user", Addr: s.Addr(), Weight: 10}, instances[0])
+
+	// 通过注册中心发现服务
+	cc, err := NewClient("user", WithDiscovery(reg), WithBalancer("round_robin"),
+		WithClientBreaker(circuitbreaker.NewInterceptorBuilder())).Build()
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hc, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, hc.Status)
+
+	client := etcdx.NewUserServiceClient(cc)
+	resp, err := client.GetById(ctx, &etcdx.GetByIdRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "hgg+a", resp.User.Name)
+
+	// panic 转为 Internal，服务不退出
+	_, err = client.GetById1(ctx, &etcdx.GetByIdRequest{Id: 1})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	_, err = client.GetById(ctx, &etcdx.GetByIdRequest{Id: 1})
+	assert.NoError(t, err)
+
+	// 优雅退出：注销后停止服务
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.NoError(t, <-errCh)
+	instances, _ = reg.ListInstances(context.Background(), "user")
+	assert.Empty(t, instances)
+}
+
+func TestServer_Run(t *testing.T) {
+	s := NewServer("user", "127.0.0.1:0", WithShutdownTimeout(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run(ctx) }()
+	require.Eventually(t, func() bool { return s.Addr() != "" }, time.Second, 10*time.Millisecond)
+
+	cc, err := NewClient(s.Addr()).Build()
+	require.NoError(t, err)
+	defer cc.Close()
+	_, err = healthpb.NewHealthClient(cc).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case err = <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run 没有退出")
+	}
+}
+
+// TestServer_RecoveryInsideObservability panic 在观测拦截器之内转成 Internal，监控记录的是 Internal
+func TestServer_RecoveryInsideObservability(t *testing.T) {
+	s, errCh := startServer(t, WithMetrics(prometeusX.NewInterceptorBuilder("grpcx", "test", "recovery", "1", "test")))
+	cc, err := NewClient(s.Addr()).Build()
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = etcdx.NewUserServiceClient(cc).GetById1(ctx, &etcdx.GetByIdRequest{Id: 1})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	var codesSeen []string
+	for _, mf := range mfs {
+		if mf.GetName() != "grpcx_test_recovery_resp_time" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "code" {
+					codesSeen = append(codesSeen, l.GetValue())
+				}
+			}
+		}
+	}
+	assert.Equal(t, []string{"Internal"}, codesSeen)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.NoError(t, <-errCh)
+}
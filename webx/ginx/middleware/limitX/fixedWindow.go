@@ -1,47 +1,30 @@
 package limitX
 
 import (
-	"github.com/gin-gonic/gin"
-	"net/http"
-	"sync"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hgg-6/pkgTool/v2/limiter"
 )
 
 // FixedWindowLimiter 固定窗口限流算法
 type FixedWindowLimiter struct {
-	window          time.Duration // 窗口大小
-	lastWindowStart time.Time     // 窗口开始时间
-	cnt             int           // 窗口内请求数
-	threshold       int           // 阈值
-	lock            sync.Mutex    // 保护临界资源
+	l *limiter.LocalLimiter
 }
 
 // NewFixedWindowBuilder 创建固定窗口限流算法
 //   - window 窗口大小
 //   - threshold 阈值
 func NewFixedWindowBuilder(window time.Duration, threshold int) *FixedWindowLimiter {
-	return &FixedWindowLimiter{window: window, lastWindowStart: time.Now(), cnt: 0, threshold: threshold}
+	return &FixedWindowLimiter{l: limiter.NewFixedWindowLimiter(window, threshold)}
+}
+
+// Limiter 底层限流器，可与 gRPC 拦截器共用
+func (c *FixedWindowLimiter) Limiter() *limiter.LocalLimiter {
+	return c.l
 }
 
 // Build 固定窗口限流算法
 func (c *FixedWindowLimiter) Build() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		c.lock.Lock() // 加锁
-		now := time.Now()
-		// 判断是否到了新的窗口
-		if now.After(c.lastWindowStart.Add(c.window)) {
-			c.cnt = 0
-			c.lastWindowStart = now
-		}
-		// 检查是否超过阈值
-		if c.cnt >= c.threshold {
-			c.lock.Unlock()
-			ctx.AbortWithStatus(http.StatusTooManyRequests)
-			return
-		}
-		// 增加计数
-		c.cnt++
-		c.lock.Unlock() // 解锁
-		ctx.Next()
-	}
+	return global(c.l)
 }
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/hgg-6/pkgTool/v2/limiter"
 	"github.com/hgg-6/pkgTool/v2/logx"
-	"github.com/gin-gonic/gin"
 )
 
 type Builder struct {
@@ -17,8 +19,10 @@ type Builder struct {
 	//interval time.Duration
 	//// 阈值
 	//rate int
-	limiter limiter.Limiter
-	log     logx.Loggerx
+	limiter  limiter.Limiter
+	keyFunc  func(ctx *gin.Context) string
+	failOpen bool
+	log      logx.Loggerx
 }
 
 // NewRedisBuilder 【注册到gin中间件, server.use()】
@@ -37,9 +41,36 @@ func (b *Builder) Prefix(prefix string) *Builder {
 	return b
 }
 
+// KeyFunc 自定义限流 key，默认为 prefix:ClientIP，所有请求共用一个额度时使用 Global
+func (b *Builder) KeyFunc(fn func(ctx *gin.Context) string) *Builder {
+	b.keyFunc = fn
+	return b
+}
+
+// Global 所有请求共用一个额度，key 为 limiter.GlobalKey，与 gRPC 的 limiterX.InterceptorBuilder.Global 共用同一个限流器时两边共用额度
+func (b *Builder) Global() *Builder {
+	return b.KeyFunc(func(ctx *gin.Context) string { return limiter.GlobalKey })
+}
+
+// FailOpen 限流器出错【如 redis 不可用】时是否放行，默认 false 即返回 500
+func (b *Builder) FailOpen(open bool) *Builder {
+	b.failOpen = open
+	return b
+}
+
+func (b *Builder) key(ctx *gin.Context) string {
+	if b.keyFunc != nil {
+		return b.keyFunc(ctx)
+	}
+	return fmt.Sprintf("%s:%s", b.prefix, ctx.ClientIP())
+}
+
+// Build 限流中间件
+//   - limiter 实现了 limiter.ReserveLimiter【如 limiter.LocalLimiter】时，请求处理完成后归还并发额度
+//   - limiter 能返回额度信息时写入 RateLimit-Limit/RateLimit-Remaining，被限流时写入 Retry-After
 func (b *Builder) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		limited, err := b.limiter.Limit(ctx, fmt.Sprintf("%s:%s", b.prefix, ctx.ClientIP()))
+		r, err := limiter.Take(ctx, b.limiter, b.key(ctx))
 		if err != nil {
 			log.Println(err)
 			if b.log != nil {
@@ -47,13 +78,17 @@ func (b *Builder) Build() gin.HandlerFunc {
 			}
 			// 这一步很有意思，就是如果这边出错了
 			// 要怎么办？
+			if b.failOpen {
+				// 激进做法：虽然 Redis 崩溃了，但是这个时候还是要尽量服务正常的用户，所以不限流
+				ctx.Next()
+				return
+			}
 			// 保守做法：因为借助于 Redis 来做限流，那么 Redis 崩溃了，为了防止系统崩溃，直接限流
 			ctx.AbortWithStatus(http.StatusInternalServerError)
-			// 激进做法：虽然 Redis 崩溃了，但是这个时候还是要尽量服务正常的用户，所以不限流
-			// ctx.Next()
 			return
 		}
-		if limited {
+		writeRateLimitHeaders(ctx, r)
+		if !r.OK() {
 			if b.log != nil {
 				b.log.Info("请求被限流",
 					logx.String("client_ip", ctx.ClientIP()),
@@ -62,6 +97,26 @@ func (b *Builder) Build() gin.HandlerFunc {
 			ctx.AbortWithStatus(http.StatusTooManyRequests)
 			return
 		}
+		defer r.Done()
 		ctx.Next()
 	}
 }
+
+// writeRateLimitHeaders 写入标准限流响应头，limiter 不提供额度信息时不写
+func writeRateLimitHeaders(ctx *gin.Context, r *limiter.Reservation) {
+	if r.Limit() > 0 {
+		ctx.Header("RateLimit-Limit", strconv.Itoa(r.Limit()))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(max(r.Remaining(), 0)))
+	}
+	if !r.OK() && r.RetryAfter() > 0 {
+		// 向上取整到秒，避免客户端过早重试
+		sec := strconv.FormatInt(int64((r.RetryAfter()+time.Second-1)/time.Second), 10)
+		ctx.Header("RateLimit-Reset", sec)
+		ctx.Header("Retry-After", sec)
+	}
+}
+
+// global 进程内限流器的 gin 适配，所有请求共用一个额度，与 gRPC 的旧版限流拦截器一致
+func global(l limiter.Limiter) gin.HandlerFunc {
+	return NewRedisBuilder(l, nil).Global().Build()
+}
@@ -0,0 +1,462 @@
+package limitX
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hgg-6/pkgTool/v2/configx"
+	"github.com/hgg-6/pkgTool/v2/limiter"
+	"github.com/hgg-6/pkgTool/v2/logx"
+	"github.com/hgg-6/pkgTool/v2/webx/ginx/middleware/jwtX2"
+	"github.com/redis/go-redis/v9"
+)
+
+// 限流算法
+const (
+	AlgorithmCounter            = "counter"
+	AlgorithmFixedWindow        = "fixed_window"
+	AlgorithmSlidingWindow      = "sliding_window"
+	AlgorithmTokenBucket        = "token_bucket"
+	AlgorithmLeakyBucket        = "leaky_bucket"
+	AlgorithmRedisSlidingWindow = "redis_sliding_window"
+	AlgorithmRedisTokenBucket   = "redis_token_bucket"
+	AlgorithmRedisGCRA          = "redis_gcra"
+)
+
+// 限流维度，RuleConfig.Keys 的取值，header 维度写作 header:X-Api-Key
+const (
+	DimensionGlobal = "global"
+	DimensionIP     = "ip"
+	DimensionUser   = "user"
+	DimensionRoute  = "route"
+	DimensionMethod = "method"
+	DimensionHeader = "header:"
+)
+
+// RuleConfig 一条限流规则，可从配置文件读取，如：
+//
+//	limit_rules:
+//	  - name: login
+//	    routes: ["/users/login"]
+//	    methods: ["POST"]
+//	    keys: ["ip"]
+//	    algorithm: redis_gcra
+//	    rate: 5
+//	    period: 1m
+//	  - name: api
+//	    routes: ["/api/*"]
+//	    keys: ["user", "route"]
+//	    algorithm: token_bucket
+//	    rate: 100
+//	    period: 1s
+//	    burst: 200
+//	    fail_open: true
+type RuleConfig struct {
+	// Name 规则名，唯一，同时作为限流 key 的前缀
+	Name string `mapstructure:"name" json:"name"`
+
+	// 匹配条件，全部满足才命中，为空的条件不参与匹配
+	// Routes gin 路由模式【ctx.FullPath()，如 /users/:id】，以 * 结尾时按前缀匹配
+	Routes []string `mapstructure:"routes" json:"routes"`
+	// Methods 请求方法，不区分大小写
+	Methods []string `mapstructure:"methods" json:"methods"`
+	// Headers 请求头取值，值为 * 时只要求请求头存在
+	Headers map[string]string `mapstructure:"headers" json:"headers"`
+	// Users jwtX2.UserClaims 的 Uid
+	Users []int64 `mapstructure:"users" json:"users"`
+	// IPs 客户端 ip 或 CIDR
+	IPs []string `mapstructure:"ips" json:"ips"`
+
+	// Keys 限流维度，多个维度组合成一个 key，默认 ip
+	//   - global/ip/user/route/method/header:<请求头>
+	//   - user 维度取不到 jwt 用户时退化为 ip
+	Keys []string `mapstructure:"keys" json:"keys"`
+
+	// Algorithm 限流算法，默认 token_bucket，见 Algorithm* 常量，redis_* 需要 NewRuleBuilder 传入 redis 客户端
+	Algorithm string `mapstructure:"algorithm" json:"algorithm"`
+	// Rate Period 内允许的请求数，counter 算法为最大并发数
+	Rate int `mapstructure:"rate" json:"rate"`
+	// Period 统计周期，默认 1s
+	Period time.Duration `mapstructure:"period" json:"period"`
+	// Burst 允许的突发数，令牌桶/漏桶/GCRA 有效，漏桶为最多排队等待的请求数，默认等于 Rate
+	Burst int `mapstructure:"burst" json:"burst"`
+	// FailOpen 限流器出错时放行，默认 false 即返回 500
+	FailOpen bool `mapstructure:"fail_open" json:"fail_open"`
+}
+
+// rule 生效中的规则
+type rule struct {
+	cfg     RuleConfig
+	limiter limiter.Limiter
+	nets    []*net.IPNet
+	ips     map[string]struct{}
+	users   map[int64]struct{}
+}
+
+// RuleBuilder 基于规则的多维度限流中间件
+//   - 请求依次匹配每条规则，命中的规则都要放行请求才会继续处理，任一规则触发限流即返回 429
+//   - 规则可通过 Load 直接加载，或通过 LoadConfig/Watch 从 configx.ConfigIn 读取并热更新
+//   - 热更新时配置未变化的规则保留原限流器，已有的计数不会丢失
+type RuleBuilder struct {
+	cmd     redis.Cmdable
+	log     logx.Loggerx
+	userKey string
+	rules   atomic.Pointer[[]*rule]
+}
+
+// NewRuleBuilder 创建规则限流中间件，cmd 为 nil 时不能使用 redis_* 算法
+func NewRuleBuilder(cmd redis.Cmdable, log logx.Loggerx) *RuleBuilder {
+	b := &RuleBuilder{cmd: cmd, log: log, userKey: "user"}
+	b.rules.Store(&[]*rule{})
+	return b
+}
+
+// UserKey 从 gin.Context 中取 *jwtX2.UserClaims 的 key，默认 user，与 jwtX2.VerifyToken 一致
+func (b *RuleBuilder) UserKey(key string) *RuleBuilder {
+	b.userKey = key
+	return b
+}
+
+// Rules 当前生效的规则
+func (b *RuleBuilder) Rules() []RuleConfig {
+	rules := *b.rules.Load()
+	res := make([]RuleConfig, 0, len(rules))
+	for _, r := range rules {
+		res = append(res, r.cfg)
+	}
+	return res
+}
+
+// Load 加载规则，任一规则不合法时返回 error 且保留原规则
+func (b *RuleBuilder) Load(cfgs []RuleConfig) error {
+	old := make(map[string]*rule)
+	for _, r := range *b.rules.Load() {
+		old[r.cfg.Name] = r
+	}
+	names := make(map[string]struct{}, len(cfgs))
+	rules := make([]*rule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		cfg = normalizeRule(cfg)
+		if _, ok := names[cfg.Name]; ok {
+			return fmt.Errorf("限流规则名重复: %s", cfg.Name)
+		}
+		names[cfg.Name] = struct{}{}
+		if r, ok := old[cfg.Name]; ok && reflect.DeepEqual(r.cfg, cfg) {
+			rules = append(rules, r)
+			continue
+		}
+		r, err := b.newRule(cfg)
+		if err != nil {
+			return fmt.Errorf("限流规则 %s 不合法: %w", cfg.Name, err)
+		}
+		rules = append(rules, r)
+	}
+	b.rules.Store(&rules)
+	return nil
+}
+
+// LoadConfig 从配置的 key 读取 []RuleConfig 并加载，fileName 同 configx.ConfigIn.GetUnmarshalKey
+func (b *RuleBuilder) LoadConfig(conf configx.ConfigIn, key string, fileName ...string) error {
+	var cfgs []RuleConfig
+	if err := conf.GetUnmarshalKey(key, &cfgs, fileName...); err != nil {
+		return fmt.Errorf("读取限流规则失败: %w", err)
+	}
+	return b.Load(cfgs)
+}
+
+// Watch 加载规则后每 interval 重新读取一次，配置变化时热更新，ctx 结束时停止
+//   - 配合 InitViperLocalWatch/InitViperRemoteWatch 使用，文件或远程配置变化后在下一个 interval 生效
+//   - 新规则不合法时记录日志并保留原规则
+func (b *RuleBuilder) Watch(ctx context.Context, conf configx.ConfigIn, key string, interval time.Duration, fileName ...string) error {
+	if err := b.LoadConfig(conf, key, fileName...); err != nil {
+		return err
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := b.LoadConfig(conf, key, fileName...); err != nil && b.log != nil {
+					b.log.Error("限流规则热更新失败，保留原规则", logx.Error(err), logx.String("key", key))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Build 规则限流中间件
+func (b *RuleBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rules := *b.rules.Load()
+		claims := b.claims(ctx)
+		var (
+			taken []*limiter.Reservation
+			head  *limiter.Reservation // 剩余额度最少的放行结果，写入响应头
+		)
+		for _, r := range rules {
+			if !r.match(ctx, claims) {
+				continue
+			}
+			res, err := limiter.Take(ctx, r.limiter, r.key(ctx, claims))
+			if err != nil {
+				if b.log != nil {
+					b.log.Error("限流出错", logx.Error(err), logx.String("rule", r.cfg.Name))
+				}
+				if r.cfg.FailOpen {
+					continue
+				}
+				cancelAll(taken)
+				ctx.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if !res.OK() {
+				cancelAll(taken)
+				if b.log != nil {
+					b.log.Info("请求被限流",
+						logx.String("rule", r.cfg.Name),
+						logx.String("client_ip", ctx.ClientIP()),
+						logx.String("path", ctx.Request.URL.Path))
+				}
+				writeRateLimitHeaders(ctx, res)
+				ctx.AbortWithStatus(http.StatusTooManyRequests)
+				return
+			}
+			taken = append(taken, res)
+			if res.Limit() > 0 && (head == nil || res.Remaining() < head.Remaining()) {
+				head = res
+			}
+		}
+		if head != nil {
+			writeRateLimitHeaders(ctx, head)
+		}
+		defer func() {
+			for _, res := range taken {
+				res.Done()
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+// claims 取 jwt 用户，未登录时为 nil
+func (b *RuleBuilder) claims(ctx *gin.Context) *jwtX2.UserClaims {
+	val, ok := ctx.Get(b.userKey)
+	if !ok {
+		return nil
+	}
+	claims, _ := val.(*jwtX2.UserClaims)
+	return claims
+}
+
+// cancelAll 后面的规则触发限流时，归还前面规则已占用的额度
+func cancelAll(taken []*limiter.Reservation) {
+	for _, res := range taken {
+		res.Cancel()
+	}
+}
+
+// normalizeRule 填充默认值
+func normalizeRule(cfg RuleConfig) RuleConfig {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgorithmTokenBucket
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = time.Second
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Rate
+	}
+	if len(cfg.Keys) == 0 {
+		cfg.Keys = []string{DimensionIP}
+	}
+	methods := make([]string, 0, len(cfg.Methods))
+	for _, m := range cfg.Methods {
+		methods = append(methods, strings.ToUpper(m))
+	}
+	cfg.Methods = methods
+	return cfg
+}
+
+func (b *RuleBuilder) newRule(cfg RuleConfig) (*rule, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("规则名不能为空")
+	}
+	if cfg.Rate <= 0 {
+		return nil, errors.New("rate 必须大于 0")
+	}
+	for _, k := range cfg.Keys {
+		switch {
+		case k == DimensionGlobal, k == DimensionIP, k == DimensionUser, k == DimensionRoute, k == DimensionMethod:
+		case strings.HasPrefix(k, DimensionHeader) && len(k) > len(DimensionHeader):
+		default:
+			return nil, fmt.Errorf("未知的限流维度: %s", k)
+		}
+	}
+	l, err := b.newLimiter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &rule{cfg: cfg, limiter: l}
+	for _, ip := range cfg.IPs {
+		if strings.Contains(ip, "/") {
+			_, n, err := net.ParseCIDR(ip)
+			if err != nil {
+				return nil, fmt.Errorf("ip 段不合法: %s", ip)
+			}
+			r.nets = append(r.nets, n)
+			continue
+		}
+		if r.ips == nil {
+			r.ips = make(map[string]struct{})
+		}
+		r.ips[ip] = struct{}{}
+	}
+	if len(cfg.Users) > 0 {
+		r.users = make(map[int64]struct{}, len(cfg.Users))
+		for _, uid := range cfg.Users {
+			r.users[uid] = struct{}{}
+		}
+	}
+	return r, nil
+}
+
+func (b *RuleBuilder) newLimiter(cfg RuleConfig) (limiter.Limiter, error) {
+	interval := cfg.Period / time.Duration(cfg.Rate)
+	if strings.HasPrefix(cfg.Algorithm, "redis_") && b.cmd == nil {
+		return nil, fmt.Errorf("算法 %s 需要 redis 客户端", cfg.Algorithm)
+	}
+	prefix := "limiter:rule:" + cfg.Name + ":"
+	switch cfg.Algorithm {
+	case AlgorithmCounter:
+		return limiter.NewCounterLimiter(cfg.Rate), nil
+	case AlgorithmFixedWindow:
+		return limiter.NewFixedWindowLimiter(cfg.Period, cfg.Rate), nil
+	case AlgorithmSlidingWindow:
+		return limiter.NewSlidingWindowLimiter(cfg.Period, cfg.Rate), nil
+	case AlgorithmTokenBucket:
+		return limiter.NewTokenBucketLimiter(interval, cfg.Burst), nil
+	case AlgorithmLeakyBucket:
+		// 最多 Burst 个请求排队等待匀速放行，排队已满时触发限流
+		return limiter.NewLeakyBucketLimiter(interval, cfg.Burst).MaxWait(interval * time.Duration(cfg.Burst)), nil
+	case AlgorithmRedisSlidingWindow:
+		return limiter.NewRedisSlideWindowKLimiterWithPrefix(b.cmd, prefix, cfg.Period, cfg.Rate), nil
+	case AlgorithmRedisTokenBucket:
+		return limiter.NewRedisTokenBucketLimiter(b.cmd, interval, cfg.Burst).Prefix(prefix), nil
+	case AlgorithmRedisGCRA:
+		return limiter.NewRedisGCRALimiter(b.cmd, cfg.Period, cfg.Rate, cfg.Burst).Prefix(prefix), nil
+	default:
+		return nil, fmt.Errorf("未知的限流算法: %s", cfg.Algorithm)
+	}
+}
+
+// route 路由模式，未匹配到路由时为请求路径
+func route(ctx *gin.Context) string {
+	if p := ctx.FullPath(); p != "" {
+		return p
+	}
+	return ctx.Request.URL.Path
+}
+
+func (r *rule) match(ctx *gin.Context, claims *jwtX2.UserClaims) bool {
+	if len(r.cfg.Routes) > 0 {
+		path, ok := route(ctx), false
+		for _, p := range r.cfg.Routes {
+			if p == path || (strings.HasSuffix(p, "*") && strings.HasPrefix(path, strings.TrimSuffix(p, "*"))) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.cfg.Methods) > 0 {
+		ok := false
+		for _, m := range r.cfg.Methods {
+			if m == ctx.Request.Method {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for name, val := range r.cfg.Headers {
+		got := ctx.GetHeader(name)
+		if got == "" || (val != "*" && got != val) {
+			return false
+		}
+	}
+	if r.users != nil {
+		if claims == nil {
+			return false
+		}
+		if _, ok := r.users[claims.Uid]; !ok {
+			return false
+		}
+	}
+	if r.ips != nil || r.nets != nil {
+		return r.matchIP(ctx.ClientIP())
+	}
+	return true
+}
+
+func (r *rule) matchIP(ip string) bool {
+	if _, ok := r.ips[ip]; ok {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range r.nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// key 规则名和各维度的值组成的限流 key
+func (r *rule) key(ctx *gin.Context, claims *jwtX2.UserClaims) string {
+	parts := make([]string, 0, len(r.cfg.Keys)+1)
+	parts = append(parts, r.cfg.Name)
+	for _, k := range r.cfg.Keys {
+		switch {
+		case k == DimensionGlobal:
+		case k == DimensionIP:
+			parts = append(parts, "ip="+ctx.ClientIP())
+		case k == DimensionUser:
+			if claims != nil && claims.Uid != 0 {
+				parts = append(parts, "user="+strconv.FormatInt(claims.Uid, 10))
+			} else {
+				parts = append(parts, "ip="+ctx.ClientIP())
+			}
+		case k == DimensionRoute:
+			parts = append(parts, "route="+route(ctx))
+		case k == DimensionMethod:
+			parts = append(parts, "method="+ctx.Request.Method)
+		case strings.HasPrefix(k, DimensionHeader):
+			name := strings.TrimPrefix(k, DimensionHeader)
+			parts = append(parts, name+"="+ctx.GetHeader(name))
+		}
+	}
+	return strings.Join(parts, ":")
+}
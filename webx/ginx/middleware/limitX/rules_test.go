@@ -0,0 +1,185 @@
+package limitX
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hgg-6/pkgTool/v2/configx"
+	"github.com/hgg-6/pkgTool/v2/webx/ginx/middleware/jwtX2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRuleServer(b *RuleBuilder) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(func(ctx *gin.Context) {
+		if uid := ctx.GetHeader("X-Uid"); uid == "1" {
+			ctx.Set("user", &jwtX2.UserClaims{Uid: 1})
+		}
+	})
+	server.Use(b.Build())
+	server.GET("/users/:id", func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") })
+	server.POST("/users/login", func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") })
+	return server
+}
+
+func doRequest(server *gin.Engine, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRuleBuilder_Match(t *testing.T) {
+	b := NewRuleBuilder(nil, nil)
+	require.NoError(t, b.Load([]RuleConfig{
+		{Name: "login", Routes: []string{"/users/login"}, Methods: []string{"post"}, Algorithm: AlgorithmFixedWindow, Rate: 1, Period: time.Minute},
+		{Name: "vip", Routes: []string{"/users/*"}, Users: []int64{1}, Keys: []string{DimensionUser}, Algorithm: AlgorithmFixedWindow, Rate: 2, Period: time.Minute},
+		{Name: "api-key", Headers: map[string]string{"X-Api-Key": "*"}, Keys: []string{"header:X-Api-Key"}, Algorithm: AlgorithmFixedWindow, Rate: 1, Period: time.Minute},
+	}))
+	server := newRuleServer(b)
+
+	// 只有 POST /users/login 命中 login 规则
+	resp := doRequest(server, http.MethodPost, "/users/login", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", resp.Header().Get("RateLimit-Remaining"))
+	resp = doRequest(server, http.MethodPost, "/users/login", nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "60", resp.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", nil).Code)
+
+	// vip 规则按用户限流，未登录不命中
+	uid := map[string]string{"X-Uid": "1"}
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", uid).Code)
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/2", uid).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(server, http.MethodGet, "/users/3", uid).Code)
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/3", nil).Code)
+
+	// 按请求头取值限流
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", map[string]string{"X-Api-Key": "a"}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(server, http.MethodGet, "/users/1", map[string]string{"X-Api-Key": "a"}).Code)
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", map[string]string{"X-Api-Key": "b"}).Code)
+}
+
+func TestRuleBuilder_IP(t *testing.T) {
+	b := NewRuleBuilder(nil, nil)
+	require.NoError(t, b.Load([]RuleConfig{
+		{Name: "intranet", IPs: []string{"10.0.0.0/8"}, Keys: []string{DimensionGlobal}, Algorithm: AlgorithmCounter, Rate: 1},
+	}))
+	server := newRuleServer(b)
+	// 并发计数器在请求结束后归还
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", nil).Code)
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", nil).Code)
+}
+
+func TestRuleBuilder_LeakyBucketBurst(t *testing.T) {
+	b := NewRuleBuilder(nil, nil)
+	require.NoError(t, b.Load([]RuleConfig{
+		{Name: "leaky", Keys: []string{DimensionGlobal}, Algorithm: AlgorithmLeakyBucket, Rate: 20, Period: time.Second, Burst: 3},
+	}))
+	server := newRuleServer(b)
+
+	// 同时到达的突发请求排队匀速放行，超出 Burst 的被拒绝
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = make(map[int]int)
+	)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code := doRequest(server, http.MethodGet, "/users/1", nil).Code
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, codes[http.StatusOK], 3)
+	assert.Positive(t, codes[http.StatusTooManyRequests])
+}
+
+func TestRuleBuilder_Load(t *testing.T) {
+	b := NewRuleBuilder(nil, nil)
+	assert.Error(t, b.Load([]RuleConfig{{Name: "a", Rate: 1, Algorithm: AlgorithmRedisGCRA}}))
+	assert.Error(t, b.Load([]RuleConfig{{Name: "a", Rate: 1}, {Name: "a", Rate: 1}}))
+	assert.Error(t, b.Load([]RuleConfig{{Name: "a", Rate: 1, Keys: []string{"unknown"}}}))
+	assert.Error(t, b.Load([]RuleConfig{{Name: "a", Rate: 0}}))
+	assert.Error(t, b.Load([]RuleConfig{{Name: "a", Rate: 1, IPs: []string{"10.0.0.0/99"}}}))
+	assert.Empty(t, b.Rules())
+}
+
+// fakeConfig 可修改规则的 configx.ConfigIn
+type fakeConfig struct {
+	configx.ConfigIn
+	mu    sync.Mutex
+	rules []RuleConfig
+}
+
+func (c *fakeConfig) set(rules []RuleConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = rules
+}
+
+func (c *fakeConfig) GetUnmarshalKey(key string, rawVal any, fileName ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*rawVal.(*[]RuleConfig) = append([]RuleConfig(nil), c.rules...)
+	return nil
+}
+
+func TestRuleBuilder_Watch(t *testing.T) {
+	conf := &fakeConfig{rules: []RuleConfig{{Name: "a", Algorithm: AlgorithmFixedWindow, Rate: 1, Period: time.Minute}}}
+	b := NewRuleBuilder(nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, b.Watch(ctx, conf, "limit_rules", 10*time.Millisecond))
+	server := newRuleServer(b)
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(server, http.MethodGet, "/users/1", nil).Code)
+
+	// 未变化的规则保留计数
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(server, http.MethodGet, "/users/1", nil).Code)
+
+	// 不合法的规则不生效
+	conf.set([]RuleConfig{{Name: "a", Rate: 0}})
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, 1, b.Rules()[0].Rate)
+
+	conf.set([]RuleConfig{{Name: "a", Algorithm: AlgorithmFixedWindow, Rate: 3, Period: time.Minute}})
+	assert.Eventually(t, func() bool { return b.Rules()[0].Rate == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, "/users/1", nil).Code)
+}
+
+func TestBuilder_FailOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		failOpen bool
+		code     int
+	}{{false, http.StatusInternalServerError}, {true, http.StatusOK}} {
+		server := gin.New()
+		server.Use(NewRedisBuilder(errLimiter{}, nil).FailOpen(tc.failOpen).Build())
+		server.GET("/", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+		assert.Equal(t, tc.code, doRequest(server, http.MethodGet, "/", nil).Code)
+	}
+}
+
+type errLimiter struct{}
+
+func (errLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return false, assert.AnError
+}